@@ -0,0 +1,39 @@
+package controller
+
+import (
+	"campus2/app/auth/service"
+	"campus2/pkg/utils"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AuthController struct {
+	authService *service.AuthService
+}
+
+func NewAuthController() *AuthController {
+	return &AuthController{
+		authService: service.NewAuthService(),
+	}
+}
+
+// RevokeToken godoc
+// @Summary 吊销当前token
+// @Description 退出登录时调用，token在过期前不能再使用，使用该token的长连接随后断开
+// @Tags 认证
+// @Success 204
+// @Router /auth/revoke [post]
+func (ac *AuthController) RevokeToken(c *gin.Context) {
+	if err := ac.authService.RevokeToken(utils.GetClaims(c)); err != nil {
+		utils.RespondError(c, err, errorStatus)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// errorStatus 业务错误对应的HTTP状态码
+var errorStatus = map[error]int{
+	service.ErrRevokeDisabled: http.StatusServiceUnavailable,
+}
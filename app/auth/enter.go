@@ -0,0 +1,24 @@
+package auth
+
+import (
+	"campus2/app/auth/controller"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AuthApp struct {
+	authController *controller.AuthController
+}
+
+func NewAuthApp() *AuthApp {
+	return &AuthApp{
+		authController: controller.NewAuthController(),
+	}
+}
+
+func (a *AuthApp) InitAuthRouter(private *gin.RouterGroup, public *gin.RouterGroup) {
+	privateGroup := private.Group("auth")
+	{
+		privateGroup.POST("revoke", a.authController.RevokeToken)
+	}
+}
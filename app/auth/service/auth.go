@@ -0,0 +1,28 @@
+package service
+
+import (
+	"campus2/pkg/global"
+	"campus2/pkg/utils"
+	"errors"
+)
+
+var ErrRevokeDisabled = errors.New("未启用Redis，无法吊销token")
+
+type AuthService struct{}
+
+func NewAuthService() *AuthService {
+	return &AuthService{}
+}
+
+// RevokeToken 吊销当前请求使用的token，用于退出登录。
+// 使用该token建立的WebSocket、SSE和轮询连接在下一次心跳刷新时断开
+func (s *AuthService) RevokeToken(claims *utils.CustomClaims) error {
+	if global.GVA_REDIS == nil {
+		return ErrRevokeDisabled
+	}
+	if err := utils.RevokeToken(claims); err != nil {
+		return err
+	}
+	global.GVA_LOG.Infof("用户 %s 吊销了token %s", claims.Subject, claims.ID)
+	return nil
+}
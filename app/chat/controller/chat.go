@@ -0,0 +1,125 @@
+package controller
+
+import (
+	"campus2/app/chat/dto"
+	"campus2/app/chat/service"
+	"campus2/pkg/utils"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ChatController struct {
+	chatService *service.ChatService
+}
+
+func NewChatController() *ChatController {
+	return &ChatController{
+		chatService: service.NewChatService(),
+	}
+}
+
+// ListConversations godoc
+// @Summary 会话列表
+// @Description 返回当前用户参与的单聊和群聊会话，按最近消息时间倒序
+// @Tags 聊天
+// @Produce json
+// @Success 200 {array} vo.Conversation
+// @Router /chat/conversations [get]
+func (cc *ChatController) ListConversations(c *gin.Context) {
+	response, err := cc.chatService.ListConversations(utils.GetUserID(c))
+	if err != nil {
+		utils.RespondError(c, err, errorStatus)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// ListMessages godoc
+// @Summary 加载历史消息
+// @Description 按游标分页加载会话中更早的消息，返回结果按时间正序排列
+// @Tags 聊天
+// @Produce json
+// @Param id path string true "会话ID"
+// @Param before query int false "游标，加载historyId小于该值的消息"
+// @Param limit query int false "每页条数，默认20"
+// @Success 200 {object} vo.MessagePage
+// @Router /chat/conversations/{id}/messages [get]
+func (cc *ChatController) ListMessages(c *gin.Context) {
+	var uri dto.ConversationURI
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var req dto.HistoryRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	response, err := cc.chatService.ListMessages(utils.GetUserID(c), uri.ConversationID, req.Before, req.Limit)
+	if err != nil {
+		utils.RespondError(c, err, errorStatus)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// ListReads godoc
+// @Summary 会话已读位置
+// @Description 返回会话中每个参与者已读到的historyId，用于展示"已读"状态
+// @Tags 聊天
+// @Produce json
+// @Param id path string true "会话ID"
+// @Success 200 {array} vo.ReadMark
+// @Router /chat/conversations/{id}/reads [get]
+func (cc *ChatController) ListReads(c *gin.Context) {
+	var uri dto.ConversationURI
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	response, err := cc.chatService.ListReads(utils.GetUserID(c), uri.ConversationID)
+	if err != nil {
+		utils.RespondError(c, err, errorStatus)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// SyncMessages godoc
+// @Summary 同步新消息
+// @Description 返回所有会话中historyId大于after的最新消息，用于换机或重连后补齐消息
+// @Tags 聊天
+// @Produce json
+// @Param after query int false "客户端已有的最大historyId"
+// @Param before query int false "上一次同步返回的nextCursor，hasMore为true时继续同步"
+// @Param limit query int false "最多返回条数，默认200"
+// @Success 200 {object} vo.SyncResult
+// @Router /chat/sync [get]
+func (cc *ChatController) SyncMessages(c *gin.Context) {
+	var req dto.SyncRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	response, err := cc.chatService.SyncMessages(utils.GetUserID(c), req.After, req.Before, req.Limit)
+	if err != nil {
+		utils.RespondError(c, err, errorStatus)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// errorStatus 业务错误对应的HTTP状态码
+var errorStatus = map[error]int{
+	service.ErrInvalidConversation: http.StatusBadRequest,
+	service.ErrInvalidReadPosition: http.StatusBadRequest,
+	service.ErrNotParticipant:      http.StatusForbidden,
+}
@@ -0,0 +1,19 @@
+package dto
+
+// ConversationURI 路径中的会话ID
+type ConversationURI struct {
+	ConversationID string `uri:"id" binding:"required,max=160"`
+}
+
+// HistoryRequest 分页加载历史消息请求参数
+type HistoryRequest struct {
+	Before uint64 `form:"before"`                                  // 游标，加载ID小于该值的消息，为空时从最新一条开始
+	Limit  int    `form:"limit" binding:"omitempty,min=1,max=100"` // 每页条数，默认20
+}
+
+// SyncRequest 同步新消息请求参数
+type SyncRequest struct {
+	After  uint64 `form:"after"`                                   // 客户端已有的最大historyId
+	Before uint64 `form:"before"`                                  // 上一次同步返回的nextCursor，首次同步不传
+	Limit  int    `form:"limit" binding:"omitempty,min=1,max=500"` // 最多返回条数，默认200
+}
@@ -0,0 +1,27 @@
+package chat
+
+import (
+	"campus2/app/chat/controller"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ChatApp struct {
+	chatController *controller.ChatController
+}
+
+func NewChatApp() *ChatApp {
+	return &ChatApp{
+		chatController: controller.NewChatController(),
+	}
+}
+
+func (a *ChatApp) InitChatRouter(private *gin.RouterGroup, public *gin.RouterGroup) {
+	privateGroup := private.Group("chat")
+	{
+		privateGroup.GET("conversations", a.chatController.ListConversations)
+		privateGroup.GET("conversations/:id/messages", a.chatController.ListMessages)
+		privateGroup.GET("conversations/:id/reads", a.chatController.ListReads)
+		privateGroup.GET("sync", a.chatController.SyncMessages)
+	}
+}
@@ -0,0 +1,128 @@
+package model
+
+import (
+	"campus2/pkg/global"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 会话类型
+const (
+	ConversationTypeSingle = "single" // 单聊
+	ConversationTypeRoom   = "room"   // 群聊
+)
+
+// ConversationModel 会话，单聊ID为 single:{较小的用户ID}:{较大的用户ID}，群聊ID为 room:{房间ID}
+type ConversationModel struct {
+	ID        string    `gorm:"primaryKey;size:160"`
+	Type      string    `gorm:"size:16;not null"`
+	LastMsgID uint64    `gorm:"not null;default:0"`
+	LastMsgAt time.Time `gorm:"index"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// ConversationMemberModel 单聊会话的参与者，群聊成员以房间成员为准
+type ConversationMemberModel struct {
+	ID             uint   `gorm:"primarykey"`
+	ConversationID string `gorm:"size:160;not null;uniqueIndex:idx_conv_user"`
+	UserID         string `gorm:"size:64;not null;uniqueIndex:idx_conv_user;index"`
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+// ChatMessageModel 聊天消息，自增ID同时作为分页和同步的游标
+type ChatMessageModel struct {
+	ID             uint64 `gorm:"primaryKey;autoIncrement;index:idx_conv_id,priority:2"`
+	MsgID          string `gorm:"size:64;not null;uniqueIndex"` // 服务端消息ID
+	ConversationID string `gorm:"size:160;not null;index:idx_conv_id,priority:1"`
+	FromID         string `gorm:"size:64;not null"`
+	ToID           string `gorm:"size:64"`
+	Content        string `gorm:"type:text"` // 消息内容(JSON)
+	Extra          string `gorm:"type:text"` // 额外信息(JSON)
+	CreatedAt      time.Time
+}
+
+// Save 保存消息并更新会话，单聊时同时登记双方为会话参与者
+func (m *ChatMessageModel) Save(conversationType string, participants []string) error {
+	return global.GVA_DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(m).Error; err != nil {
+			return err
+		}
+		conversation := ConversationModel{
+			ID:        m.ConversationID,
+			Type:      conversationType,
+			LastMsgID: m.ID,
+			LastMsgAt: m.CreatedAt,
+		}
+		if err := tx.Clauses(clause.OnConflict{
+			DoUpdates: clause.AssignmentColumns([]string{"last_msg_id", "last_msg_at", "updated_at"}),
+		}).Create(&conversation).Error; err != nil {
+			return err
+		}
+		if len(participants) == 0 {
+			return nil
+		}
+		members := make([]ConversationMemberModel, 0, len(participants))
+		for _, userID := range participants {
+			members = append(members, ConversationMemberModel{ConversationID: m.ConversationID, UserID: userID})
+		}
+		return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&members).Error
+	})
+}
+
+// ListMessagesBefore 按游标倒序查询会话中ID小于before的消息，before为0时从最新一条开始
+func ListMessagesBefore(conversationID string, before uint64, limit int) ([]ChatMessageModel, error) {
+	var messages []ChatMessageModel
+	db := global.GVA_DB.Where("conversation_id = ?", conversationID)
+	if before > 0 {
+		db = db.Where("id < ?", before)
+	}
+	err := db.Order("id DESC").Limit(limit).Find(&messages).Error
+	return messages, err
+}
+
+// ListMessagesAfter 倒序查询多个会话中ID大于after的最新消息，before大于0时只查询ID小于before的消息
+func ListMessagesAfter(conversationIDs []string, after, before uint64, limit int) ([]ChatMessageModel, error) {
+	var messages []ChatMessageModel
+	if len(conversationIDs) == 0 {
+		return messages, nil
+	}
+	db := global.GVA_DB.Where("conversation_id IN ? AND id > ?", conversationIDs, after)
+	if before > 0 {
+		db = db.Where("id < ?", before)
+	}
+	err := db.
+		Order("id DESC").
+		Limit(limit).
+		Find(&messages).Error
+	return messages, err
+}
+
+// IsConversationMember 检查用户是否为单聊会话的参与者
+func IsConversationMember(conversationID, userID string) (bool, error) {
+	var count int64
+	err := global.GVA_DB.Model(&ConversationMemberModel{}).
+		Where("conversation_id = ? AND user_id = ?", conversationID, userID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// ListUserConversations 按最近消息时间倒序查询会话
+func ListUserConversations(conversationIDs []string) ([]ConversationModel, error) {
+	var conversations []ConversationModel
+	if len(conversationIDs) == 0 {
+		return conversations, nil
+	}
+	err := global.GVA_DB.Where("id IN ?", conversationIDs).Order("last_msg_at DESC").Find(&conversations).Error
+	return conversations, err
+}
+
+// ListSingleConversationIDs 查询用户参与的所有单聊会话ID
+func ListSingleConversationIDs(userID string) ([]string, error) {
+	var ids []string
+	err := global.GVA_DB.Model(&ConversationMemberModel{}).Where("user_id = ?", userID).Pluck("conversation_id", &ids).Error
+	return ids, err
+}
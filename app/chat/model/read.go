@@ -0,0 +1,103 @@
+package model
+
+import (
+	"campus2/pkg/global"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ConversationReadModel 用户在会话中的已读位置，LastReadID为已读到的最大historyId，只增不减
+type ConversationReadModel struct {
+	ID             uint      `gorm:"primarykey"`
+	ConversationID string    `gorm:"size:160;not null;uniqueIndex:idx_read_conv_user"`
+	UserID         string    `gorm:"size:64;not null;uniqueIndex:idx_read_conv_user;index"`
+	LastReadID     uint64    `gorm:"not null;default:0"`
+	ReadAt         time.Time // 已读位置最近一次前进的时间
+}
+
+// AdvanceRead 将用户在会话中的已读位置前进到historyID，historyID不大于当前位置时不做修改。
+// 返回最新的已读位置以及本次是否发生了前进。
+// 先以ON CONFLICT DO NOTHING插入，记录已存在时再加锁读取并前进，并发的首次已读不会因唯一索引冲突而失败
+func AdvanceRead(conversationID, userID string, historyID uint64) (*ConversationReadModel, bool, error) {
+	var read ConversationReadModel
+	advanced := false
+	err := global.GVA_DB.Transaction(func(tx *gorm.DB) error {
+		created := ConversationReadModel{
+			ConversationID: conversationID,
+			UserID:         userID,
+			LastReadID:     historyID,
+			ReadAt:         time.Now(),
+		}
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&created)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected > 0 {
+			read = created
+			advanced = true
+			return nil
+		}
+
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("conversation_id = ? AND user_id = ?", conversationID, userID).
+			First(&read).Error; err != nil {
+			return err
+		}
+		if historyID <= read.LastReadID {
+			return nil
+		}
+		read.LastReadID = historyID
+		read.ReadAt = time.Now()
+		advanced = true
+		return tx.Model(&read).Updates(map[string]interface{}{
+			"last_read_id": read.LastReadID,
+			"read_at":      read.ReadAt,
+		}).Error
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return &read, advanced, nil
+}
+
+// ListReads 查询会话中所有参与者的已读位置
+func ListReads(conversationID string) ([]ConversationReadModel, error) {
+	var reads []ConversationReadModel
+	err := global.GVA_DB.Where("conversation_id = ?", conversationID).Find(&reads).Error
+	return reads, err
+}
+
+// ListUserReads 查询用户在多个会话中的已读位置 map[会话ID]已读historyId
+func ListUserReads(userID string, conversationIDs []string) (map[string]uint64, error) {
+	result := make(map[string]uint64, len(conversationIDs))
+	if len(conversationIDs) == 0 {
+		return result, nil
+	}
+	var reads []ConversationReadModel
+	err := global.GVA_DB.Where("user_id = ? AND conversation_id IN ?", userID, conversationIDs).Find(&reads).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, read := range reads {
+		result[read.ConversationID] = read.LastReadID
+	}
+	return result, nil
+}
+
+// FindConversation 根据ID查询会话
+func FindConversation(conversationID string) (*ConversationModel, error) {
+	var conversation ConversationModel
+	if err := global.GVA_DB.Where("id = ?", conversationID).First(&conversation).Error; err != nil {
+		return nil, err
+	}
+	return &conversation, nil
+}
+
+// ListConversationMemberIDs 查询单聊会话的参与者
+func ListConversationMemberIDs(conversationID string) ([]string, error) {
+	var ids []string
+	err := global.GVA_DB.Model(&ConversationMemberModel{}).Where("conversation_id = ?", conversationID).Pluck("user_id", &ids).Error
+	return ids, err
+}
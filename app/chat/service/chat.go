@@ -0,0 +1,298 @@
+package service
+
+import (
+	"campus2/app/chat/model"
+	"campus2/app/chat/vo"
+	roomservice "campus2/app/room/service"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	defaultHistoryLimit = 20  // 历史消息默认每页条数
+	defaultSyncLimit    = 200 // 同步新消息默认条数
+)
+
+var (
+	ErrNotParticipant      = errors.New("不是会话参与者")
+	ErrInvalidConversation = errors.New("会话ID格式错误")
+	ErrInvalidReadPosition = errors.New("已读位置无效")
+)
+
+type ChatService struct {
+	roomService *roomservice.RoomService
+}
+
+func NewChatService() *ChatService {
+	return &ChatService{
+		roomService: roomservice.NewRoomService(),
+	}
+}
+
+// ConversationID 计算消息所属的会话ID，群聊按房间，单聊按双方用户ID排序拼接
+func ConversationID(from, to, roomID string) string {
+	if roomID != "" {
+		return model.ConversationTypeRoom + ":" + roomID
+	}
+	if from > to {
+		from, to = to, from
+	}
+	return model.ConversationTypeSingle + ":" + from + ":" + to
+}
+
+// SaveMessage 持久化一条聊天消息，返回的historyId可作为同步游标
+func (s *ChatService) SaveMessage(msgID, from, to, roomID string, content, extra interface{}, createdAt time.Time) (*vo.ChatMessage, error) {
+	contentData, err := json.Marshal(content)
+	if err != nil {
+		return nil, err
+	}
+	extraData, err := json.Marshal(extra)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := &model.ChatMessageModel{
+		MsgID:          msgID,
+		ConversationID: ConversationID(from, to, roomID),
+		FromID:         from,
+		ToID:           to,
+		Content:        string(contentData),
+		Extra:          string(extraData),
+		CreatedAt:      createdAt,
+	}
+	conversationType := model.ConversationTypeRoom
+	var participants []string
+	if roomID == "" {
+		conversationType = model.ConversationTypeSingle
+		participants = []string{from, to}
+	}
+	if err := msg.Save(conversationType, participants); err != nil {
+		return nil, err
+	}
+	result := toMessageVO(msg)
+	return &result, nil
+}
+
+// ListMessages 按游标分页加载会话中更早的消息
+func (s *ChatService) ListMessages(userID, conversationID string, before uint64, limit int) (*vo.MessagePage, error) {
+	if err := s.checkParticipant(userID, conversationID); err != nil {
+		return nil, err
+	}
+	if limit <= 0 {
+		limit = defaultHistoryLimit
+	}
+
+	// 多查一条用于判断是否还有更早的消息
+	messages, err := model.ListMessagesBefore(conversationID, before, limit+1)
+	if err != nil {
+		return nil, err
+	}
+	page := &vo.MessagePage{}
+	if len(messages) > limit {
+		messages = messages[:limit]
+		page.HasMore = true
+		page.NextCursor = messages[len(messages)-1].ID
+	}
+	page.Messages = reverseToVO(messages)
+	return page, nil
+}
+
+// SyncMessages 同步用户所有会话中historyId大于after的最新消息，
+// 新消息过多时只返回最新的limit条并标记hasMore，客户端以nextCursor作为before继续同步更早的新消息
+func (s *ChatService) SyncMessages(userID string, after, before uint64, limit int) (*vo.SyncResult, error) {
+	if limit <= 0 {
+		limit = defaultSyncLimit
+	}
+	conversationIDs, err := s.userConversationIDs(userID)
+	if err != nil {
+		return nil, err
+	}
+	messages, err := model.ListMessagesAfter(conversationIDs, after, before, limit+1)
+	if err != nil {
+		return nil, err
+	}
+	result := &vo.SyncResult{}
+	if len(messages) > limit {
+		messages = messages[:limit]
+		result.HasMore = true
+		result.NextCursor = messages[len(messages)-1].ID
+	}
+	result.Messages = reverseToVO(messages)
+	return result, nil
+}
+
+// ListConversations 查询用户的会话列表，按最近消息时间倒序
+func (s *ChatService) ListConversations(userID string) ([]vo.Conversation, error) {
+	conversationIDs, err := s.userConversationIDs(userID)
+	if err != nil {
+		return nil, err
+	}
+	conversations, err := model.ListUserConversations(conversationIDs)
+	if err != nil {
+		return nil, err
+	}
+	reads, err := model.ListUserReads(userID, conversationIDs)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]vo.Conversation, 0, len(conversations))
+	for _, c := range conversations {
+		result = append(result, vo.Conversation{
+			ID:         c.ID,
+			Type:       c.Type,
+			LastMsgID:  c.LastMsgID,
+			LastMsgAt:  c.LastMsgAt,
+			LastReadID: reads[c.ID],
+		})
+	}
+	return result, nil
+}
+
+// MarkRead 将用户在会话中的已读位置前进到historyID，超过会话最新消息时按最新消息计算。
+// 返回最新的已读位置以及本次是否发生了前进，未前进时无需通知其他参与者
+func (s *ChatService) MarkRead(userID, conversationID string, historyID uint64) (*vo.ReadMark, bool, error) {
+	if historyID == 0 {
+		return nil, false, ErrInvalidReadPosition
+	}
+	if err := s.checkParticipant(userID, conversationID); err != nil {
+		return nil, false, err
+	}
+	conversation, err := model.FindConversation(conversationID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, false, ErrInvalidReadPosition
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if historyID > conversation.LastMsgID {
+		historyID = conversation.LastMsgID
+	}
+
+	read, advanced, err := model.AdvanceRead(conversationID, userID, historyID)
+	if err != nil {
+		return nil, false, err
+	}
+	mark := toReadMarkVO(read)
+	return &mark, advanced, nil
+}
+
+// ListReads 查询会话中所有参与者的已读位置
+func (s *ChatService) ListReads(userID, conversationID string) ([]vo.ReadMark, error) {
+	if err := s.checkParticipant(userID, conversationID); err != nil {
+		return nil, err
+	}
+	reads, err := model.ListReads(conversationID)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]vo.ReadMark, 0, len(reads))
+	for i := range reads {
+		result = append(result, toReadMarkVO(&reads[i]))
+	}
+	return result, nil
+}
+
+// Participants 查询会话的所有参与者，群聊为房间成员
+func (s *ChatService) Participants(conversationID string) ([]string, error) {
+	roomID, isRoom, err := parseRoomConversation(conversationID)
+	if err != nil {
+		return nil, err
+	}
+	if isRoom {
+		return s.roomService.MemberIDs(roomID)
+	}
+	return model.ListConversationMemberIDs(conversationID)
+}
+
+// parseRoomConversation 解析群聊会话ID中的房间ID，单聊会话返回false
+func parseRoomConversation(conversationID string) (uint, bool, error) {
+	if strings.HasPrefix(conversationID, model.ConversationTypeRoom+":") {
+		roomID, err := strconv.ParseUint(strings.TrimPrefix(conversationID, model.ConversationTypeRoom+":"), 10, 64)
+		if err != nil {
+			return 0, false, ErrInvalidConversation
+		}
+		return uint(roomID), true, nil
+	}
+	if !strings.HasPrefix(conversationID, model.ConversationTypeSingle+":") {
+		return 0, false, ErrInvalidConversation
+	}
+	return 0, false, nil
+}
+
+// checkParticipant 检查用户是否可以访问会话
+func (s *ChatService) checkParticipant(userID, conversationID string) error {
+	roomID, isRoom, err := parseRoomConversation(conversationID)
+	if err != nil {
+		return err
+	}
+	if isRoom {
+		ok, err := s.roomService.IsMember(roomID, userID)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return ErrNotParticipant
+		}
+		return nil
+	}
+	ok, err := model.IsConversationMember(conversationID, userID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrNotParticipant
+	}
+	return nil
+}
+
+// userConversationIDs 用户参与的单聊会话以及所在房间对应的群聊会话
+func (s *ChatService) userConversationIDs(userID string) ([]string, error) {
+	ids, err := model.ListSingleConversationIDs(userID)
+	if err != nil {
+		return nil, err
+	}
+	rooms, err := s.roomService.ListUserRooms(userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, room := range rooms {
+		ids = append(ids, ConversationID("", "", strconv.FormatUint(uint64(room.ID), 10)))
+	}
+	return ids, nil
+}
+
+// reverseToVO 将倒序查询的结果转换为按时间正序排列
+func reverseToVO(messages []model.ChatMessageModel) []vo.ChatMessage {
+	result := make([]vo.ChatMessage, len(messages))
+	for i := range messages {
+		result[len(messages)-1-i] = toMessageVO(&messages[i])
+	}
+	return result
+}
+
+func toMessageVO(m *model.ChatMessageModel) vo.ChatMessage {
+	return vo.ChatMessage{
+		HistoryID:      m.ID,
+		ID:             m.MsgID,
+		ConversationID: m.ConversationID,
+		From:           m.FromID,
+		To:             m.ToID,
+		Content:        json.RawMessage(m.Content),
+		Extra:          json.RawMessage(m.Extra),
+		CreatedAt:      m.CreatedAt,
+	}
+}
+
+func toReadMarkVO(r *model.ConversationReadModel) vo.ReadMark {
+	return vo.ReadMark{
+		ConversationID: r.ConversationID,
+		UserID:         r.UserID,
+		HistoryID:      r.LastReadID,
+		ReadAt:         r.ReadAt,
+	}
+}
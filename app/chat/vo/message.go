@@ -0,0 +1,47 @@
+package vo
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type ChatMessage struct {
+	HistoryID      uint64          `json:"historyId"`      // 历史消息游标
+	ID             string          `json:"id"`             // 服务端消息ID
+	ConversationID string          `json:"conversationId"` // 会话ID
+	From           string          `json:"from"`
+	To             string          `json:"to,omitempty"`
+	Content        json.RawMessage `json:"content"`
+	Extra          json.RawMessage `json:"extra,omitempty"`
+	CreatedAt      time.Time       `json:"createdAt"`
+}
+
+// MessagePage 历史消息分页结果，消息按时间正序排列
+type MessagePage struct {
+	Messages   []ChatMessage `json:"messages"`
+	NextCursor uint64        `json:"nextCursor"` // 继续加载更早消息时传入的before，没有更多时为0
+	HasMore    bool          `json:"hasMore"`
+}
+
+// SyncResult 新消息同步结果，消息按时间正序排列
+type SyncResult struct {
+	Messages   []ChatMessage `json:"messages"`
+	NextCursor uint64        `json:"nextCursor"` // 继续同步更早的新消息时传入的before，没有更多时为0
+	HasMore    bool          `json:"hasMore"`    // 为true时说明还有更早的新消息未返回
+}
+
+type Conversation struct {
+	ID         string    `json:"id"`
+	Type       string    `json:"type"`
+	LastMsgID  uint64    `json:"lastHistoryId"`
+	LastMsgAt  time.Time `json:"lastMsgAt"`
+	LastReadID uint64    `json:"readHistoryId"` // 当前用户已读到的historyId，小于lastHistoryId时有未读消息
+}
+
+// ReadMark 参与者在会话中的已读位置
+type ReadMark struct {
+	ConversationID string    `json:"conversationId"`
+	UserID         string    `json:"userId"`
+	HistoryID      uint64    `json:"historyId"` // 已读到的最大historyId
+	ReadAt         time.Time `json:"readAt"`
+}
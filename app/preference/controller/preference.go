@@ -0,0 +1,106 @@
+package controller
+
+import (
+	"campus2/app/preference/dto"
+	"campus2/app/preference/service"
+	"campus2/pkg/utils"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type PreferenceController struct {
+	preferenceService *service.PreferenceService
+}
+
+func NewPreferenceController() *PreferenceController {
+	return &PreferenceController{
+		preferenceService: service.NewPreferenceService(),
+	}
+}
+
+// GetPreferences godoc
+// @Summary 查询通知偏好
+// @Tags 通知偏好
+// @Produce json
+// @Success 200 {object} vo.Preferences
+// @Router /preferences [get]
+func (pc *PreferenceController) GetPreferences(c *gin.Context) {
+	response, err := pc.preferenceService.GetPreferences(utils.GetUserID(c))
+	if err != nil {
+		utils.RespondError(c, err, errorStatus)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// SetPreferences godoc
+// @Summary 修改通知偏好
+// @Description 整体替换原有设置：按类型关闭推送、静音会话、设置免打扰时段。被静音的消息不推送，只计入静音统计
+// @Tags 通知偏好
+// @Accept json
+// @Produce json
+// @Param body body dto.PreferencesRequest true "通知偏好"
+// @Success 200 {object} vo.Preferences
+// @Router /preferences [put]
+func (pc *PreferenceController) SetPreferences(c *gin.Context) {
+	var req dto.PreferencesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	response, err := pc.preferenceService.SetPreferences(utils.GetUserID(c), &req)
+	if err != nil {
+		utils.RespondError(c, err, errorStatus)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// GetMuted godoc
+// @Summary 查询静音统计
+// @Description 按类型或会话统计被静音、未推送的消息数，会话的key为conversation:{会话ID}
+// @Tags 通知偏好
+// @Produce json
+// @Success 200 {object} vo.Muted
+// @Router /preferences/muted [get]
+func (pc *PreferenceController) GetMuted(c *gin.Context) {
+	response, err := pc.preferenceService.GetMuted(utils.GetUserID(c))
+	if err != nil {
+		utils.RespondError(c, err, errorStatus)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// ClearMuted godoc
+// @Summary 清除静音统计
+// @Tags 通知偏好
+// @Param fields query string false "逗号分隔的类型或conversation:{会话ID}，为空时全部清除"
+// @Success 204
+// @Router /preferences/muted [delete]
+func (pc *PreferenceController) ClearMuted(c *gin.Context) {
+	var req dto.ClearMutedQuery
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := pc.preferenceService.ClearMuted(utils.GetUserID(c), req.Fields); err != nil {
+		utils.RespondError(c, err, errorStatus)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// errorStatus 业务错误对应的HTTP状态码
+var errorStatus = map[error]int{
+	service.ErrUnknownType:        http.StatusBadRequest,
+	service.ErrInvalidQuietHours:  http.StatusBadRequest,
+	service.ErrPreferenceDisabled: http.StatusServiceUnavailable,
+}
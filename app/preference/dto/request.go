@@ -0,0 +1,20 @@
+package dto
+
+// PreferencesRequest 修改通知偏好请求参数，整体替换原有设置
+type PreferencesRequest struct {
+	Types              map[string]bool    `json:"types"`                                                      // 类型: like/collect/comment/mention/system
+	MutedConversations []string           `json:"mutedConversations" binding:"max=500,dive,required,max=160"` // 静音的会话ID或房间ID，长度与会话ID一致
+	QuietHours         *QuietHoursRequest `json:"quietHours"`                                                 // 为空表示关闭免打扰
+}
+
+// QuietHoursRequest 免打扰时段
+type QuietHoursRequest struct {
+	Start    string `json:"start" binding:"required"`    // HH:MM
+	End      string `json:"end" binding:"required"`      // HH:MM
+	TimeZone string `json:"timeZone" binding:"required"` // IANA时区，如Asia/Shanghai
+}
+
+// ClearMutedQuery 清除静音统计请求参数
+type ClearMutedQuery struct {
+	Fields string `form:"fields"` // 逗号分隔的类型或conversation:{会话ID}，为空时全部清除
+}
@@ -0,0 +1,32 @@
+package dto
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin/binding"
+)
+
+func TestPreferencesRequestMutedConversations(t *testing.T) {
+	// 单聊会话ID为single:{较小的用户ID}:{较大的用户ID}，用户ID最长64个字符
+	longest := "single:" + strings.Repeat("a", 64) + ":" + strings.Repeat("b", 64)
+	tests := []struct {
+		name  string
+		ids   []string
+		valid bool
+	}{
+		{"单聊会话", []string{"single:1001:1002"}, true},
+		{"最长的单聊会话", []string{longest}, true},
+		{"群聊会话和房间ID", []string{"room:42", "42"}, true},
+		{"空ID", []string{""}, false},
+		{"超过会话ID长度", []string{strings.Repeat("x", 161)}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := binding.Validator.ValidateStruct(&PreferencesRequest{MutedConversations: tt.ids})
+			if (err == nil) != tt.valid {
+				t.Fatalf("校验结果应为%v，实际错误为%v", tt.valid, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,27 @@
+package preference
+
+import (
+	"campus2/app/preference/controller"
+
+	"github.com/gin-gonic/gin"
+)
+
+type PreferenceApp struct {
+	preferenceController *controller.PreferenceController
+}
+
+func NewPreferenceApp() *PreferenceApp {
+	return &PreferenceApp{
+		preferenceController: controller.NewPreferenceController(),
+	}
+}
+
+func (a *PreferenceApp) InitPreferenceRouter(private *gin.RouterGroup, public *gin.RouterGroup) {
+	privateGroup := private.Group("preferences")
+	{
+		privateGroup.GET("", a.preferenceController.GetPreferences)
+		privateGroup.PUT("", a.preferenceController.SetPreferences)
+		privateGroup.GET("muted", a.preferenceController.GetMuted)
+		privateGroup.DELETE("muted", a.preferenceController.ClearMuted)
+	}
+}
@@ -0,0 +1,146 @@
+package model
+
+import (
+	wsmodel "campus2/app/websocket/model"
+	"campus2/pkg/global"
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	PreferenceKey  = "notify:prefs"  // Hash表存储用户的通知偏好 field=userID
+	MutedKeyPrefix = "notify:muted:" // Hash表按类型或会话统计被静音的消息数 notify:muted:{userID}
+)
+
+// ConversationField 会话在静音统计中的field
+const ConversationField = "conversation:"
+
+// ToggleTypes 可以单独关闭推送的消息类型
+var ToggleTypes = []string{
+	wsmodel.MessageTypeLike,
+	wsmodel.MessageTypeCollect,
+	wsmodel.MessageTypeComment,
+	wsmodel.MessageTypeMention,
+	wsmodel.MessageTypeSystem,
+}
+
+// Preferences 用户的通知偏好，零值表示全部推送
+type Preferences struct {
+	Types              map[string]bool `json:"types,omitempty"`              // false表示关闭该类型的推送，未列出的类型默认开启
+	MutedConversations []string        `json:"mutedConversations,omitempty"` // 静音的会话ID或房间ID
+	QuietHours         *QuietHours     `json:"quietHours,omitempty"`         // 免打扰时段
+}
+
+// QuietHours 免打扰时段，结束时间早于开始时间表示跨天，如22:00-07:30
+type QuietHours struct {
+	Start    string `json:"start"`    // 开始时间 HH:MM
+	End      string `json:"end"`      // 结束时间 HH:MM
+	TimeZone string `json:"timeZone"` // IANA时区，如Asia/Shanghai
+}
+
+// Muted 消息是否被静音。关闭了推送的类型和静音的会话始终静音，
+// 免打扰时段内静音互动通知(点赞、收藏、评论、@和系统消息)，聊天消息只受会话静音影响
+func (p *Preferences) Muted(notifyType, conversationID, roomID string, now time.Time) bool {
+	if notifyType != "" {
+		if enabled, ok := p.Types[notifyType]; ok && !enabled {
+			return true
+		}
+		if p.QuietHours != nil && p.QuietHours.Contains(now) {
+			return true
+		}
+		return false
+	}
+	for _, id := range p.MutedConversations {
+		if id != "" && (id == conversationID || id == roomID) {
+			return true
+		}
+	}
+	return false
+}
+
+// Contains 时间是否处于免打扰时段，配置无效时返回false
+func (q *QuietHours) Contains(now time.Time) bool {
+	loc, err := time.LoadLocation(q.TimeZone)
+	if err != nil {
+		return false
+	}
+	start, ok1 := ParseClock(q.Start)
+	end, ok2 := ParseClock(q.End)
+	if !ok1 || !ok2 || start == end {
+		return false
+	}
+	local := now.In(loc)
+	minute := local.Hour()*60 + local.Minute()
+	if start < end {
+		return minute >= start && minute < end
+	}
+	return minute >= start || minute < end
+}
+
+// ParseClock 解析HH:MM，返回当天的分钟数
+func ParseClock(value string) (int, bool) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, false
+	}
+	return t.Hour()*60 + t.Minute(), true
+}
+
+// GetPreferences 查询用户的通知偏好，未设置时返回零值
+func GetPreferences(userID string) (*Preferences, error) {
+	data, err := global.GVA_REDIS.HGet(context.Background(), PreferenceKey, userID).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return &Preferences{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var p Preferences
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// SavePreferences 保存用户的通知偏好
+func SavePreferences(userID string, p *Preferences) error {
+	data, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	return global.GVA_REDIS.HSet(context.Background(), PreferenceKey, userID, data).Err()
+}
+
+// IncrMuted 累计被静音的消息数
+func IncrMuted(userID, field string, n int64) error {
+	return global.GVA_REDIS.HIncrBy(context.Background(), MutedKeyPrefix+userID, field, n).Err()
+}
+
+// GetMuted 查询被静音的消息数 map[类型或conversation:{会话ID}]数量
+func GetMuted(userID string) (map[string]int64, error) {
+	values, err := global.GVA_REDIS.HGetAll(context.Background(), MutedKeyPrefix+userID).Result()
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]int64, len(values))
+	for field, value := range values {
+		if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+			result[field] = n
+		}
+	}
+	return result, nil
+}
+
+// ClearMuted 清除被静音的消息数，fields为空时全部清除
+func ClearMuted(userID string, fields ...string) error {
+	ctx := context.Background()
+	if len(fields) == 0 {
+		return global.GVA_REDIS.Del(ctx, MutedKeyPrefix+userID).Err()
+	}
+	return global.GVA_REDIS.HDel(ctx, MutedKeyPrefix+userID, fields...).Err()
+}
@@ -0,0 +1,103 @@
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseClock(t *testing.T) {
+	tests := []struct {
+		value  string
+		minute int
+		ok     bool
+	}{
+		{"00:00", 0, true},
+		{"07:30", 450, true},
+		{"23:59", 1439, true},
+		{"24:00", 0, false},
+		{"7:30", 450, true}, // 小时可以省略前导0
+		{"12:60", 0, false},
+		{"", 0, false},
+	}
+	for _, tt := range tests {
+		minute, ok := ParseClock(tt.value)
+		if minute != tt.minute || ok != tt.ok {
+			t.Errorf("%q应解析为%d %v，实际为%d %v", tt.value, tt.minute, tt.ok, minute, ok)
+		}
+	}
+}
+
+func TestQuietHoursContains(t *testing.T) {
+	shanghai := time.FixedZone("CST", 8*3600)
+	at := func(hour, minute int) time.Time {
+		return time.Date(2026, 10, 17, hour, minute, 0, 0, shanghai)
+	}
+	overnight := QuietHours{Start: "22:00", End: "07:30", TimeZone: "Asia/Shanghai"}
+	daytime := QuietHours{Start: "12:00", End: "14:00", TimeZone: "Asia/Shanghai"}
+	tests := []struct {
+		name  string
+		quiet QuietHours
+		now   time.Time
+		want  bool
+	}{
+		{"跨天-开始前", overnight, at(21, 59), false},
+		{"跨天-开始时刻", overnight, at(22, 0), true},
+		{"跨天-午夜前", overnight, at(23, 59), true},
+		{"跨天-午夜", overnight, at(0, 0), true},
+		{"跨天-次日清晨", overnight, at(7, 29), true},
+		{"跨天-结束时刻", overnight, at(7, 30), false},
+		{"跨天-白天", overnight, at(12, 0), false},
+		{"当天-时段内", daytime, at(13, 0), true},
+		{"当天-结束时刻", daytime, at(14, 0), false},
+		{"当天-开始前", daytime, at(11, 59), false},
+		{"按用户时区换算", QuietHours{Start: "22:00", End: "07:30", TimeZone: "UTC"}, at(23, 0), false}, // UTC 15:00
+		{"UTC时区跨天", QuietHours{Start: "22:00", End: "07:30", TimeZone: "UTC"}, at(7, 0), true},   // UTC 23:00
+		{"开始等于结束", QuietHours{Start: "08:00", End: "08:00", TimeZone: "UTC"}, at(16, 0), false},
+		{"无效时间", QuietHours{Start: "8点", End: "07:30", TimeZone: "UTC"}, at(16, 0), false},
+		{"无效时区", QuietHours{Start: "22:00", End: "07:30", TimeZone: "Mars/Base"}, at(23, 0), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.quiet.Contains(tt.now); got != tt.want {
+				t.Fatalf("%+v在%v是否免打扰应为%v，实际为%v", tt.quiet, tt.now, tt.want, got)
+			}
+		})
+	}
+}
+
+func TestPreferencesMuted(t *testing.T) {
+	night := time.Date(2026, 10, 17, 23, 0, 0, 0, time.UTC)
+	noon := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+	prefs := &Preferences{
+		Types:              map[string]bool{"like": false, "comment": true},
+		MutedConversations: []string{"single:u1:u2", "7"},
+		QuietHours:         &QuietHours{Start: "22:00", End: "07:30", TimeZone: "UTC"},
+	}
+	tests := []struct {
+		name           string
+		notifyType     string
+		conversationID string
+		roomID         string
+		now            time.Time
+		want           bool
+	}{
+		{"关闭的类型", "like", "", "", noon, true},
+		{"开启的类型", "comment", "", "", noon, false},
+		{"未列出的类型默认开启", "mention", "", "", noon, false},
+		{"免打扰时段内的通知", "comment", "", "", night, true},
+		{"静音的会话", "", "single:u1:u2", "", noon, true},
+		{"静音的房间", "", "room:7", "7", noon, true},
+		{"未静音的会话", "", "single:u1:u3", "", noon, false},
+		{"聊天消息不受免打扰时段影响", "", "single:u1:u3", "", night, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := prefs.Muted(tt.notifyType, tt.conversationID, tt.roomID, tt.now); got != tt.want {
+				t.Fatalf("是否静音应为%v，实际为%v", tt.want, got)
+			}
+		})
+	}
+	if (&Preferences{}).Muted("like", "", "", night) {
+		t.Fatal("未设置偏好时不应静音")
+	}
+}
@@ -0,0 +1,140 @@
+package service
+
+import (
+	"campus2/app/preference/dto"
+	"campus2/app/preference/model"
+	"campus2/app/preference/vo"
+	"campus2/pkg/global"
+	"errors"
+	"strings"
+	"time"
+	_ "time/tzdata" // 容器中可能没有时区数据
+)
+
+var (
+	ErrPreferenceDisabled = errors.New("未启用Redis，无法设置通知偏好")
+	ErrUnknownType        = errors.New("不支持单独关闭的消息类型")
+	ErrInvalidQuietHours  = errors.New("免打扰时段无效，时间格式为HH:MM，时区为IANA名称")
+)
+
+type PreferenceService struct{}
+
+func NewPreferenceService() *PreferenceService {
+	return &PreferenceService{}
+}
+
+// GetPreferences 查询用户的通知偏好，未设置的类型显示为开启
+func (s *PreferenceService) GetPreferences(userID string) (*vo.Preferences, error) {
+	if global.GVA_REDIS == nil {
+		return nil, ErrPreferenceDisabled
+	}
+	p, err := model.GetPreferences(userID)
+	if err != nil {
+		return nil, err
+	}
+	return toVO(p), nil
+}
+
+// SetPreferences 整体替换用户的通知偏好
+func (s *PreferenceService) SetPreferences(userID string, req *dto.PreferencesRequest) (*vo.Preferences, error) {
+	if global.GVA_REDIS == nil {
+		return nil, ErrPreferenceDisabled
+	}
+	p := &model.Preferences{}
+	for notifyType, enabled := range req.Types {
+		if !isToggleType(notifyType) {
+			return nil, ErrUnknownType
+		}
+		if !enabled { // 只保存关闭的类型，开启是默认值
+			if p.Types == nil {
+				p.Types = make(map[string]bool)
+			}
+			p.Types[notifyType] = false
+		}
+	}
+	p.MutedConversations = uniqueIDs(req.MutedConversations)
+	if q := req.QuietHours; q != nil {
+		_, ok1 := model.ParseClock(q.Start)
+		_, ok2 := model.ParseClock(q.End)
+		if _, err := time.LoadLocation(q.TimeZone); err != nil || !ok1 || !ok2 || q.Start == q.End {
+			return nil, ErrInvalidQuietHours
+		}
+		p.QuietHours = &model.QuietHours{Start: q.Start, End: q.End, TimeZone: q.TimeZone}
+	}
+
+	if err := model.SavePreferences(userID, p); err != nil {
+		return nil, err
+	}
+	return toVO(p), nil
+}
+
+// GetMuted 查询被静音、未推送的消息数
+func (s *PreferenceService) GetMuted(userID string) (*vo.Muted, error) {
+	if global.GVA_REDIS == nil {
+		return nil, ErrPreferenceDisabled
+	}
+	counts, err := model.GetMuted(userID)
+	if err != nil {
+		return nil, err
+	}
+	muted := &vo.Muted{Counts: counts}
+	for _, n := range counts {
+		muted.Total += n
+	}
+	return muted, nil
+}
+
+// ClearMuted 客户端查看后清除静音统计，fields为空时全部清除
+func (s *PreferenceService) ClearMuted(userID, fields string) error {
+	if global.GVA_REDIS == nil {
+		return ErrPreferenceDisabled
+	}
+	var list []string
+	if fields != "" {
+		list = uniqueIDs(strings.Split(fields, ","))
+	}
+	return model.ClearMuted(userID, list...)
+}
+
+func toVO(p *model.Preferences) *vo.Preferences {
+	result := &vo.Preferences{
+		Types:              make(map[string]bool, len(model.ToggleTypes)),
+		MutedConversations: p.MutedConversations,
+		QuietHours:         p.QuietHours,
+	}
+	for _, notifyType := range model.ToggleTypes {
+		enabled, ok := p.Types[notifyType]
+		result.Types[notifyType] = !ok || enabled
+	}
+	if result.MutedConversations == nil {
+		result.MutedConversations = []string{}
+	}
+	if p.QuietHours != nil {
+		result.QuietNow = p.QuietHours.Contains(time.Now())
+	}
+	return result
+}
+
+func isToggleType(notifyType string) bool {
+	for _, t := range model.ToggleTypes {
+		if t == notifyType {
+			return true
+		}
+	}
+	return false
+}
+
+// uniqueIDs 去掉空值和重复的ID
+func uniqueIDs(ids []string) []string {
+	seen := make(map[string]bool, len(ids))
+	result := make([]string, 0, len(ids))
+	for _, id := range ids {
+		id = strings.TrimSpace(id)
+		if id == "" || seen[id] {
+			continue
+		}
+		seen[id] = true
+		result = append(result, id)
+	}
+	return result
+}
@@ -0,0 +1,17 @@
+package vo
+
+import "campus2/app/preference/model"
+
+// Preferences 用户的通知偏好
+type Preferences struct {
+	Types              map[string]bool   `json:"types"`              // 每种类型是否推送
+	MutedConversations []string          `json:"mutedConversations"` // 静音的会话ID或房间ID
+	QuietHours         *model.QuietHours `json:"quietHours"`         // 免打扰时段，未设置时为null
+	QuietNow           bool              `json:"quietNow"`           // 当前是否处于免打扰时段
+}
+
+// Muted 被静音、未推送的消息数
+type Muted struct {
+	Total  int64            `json:"total"`
+	Counts map[string]int64 `json:"counts"` // map[类型或conversation:{会话ID}]数量
+}
@@ -0,0 +1,91 @@
+package controller
+
+import (
+	"campus2/app/presence/dto"
+	"campus2/app/presence/service"
+	"campus2/pkg/utils"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+type PresenceController struct {
+	presenceService *service.PresenceService
+}
+
+func NewPresenceController() *PresenceController {
+	return &PresenceController{
+		presenceService: service.NewPresenceService(),
+	}
+}
+
+// GetPresences godoc
+// @Summary 查询在线状态
+// @Description 批量查询用户的在线状态，离线用户返回最后在线时间；隐藏了在线状态的用户显示为离线
+// @Tags 在线状态
+// @Produce json
+// @Param user_ids query string true "逗号分隔的用户ID，最多100个"
+// @Success 200 {array} vo.Presence
+// @Router /presence [get]
+func (pc *PresenceController) GetPresences(c *gin.Context) {
+	var req dto.PresenceQuery
+	if err := c.ShouldBindQuery(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	response, err := pc.presenceService.GetPresences(utils.GetUserID(c), strings.Split(req.UserIDs, ","))
+	if err != nil {
+		utils.RespondError(c, err, errorStatus)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// GetPrivacy godoc
+// @Summary 查询在线状态隐私设置
+// @Tags 在线状态
+// @Produce json
+// @Success 200 {object} vo.Privacy
+// @Router /presence/privacy [get]
+func (pc *PresenceController) GetPrivacy(c *gin.Context) {
+	response, err := pc.presenceService.GetPrivacy(utils.GetUserID(c))
+	if err != nil {
+		utils.RespondError(c, err, errorStatus)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// SetPrivacy godoc
+// @Summary 设置在线状态隐私
+// @Description everyone: 所有人可见；nobody: 对所有人显示为离线且不展示最后在线时间
+// @Tags 在线状态
+// @Accept json
+// @Produce json
+// @Param body body dto.PrivacyRequest true "可见范围"
+// @Success 200 {object} vo.Privacy
+// @Router /presence/privacy [put]
+func (pc *PresenceController) SetPrivacy(c *gin.Context) {
+	var req dto.PrivacyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := pc.presenceService.SetPrivacy(utils.GetUserID(c), req.Visibility); err != nil {
+		utils.RespondError(c, err, errorStatus)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"visibility": req.Visibility})
+}
+
+// errorStatus 业务错误对应的HTTP状态码
+var errorStatus = map[error]int{
+	service.ErrTooManyUsers:     http.StatusBadRequest,
+	service.ErrPresenceDisabled: http.StatusServiceUnavailable,
+}
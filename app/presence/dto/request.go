@@ -0,0 +1,11 @@
+package dto
+
+// PresenceQuery 查询在线状态请求参数
+type PresenceQuery struct {
+	UserIDs string `form:"user_ids" binding:"required,max=6500"` // 逗号分隔的用户ID，最多100个
+}
+
+// PrivacyRequest 设置在线状态可见范围请求参数
+type PrivacyRequest struct {
+	Visibility string `json:"visibility" binding:"required,oneof=everyone nobody"`
+}
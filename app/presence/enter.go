@@ -0,0 +1,26 @@
+package presence
+
+import (
+	"campus2/app/presence/controller"
+
+	"github.com/gin-gonic/gin"
+)
+
+type PresenceApp struct {
+	presenceController *controller.PresenceController
+}
+
+func NewPresenceApp() *PresenceApp {
+	return &PresenceApp{
+		presenceController: controller.NewPresenceController(),
+	}
+}
+
+func (a *PresenceApp) InitPresenceRouter(private *gin.RouterGroup, public *gin.RouterGroup) {
+	privateGroup := private.Group("presence")
+	{
+		privateGroup.GET("", a.presenceController.GetPresences)
+		privateGroup.GET("privacy", a.presenceController.GetPrivacy)
+		privateGroup.PUT("privacy", a.presenceController.SetPrivacy)
+	}
+}
@@ -0,0 +1,143 @@
+package model
+
+import (
+	"campus2/pkg/global"
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// 在线状态
+const (
+	StatusOnline  = "online"  // 至少一个设备在线且处于活跃状态
+	StatusIdle    = "idle"    // 所有在线设备都处于空闲状态
+	StatusOffline = "offline" // 没有设备在线
+)
+
+// 在线状态的可见范围
+const (
+	VisibilityEveryone = "everyone" // 所有人可见(默认)
+	VisibilityNobody   = "nobody"   // 对所有人显示为离线，不展示最后在线时间
+)
+
+const (
+	OnlineKey     = "ws:conn:map"      // Hash表存储在线用户最近一次的连接信息
+	LastSeenKey   = "online:last_seen" // Hash表存储用户最后在线时间
+	StatusKey     = "presence:status"  // Hash表存储用户最近一次广播的在线状态
+	VisibilityKey = "presence:privacy" // Hash表存储用户在线状态的可见范围
+	EventChannel  = "ws:presence"      // 在线状态变更事件的广播频道，所有节点订阅
+)
+
+// swapStatusScript 写入用户的在线状态并返回旧状态，离线时删除记录
+var swapStatusScript = redis.NewScript(`
+local old = redis.call('HGET', KEYS[1], ARGV[1])
+if ARGV[2] == 'offline' then
+	redis.call('HDEL', KEYS[1], ARGV[1])
+else
+	redis.call('HSET', KEYS[1], ARGV[1], ARGV[2])
+end
+return old
+`)
+
+// Event 在线状态变更事件
+type Event struct {
+	UserID   string `json:"userId"`
+	Status   string `json:"status"`
+	LastSeen int64  `json:"lastSeen,omitempty"` // 离线时为最后在线时间(秒)
+}
+
+// SwapStatus 写入用户当前的在线状态，返回写入前的状态
+func SwapStatus(userID, status string) (string, error) {
+	old, err := swapStatusScript.Run(context.Background(), global.GVA_REDIS, []string{StatusKey}, userID, status).Text()
+	if errors.Is(err, redis.Nil) {
+		return StatusOffline, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return old, nil
+}
+
+// GetStatuses 批量查询用户最近一次广播的在线状态，没有记录的用户为离线
+func GetStatuses(userIDs []string) (map[string]string, error) {
+	result := make(map[string]string, len(userIDs))
+	if len(userIDs) == 0 {
+		return result, nil
+	}
+	values, err := global.GVA_REDIS.HMGet(context.Background(), StatusKey, userIDs...).Result()
+	if err != nil {
+		return nil, err
+	}
+	for i, userID := range userIDs {
+		status, ok := values[i].(string)
+		if !ok || status == "" {
+			status = StatusOffline
+		}
+		result[userID] = status
+	}
+	return result, nil
+}
+
+// GetLastSeens 批量查询用户最后在线时间，没有记录的用户不在结果中
+func GetLastSeens(userIDs []string) (map[string]time.Time, error) {
+	result := make(map[string]time.Time, len(userIDs))
+	if len(userIDs) == 0 {
+		return result, nil
+	}
+	values, err := global.GVA_REDIS.HMGet(context.Background(), LastSeenKey, userIDs...).Result()
+	if err != nil {
+		return nil, err
+	}
+	for i, userID := range userIDs {
+		value, ok := values[i].(string)
+		if !ok {
+			continue
+		}
+		if ts, err := strconv.ParseInt(value, 10, 64); err == nil {
+			result[userID] = time.Unix(ts, 0)
+		}
+	}
+	return result, nil
+}
+
+// GetVisibilities 批量查询用户在线状态的可见范围，未设置的用户为所有人可见
+func GetVisibilities(userIDs []string) (map[string]string, error) {
+	result := make(map[string]string, len(userIDs))
+	if len(userIDs) == 0 {
+		return result, nil
+	}
+	values, err := global.GVA_REDIS.HMGet(context.Background(), VisibilityKey, userIDs...).Result()
+	if err != nil {
+		return nil, err
+	}
+	for i, userID := range userIDs {
+		visibility, ok := values[i].(string)
+		if !ok || visibility == "" {
+			visibility = VisibilityEveryone
+		}
+		result[userID] = visibility
+	}
+	return result, nil
+}
+
+// SetVisibility 设置用户在线状态的可见范围
+func SetVisibility(userID, visibility string) error {
+	ctx := context.Background()
+	if visibility == VisibilityEveryone {
+		return global.GVA_REDIS.HDel(ctx, VisibilityKey, userID).Err()
+	}
+	return global.GVA_REDIS.HSet(ctx, VisibilityKey, userID, visibility).Err()
+}
+
+// PublishEvent 向所有节点广播在线状态变更
+func PublishEvent(event *Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	return global.GVA_REDIS.Publish(context.Background(), EventChannel, data).Err()
+}
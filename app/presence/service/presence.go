@@ -0,0 +1,130 @@
+package service
+
+import (
+	"campus2/app/presence/model"
+	"campus2/app/presence/vo"
+	"campus2/pkg/global"
+	"errors"
+	"time"
+)
+
+// MaxQueryUsers 单次查询或订阅在线状态的最大用户数
+const MaxQueryUsers = 100
+
+var (
+	ErrPresenceDisabled = errors.New("未启用Redis，无法查询在线状态")
+	ErrTooManyUsers     = errors.New("单次查询的用户数过多")
+)
+
+type PresenceService struct{}
+
+func NewPresenceService() *PresenceService {
+	return &PresenceService{}
+}
+
+// GetPresences 查询多个用户的在线状态和最后在线时间，隐藏了在线状态的用户对其他人显示为离线
+func (s *PresenceService) GetPresences(viewerID string, userIDs []string) ([]vo.Presence, error) {
+	if global.GVA_REDIS == nil {
+		return nil, ErrPresenceDisabled
+	}
+	userIDs = uniqueIDs(userIDs)
+	if len(userIDs) > MaxQueryUsers {
+		return nil, ErrTooManyUsers
+	}
+
+	statuses, err := model.GetStatuses(userIDs)
+	if err != nil {
+		return nil, err
+	}
+	lastSeens, err := model.GetLastSeens(userIDs)
+	if err != nil {
+		return nil, err
+	}
+	visibilities, err := model.GetVisibilities(userIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]vo.Presence, 0, len(userIDs))
+	for _, userID := range userIDs {
+		presence := vo.Presence{UserID: userID, Status: model.StatusOffline}
+		if Visible(visibilities[userID], userID, viewerID) {
+			presence.Status = statuses[userID]
+			if lastSeen, ok := lastSeens[userID]; ok && presence.Status == model.StatusOffline {
+				presence.LastSeen = &lastSeen
+			}
+		}
+		result = append(result, presence)
+	}
+	return result, nil
+}
+
+// GetPrivacy 查询用户的在线状态隐私设置
+func (s *PresenceService) GetPrivacy(userID string) (*vo.Privacy, error) {
+	if global.GVA_REDIS == nil {
+		return nil, ErrPresenceDisabled
+	}
+	visibilities, err := model.GetVisibilities([]string{userID})
+	if err != nil {
+		return nil, err
+	}
+	return &vo.Privacy{Visibility: visibilities[userID]}, nil
+}
+
+// SetPrivacy 修改用户的在线状态隐私设置，并重新广播一次当前状态，
+// 使订阅者立即按新的可见范围看到该用户在线或离线
+func (s *PresenceService) SetPrivacy(userID, visibility string) error {
+	if global.GVA_REDIS == nil {
+		return ErrPresenceDisabled
+	}
+	if err := model.SetVisibility(userID, visibility); err != nil {
+		return err
+	}
+
+	statuses, err := model.GetStatuses([]string{userID})
+	if err != nil {
+		return err
+	}
+	event := &model.Event{UserID: userID, Status: statuses[userID]}
+	if event.Status == model.StatusOffline {
+		if lastSeens, err := model.GetLastSeens([]string{userID}); err == nil {
+			if lastSeen, ok := lastSeens[userID]; ok {
+				event.LastSeen = lastSeen.Unix()
+			}
+		}
+	}
+	return model.PublishEvent(event)
+}
+
+// Visible 用户的在线状态对查看者是否可见，用户本人始终可见
+func Visible(visibility, userID, viewerID string) bool {
+	return userID == viewerID || visibility != model.VisibilityNobody
+}
+
+// ToPresence 按查看者可见范围将状态变更事件转换为推送给查看者的在线状态
+func ToPresence(event *model.Event, visibility, viewerID string) vo.Presence {
+	presence := vo.Presence{UserID: event.UserID, Status: model.StatusOffline}
+	if !Visible(visibility, event.UserID, viewerID) {
+		return presence
+	}
+	presence.Status = event.Status
+	if event.Status == model.StatusOffline && event.LastSeen > 0 {
+		lastSeen := time.Unix(event.LastSeen, 0)
+		presence.LastSeen = &lastSeen
+	}
+	return presence
+}
+
+// uniqueIDs 去掉空值和重复的用户ID
+func uniqueIDs(userIDs []string) []string {
+	seen := make(map[string]bool, len(userIDs))
+	result := make([]string, 0, len(userIDs))
+	for _, userID := range userIDs {
+		if userID == "" || seen[userID] {
+			continue
+		}
+		seen[userID] = true
+		result = append(result, userID)
+	}
+	return result
+}
@@ -0,0 +1,15 @@
+package vo
+
+import "time"
+
+// Presence 用户的在线状态
+type Presence struct {
+	UserID   string     `json:"userId"`
+	Status   string     `json:"status"`             // online/idle/offline
+	LastSeen *time.Time `json:"lastSeen,omitempty"` // 最后在线时间，对方隐藏在线状态时不返回
+}
+
+// Privacy 在线状态隐私设置
+type Privacy struct {
+	Visibility string `json:"visibility"` // everyone/nobody
+}
@@ -0,0 +1,220 @@
+package controller
+
+import (
+	"campus2/app/room/dto"
+	"campus2/app/room/service"
+	"campus2/pkg/utils"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type RoomController struct {
+	roomService *service.RoomService
+}
+
+func NewRoomController() *RoomController {
+	return &RoomController{
+		roomService: service.NewRoomService(),
+	}
+}
+
+// CreateRoom godoc
+// @Summary 创建房间
+// @Description 创建班级群、社团群或宿舍群，创建者成为群主
+// @Tags 房间
+// @Accept json
+// @Produce json
+// @Param data body dto.CreateRoomRequest true "房间信息"
+// @Success 200 {object} vo.Room
+// @Router /room [post]
+func (rc *RoomController) CreateRoom(c *gin.Context) {
+	var req dto.CreateRoomRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	response, err := rc.roomService.CreateRoom(utils.GetUserID(c), &req)
+	if err != nil {
+		utils.RespondError(c, err, errorStatus)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// MyRooms godoc
+// @Summary 我加入的房间
+// @Tags 房间
+// @Produce json
+// @Success 200 {array} vo.Room
+// @Router /room/mine [get]
+func (rc *RoomController) MyRooms(c *gin.Context) {
+	response, err := rc.roomService.ListUserRooms(utils.GetUserID(c))
+	if err != nil {
+		utils.RespondError(c, err, errorStatus)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// GetRoom godoc
+// @Summary 房间详情
+// @Tags 房间
+// @Produce json
+// @Param id path int true "房间ID"
+// @Success 200 {object} vo.Room
+// @Router /room/{id} [get]
+func (rc *RoomController) GetRoom(c *gin.Context) {
+	var uri dto.RoomURI
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	response, err := rc.roomService.GetRoom(uri.RoomID, utils.GetUserID(c))
+	if err != nil {
+		utils.RespondError(c, err, errorStatus)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// ListMembers godoc
+// @Summary 房间成员列表
+// @Tags 房间
+// @Produce json
+// @Param id path int true "房间ID"
+// @Success 200 {array} vo.RoomMember
+// @Router /room/{id}/members [get]
+func (rc *RoomController) ListMembers(c *gin.Context) {
+	var uri dto.RoomURI
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	response, err := rc.roomService.ListMembers(uri.RoomID, utils.GetUserID(c))
+	if err != nil {
+		utils.RespondError(c, err, errorStatus)
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// JoinRoom godoc
+// @Summary 加入房间
+// @Tags 房间
+// @Produce json
+// @Param id path int true "房间ID"
+// @Success 200
+// @Router /room/{id}/join [post]
+func (rc *RoomController) JoinRoom(c *gin.Context) {
+	var uri dto.RoomURI
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := rc.roomService.JoinRoom(uri.RoomID, utils.GetUserID(c)); err != nil {
+		utils.RespondError(c, err, errorStatus)
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+// LeaveRoom godoc
+// @Summary 退出房间
+// @Tags 房间
+// @Produce json
+// @Param id path int true "房间ID"
+// @Success 200
+// @Router /room/{id}/leave [post]
+func (rc *RoomController) LeaveRoom(c *gin.Context) {
+	var uri dto.RoomURI
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := rc.roomService.LeaveRoom(uri.RoomID, utils.GetUserID(c)); err != nil {
+		utils.RespondError(c, err, errorStatus)
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+// KickMember godoc
+// @Summary 踢出成员
+// @Description 群主和管理员可以踢出角色低于自己的成员
+// @Tags 房间
+// @Accept json
+// @Produce json
+// @Param id path int true "房间ID"
+// @Param data body dto.KickRequest true "被踢出的成员"
+// @Success 200
+// @Router /room/{id}/kick [post]
+func (rc *RoomController) KickMember(c *gin.Context) {
+	var uri dto.RoomURI
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var req dto.KickRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := rc.roomService.KickMember(uri.RoomID, utils.GetUserID(c), req.UserID); err != nil {
+		utils.RespondError(c, err, errorStatus)
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+// SetMemberRole godoc
+// @Summary 设置成员角色
+// @Description 只有群主可以设置或取消管理员
+// @Tags 房间
+// @Accept json
+// @Produce json
+// @Param id path int true "房间ID"
+// @Param data body dto.SetRoleRequest true "成员角色"
+// @Success 200
+// @Router /room/{id}/role [put]
+func (rc *RoomController) SetMemberRole(c *gin.Context) {
+	var uri dto.RoomURI
+	if err := c.ShouldBindUri(&uri); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var req dto.SetRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := rc.roomService.SetMemberRole(uri.RoomID, utils.GetUserID(c), req.UserID, req.Role); err != nil {
+		utils.RespondError(c, err, errorStatus)
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+// errorStatus 业务错误对应的HTTP状态码
+var errorStatus = map[error]int{
+	service.ErrRoomNotFound:     http.StatusNotFound,
+	service.ErrNotMember:        http.StatusForbidden,
+	service.ErrPermissionDenied: http.StatusForbidden,
+	service.ErrAlreadyMember:    http.StatusConflict,
+	service.ErrOwnerCannotLeave: http.StatusConflict,
+}
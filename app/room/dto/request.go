@@ -0,0 +1,25 @@
+package dto
+
+// CreateRoomRequest 创建房间请求参数
+type CreateRoomRequest struct {
+	Name        string   `json:"name" binding:"required,max=64"`                       // 房间名称
+	Type        string   `json:"type" binding:"omitempty,oneof=class club dorm other"` // 房间类型
+	Description string   `json:"description" binding:"max=255"`                        // 房间简介
+	MemberIDs   []string `json:"memberIds" binding:"max=500,dive,required,max=64"`     // 创建时一并加入的成员
+}
+
+// RoomURI 路径中的房间ID
+type RoomURI struct {
+	RoomID uint `uri:"id" binding:"required"`
+}
+
+// KickRequest 踢出成员请求参数
+type KickRequest struct {
+	UserID string `json:"userId" binding:"required,max=64"` // 被踢出的用户ID
+}
+
+// SetRoleRequest 设置成员角色请求参数
+type SetRoleRequest struct {
+	UserID string `json:"userId" binding:"required,max=64"`           // 目标用户ID
+	Role   string `json:"role" binding:"required,oneof=admin member"` // 新角色
+}
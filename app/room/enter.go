@@ -0,0 +1,31 @@
+package room
+
+import (
+	"campus2/app/room/controller"
+
+	"github.com/gin-gonic/gin"
+)
+
+type RoomApp struct {
+	roomController *controller.RoomController
+}
+
+func NewRoomApp() *RoomApp {
+	return &RoomApp{
+		roomController: controller.NewRoomController(),
+	}
+}
+
+func (a *RoomApp) InitRoomRouter(private *gin.RouterGroup, public *gin.RouterGroup) {
+	privateGroup := private.Group("room")
+	{
+		privateGroup.POST("", a.roomController.CreateRoom)
+		privateGroup.GET("mine", a.roomController.MyRooms)
+		privateGroup.GET(":id", a.roomController.GetRoom)
+		privateGroup.GET(":id/members", a.roomController.ListMembers)
+		privateGroup.POST(":id/join", a.roomController.JoinRoom)
+		privateGroup.POST(":id/leave", a.roomController.LeaveRoom)
+		privateGroup.POST(":id/kick", a.roomController.KickMember)
+		privateGroup.PUT(":id/role", a.roomController.SetMemberRole)
+	}
+}
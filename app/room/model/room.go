@@ -0,0 +1,130 @@
+package model
+
+import (
+	"campus2/pkg/global"
+
+	"gorm.io/gorm"
+)
+
+// 房间类型
+const (
+	RoomTypeClass = "class" // 班级群
+	RoomTypeClub  = "club"  // 社团群
+	RoomTypeDorm  = "dorm"  // 宿舍群
+	RoomTypeOther = "other" // 其他
+)
+
+// 成员角色
+const (
+	RoleOwner  = "owner"  // 群主
+	RoleAdmin  = "admin"  // 管理员
+	RoleMember = "member" // 普通成员
+)
+
+// RoomModel 群聊房间
+type RoomModel struct {
+	gorm.Model
+	Name        string `gorm:"size:64;not null"`
+	Type        string `gorm:"size:16;not null;default:'other'"`
+	OwnerID     string `gorm:"size:64;not null;index"`
+	Description string `gorm:"size:255"`
+}
+
+// RoomMemberModel 房间成员
+type RoomMemberModel struct {
+	gorm.Model
+	RoomID uint   `gorm:"not null;uniqueIndex:idx_room_user"`
+	UserID string `gorm:"size:64;not null;uniqueIndex:idx_room_user;index"`
+	Role   string `gorm:"size:16;not null;default:'member'"`
+}
+
+// RoleLevel 角色等级，数值越大权限越高
+func RoleLevel(role string) int {
+	switch role {
+	case RoleOwner:
+		return 3
+	case RoleAdmin:
+		return 2
+	case RoleMember:
+		return 1
+	}
+	return 0
+}
+
+// CreateWithOwner 创建房间并把创建者加入为群主，initialMembers为同时加入的普通成员，
+// 其中重复的用户和创建者本人会被忽略
+func (r *RoomModel) CreateWithOwner(initialMembers []string) error {
+	return global.GVA_DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(r).Error; err != nil {
+			return err
+		}
+		members := []RoomMemberModel{{RoomID: r.ID, UserID: r.OwnerID, Role: RoleOwner}}
+		seen := map[string]bool{r.OwnerID: true}
+		for _, userID := range initialMembers {
+			if userID != "" && !seen[userID] {
+				seen[userID] = true
+				members = append(members, RoomMemberModel{RoomID: r.ID, UserID: userID, Role: RoleMember})
+			}
+		}
+		return tx.Create(&members).Error
+	})
+}
+
+// FindRoom 根据ID查询房间
+func FindRoom(roomID uint) (*RoomModel, error) {
+	var room RoomModel
+	if err := global.GVA_DB.First(&room, roomID).Error; err != nil {
+		return nil, err
+	}
+	return &room, nil
+}
+
+// FindMember 查询用户在房间中的成员记录
+func FindMember(roomID uint, userID string) (*RoomMemberModel, error) {
+	var member RoomMemberModel
+	err := global.GVA_DB.Where("room_id = ? AND user_id = ?", roomID, userID).First(&member).Error
+	if err != nil {
+		return nil, err
+	}
+	return &member, nil
+}
+
+// ListMembers 查询房间的所有成员
+func ListMembers(roomID uint) ([]RoomMemberModel, error) {
+	var members []RoomMemberModel
+	err := global.GVA_DB.Where("room_id = ?", roomID).Order("id").Find(&members).Error
+	return members, err
+}
+
+// ListMemberIDs 查询房间所有成员的用户ID
+func ListMemberIDs(roomID uint) ([]string, error) {
+	var userIDs []string
+	err := global.GVA_DB.Model(&RoomMemberModel{}).Where("room_id = ?", roomID).Pluck("user_id", &userIDs).Error
+	return userIDs, err
+}
+
+// ListUserRooms 查询用户加入的所有房间
+func ListUserRooms(userID string) ([]RoomModel, error) {
+	var rooms []RoomModel
+	err := global.GVA_DB.
+		Joins("JOIN room_member_models ON room_member_models.room_id = room_models.id AND room_member_models.deleted_at IS NULL").
+		Where("room_member_models.user_id = ?", userID).
+		Order("room_models.id").
+		Find(&rooms).Error
+	return rooms, err
+}
+
+// Create 添加成员
+func (m *RoomMemberModel) Create() error {
+	return global.GVA_DB.Create(m).Error
+}
+
+// Delete 移除成员，使用物理删除以便之后可以重新加入
+func (m *RoomMemberModel) Delete() error {
+	return global.GVA_DB.Unscoped().Delete(m).Error
+}
+
+// UpdateRole 修改成员角色
+func (m *RoomMemberModel) UpdateRole(role string) error {
+	return global.GVA_DB.Model(m).Update("role", role).Error
+}
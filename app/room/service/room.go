@@ -0,0 +1,190 @@
+package service
+
+import (
+	"campus2/app/room/dto"
+	"campus2/app/room/model"
+	"campus2/app/room/vo"
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrRoomNotFound     = errors.New("房间不存在")
+	ErrNotMember        = errors.New("不是房间成员")
+	ErrAlreadyMember    = errors.New("已经是房间成员")
+	ErrPermissionDenied = errors.New("没有权限执行该操作")
+	ErrOwnerCannotLeave = errors.New("群主不能退出房间")
+)
+
+type RoomService struct{}
+
+func NewRoomService() *RoomService {
+	return &RoomService{}
+}
+
+// CreateRoom 创建房间，创建者成为群主
+func (s *RoomService) CreateRoom(ownerID string, req *dto.CreateRoomRequest) (*vo.Room, error) {
+	roomType := req.Type
+	if roomType == "" {
+		roomType = model.RoomTypeOther
+	}
+	room := &model.RoomModel{
+		Name:        req.Name,
+		Type:        roomType,
+		OwnerID:     ownerID,
+		Description: req.Description,
+	}
+	if err := room.CreateWithOwner(req.MemberIDs); err != nil {
+		return nil, err
+	}
+	return toRoomVO(room), nil
+}
+
+// GetRoom 查询房间详情，仅成员可见
+func (s *RoomService) GetRoom(roomID uint, userID string) (*vo.Room, error) {
+	room, err := s.findRoom(roomID)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.findMember(roomID, userID); err != nil {
+		return nil, err
+	}
+	return toRoomVO(room), nil
+}
+
+// ListUserRooms 查询用户加入的房间
+func (s *RoomService) ListUserRooms(userID string) ([]vo.Room, error) {
+	rooms, err := model.ListUserRooms(userID)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]vo.Room, 0, len(rooms))
+	for i := range rooms {
+		result = append(result, *toRoomVO(&rooms[i]))
+	}
+	return result, nil
+}
+
+// ListMembers 查询房间成员，仅成员可见
+func (s *RoomService) ListMembers(roomID uint, userID string) ([]vo.RoomMember, error) {
+	if _, err := s.findMember(roomID, userID); err != nil {
+		return nil, err
+	}
+	members, err := model.ListMembers(roomID)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]vo.RoomMember, 0, len(members))
+	for _, m := range members {
+		result = append(result, vo.RoomMember{UserID: m.UserID, Role: m.Role, JoinedAt: m.CreatedAt})
+	}
+	return result, nil
+}
+
+// JoinRoom 加入房间
+func (s *RoomService) JoinRoom(roomID uint, userID string) error {
+	if _, err := s.findRoom(roomID); err != nil {
+		return err
+	}
+	if _, err := s.findMember(roomID, userID); err == nil {
+		return ErrAlreadyMember
+	} else if !errors.Is(err, ErrNotMember) {
+		return err
+	}
+	member := &model.RoomMemberModel{RoomID: roomID, UserID: userID, Role: model.RoleMember}
+	return member.Create()
+}
+
+// LeaveRoom 退出房间，群主不能退出
+func (s *RoomService) LeaveRoom(roomID uint, userID string) error {
+	member, err := s.findMember(roomID, userID)
+	if err != nil {
+		return err
+	}
+	if member.Role == model.RoleOwner {
+		return ErrOwnerCannotLeave
+	}
+	return member.Delete()
+}
+
+// KickMember 踢出成员，只能踢出角色低于自己的成员
+func (s *RoomService) KickMember(roomID uint, operatorID, targetID string) error {
+	operator, target, err := s.findOperatorAndTarget(roomID, operatorID, targetID)
+	if err != nil {
+		return err
+	}
+	if model.RoleLevel(operator.Role) < model.RoleLevel(model.RoleAdmin) ||
+		model.RoleLevel(operator.Role) <= model.RoleLevel(target.Role) {
+		return ErrPermissionDenied
+	}
+	return target.Delete()
+}
+
+// SetMemberRole 设置成员角色，只有群主可以操作
+func (s *RoomService) SetMemberRole(roomID uint, operatorID, targetID, role string) error {
+	operator, target, err := s.findOperatorAndTarget(roomID, operatorID, targetID)
+	if err != nil {
+		return err
+	}
+	if operator.Role != model.RoleOwner || target.Role == model.RoleOwner {
+		return ErrPermissionDenied
+	}
+	return target.UpdateRole(role)
+}
+
+// IsMember 检查用户是否为房间成员
+func (s *RoomService) IsMember(roomID uint, userID string) (bool, error) {
+	_, err := s.findMember(roomID, userID)
+	if errors.Is(err, ErrNotMember) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// MemberIDs 查询房间所有成员ID
+func (s *RoomService) MemberIDs(roomID uint) ([]string, error) {
+	return model.ListMemberIDs(roomID)
+}
+
+func (s *RoomService) findRoom(roomID uint) (*model.RoomModel, error) {
+	room, err := model.FindRoom(roomID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrRoomNotFound
+	}
+	return room, err
+}
+
+func (s *RoomService) findMember(roomID uint, userID string) (*model.RoomMemberModel, error) {
+	member, err := model.FindMember(roomID, userID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotMember
+	}
+	return member, err
+}
+
+func (s *RoomService) findOperatorAndTarget(roomID uint, operatorID, targetID string) (*model.RoomMemberModel, *model.RoomMemberModel, error) {
+	operator, err := s.findMember(roomID, operatorID)
+	if errors.Is(err, ErrNotMember) {
+		return nil, nil, ErrPermissionDenied
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	target, err := s.findMember(roomID, targetID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return operator, target, nil
+}
+
+func toRoomVO(room *model.RoomModel) *vo.Room {
+	return &vo.Room{
+		ID:          room.ID,
+		Name:        room.Name,
+		Type:        room.Type,
+		OwnerID:     room.OwnerID,
+		Description: room.Description,
+		CreatedAt:   room.CreatedAt,
+	}
+}
@@ -0,0 +1,347 @@
+package websocket
+
+import (
+	"campus2/app/websocket/model"
+	"campus2/pkg/global"
+	"context"
+	"encoding/json"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// 投递确认的默认参数，配置未设置时使用
+const (
+	defaultAckTimeout = 10  // 等待确认的超时时间(秒)
+	defaultAckRetries = 3   // 最大重传次数
+	defaultAckWindow  = 256 // 每个连接最多等待确认的消息数
+)
+
+const (
+	ackedKeyPrefix = "ws:acked:"      // String标记用户已确认的消息 ws:acked:{userID}:{messageID}
+	ackedTTL       = 10 * time.Minute // 确认记录的保留时间，覆盖其他设备断开时转存未确认消息的时间差
+	localAcksLimit = 10000            // 本地确认记录超过该数量时清理过期记录
+)
+
+// localAcks 未启用Redis时在节点内存中记录已确认的消息
+type localAcks struct {
+	mu      sync.Mutex
+	entries map[string]time.Time // map[userID:messageID]过期时间
+}
+
+// messageSeq 消息ID自增序号，与节点标识和时间戳组合保证集群内唯一
+var messageSeq uint64
+
+// inflightFrame 已推送但尚未收到客户端确认的消息
+type inflightFrame struct {
+	data    []byte    // 原始消息
+	from    string    // 发送者，确认后向其发送送达回执
+	sentAt  time.Time // 最近一次推送时间
+	retries int       // 已重传次数
+}
+
+// frameHeader 用于从原始消息中读取路由所需的字段
+type frameHeader struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+	From string `json:"from"`
+	Seq  uint64 `json:"seq"`
+}
+
+// nextMessageID 生成服务端消息ID
+func (m *Manager) nextMessageID() string {
+	seq := atomic.AddUint64(&messageSeq, 1)
+	return m.serverID + "-" + strconv.FormatInt(time.Now().UnixNano(), 36) + "-" + strconv.FormatUint(seq, 36)
+}
+
+// needsMessageID 回执、临时消息和心跳不分配服务端消息ID，也不需要确认
+func needsMessageID(msgType string) bool {
+	switch msgType {
+	case model.MessageTypeAck, model.MessageTypeTyping, model.MessageTypeRead,
+		model.MessageTypePresence, model.MessageTypePresenceSub, model.MessageTypePresenceUnsub, model.MessageTypePing:
+		return false
+	}
+	return true
+}
+
+// needAck 带有服务端消息ID的业务消息需要客户端确认，回执类消息不需要
+func needAck(h *frameHeader) bool {
+	return h.ID != "" && h.Type != model.MessageTypeDelivered && h.Type != model.MessageTypeAck
+}
+
+// deliver 将消息放入发送队列，需要确认的消息同时进入等待确认窗口。
+// 发送队列已满时交给慢消费者处理策略；返回false(确认窗口已满、连接已关闭或策略未能处理)时由调用方转入离线存储
+func (c *Client) deliver(message []byte) bool {
+	if c.holdLive(message) {
+		return true
+	}
+	return c.deliverNow(message)
+}
+
+// deliverNow 与deliver相同，但不经过续传期间的暂存
+func (c *Client) deliverNow(message []byte) bool {
+	var h frameHeader
+	// 自己发出的消息同步到其他设备时不需要确认
+	if err := json.Unmarshal(message, &h); err == nil && needAck(&h) && h.From != c.UserID {
+		c.inflightMu.Lock()
+		if _, exists := c.inflight[h.ID]; !exists {
+			if len(c.inflight) >= c.ackWindow() {
+				c.inflightMu.Unlock()
+				global.GVA_LOG.Warnf("客户端 %s 等待确认的消息过多，消息 %s 转入离线存储", c.ID, h.ID)
+				return false
+			}
+			c.inflight[h.ID] = &inflightFrame{data: message, from: h.From, sentAt: time.Now()}
+		}
+		c.inflightMu.Unlock()
+	}
+
+	queued, closed := c.enqueue(message)
+	if queued {
+		return true
+	}
+	if !closed {
+		c.metrics.overflows.Add(1)
+		global.GVA_LOG.Warnf("客户端 %s 的发送队列已满", c.ID)
+		if c.Manager.slowPolicy.Overflow(c, message) {
+			return true
+		}
+	}
+	c.inflightMu.Lock()
+	delete(c.inflight, h.ID)
+	c.inflightMu.Unlock()
+	return false
+}
+
+// handleAck 处理客户端对消息的确认。确认按(用户, 消息ID)生效：第一次确认时更新离线消息状态、
+// 移出用户所有设备的等待确认窗口并向发送者发送一次送达回执，其他设备之后的确认直接忽略
+func (c *Client) handleAck(messageID string) {
+	c.inflightMu.Lock()
+	frame, ok := c.inflight[messageID]
+	delete(c.inflight, messageID)
+	c.inflightMu.Unlock()
+	if !ok {
+		global.GVA_LOG.Debugf("客户端 %s 确认了未知的消息 %s", c.ID, messageID)
+		return
+	}
+	if !c.Manager.claimAck(c.UserID, messageID) {
+		global.GVA_LOG.Debugf("用户 %s 已在其他设备上确认消息 %s", c.UserID, messageID)
+		return
+	}
+	global.GVA_LOG.Infof("客户端 %s 确认收到消息 %s", c.ID, messageID)
+
+	c.Manager.markRead(c.UserID, messageID)
+	c.Manager.ackOtherDevices(c, messageID)
+
+	if frame.from == "" || frame.from == c.UserID {
+		return
+	}
+	receipt := model.Message{
+		ID:        messageID,
+		Type:      model.MessageTypeDelivered,
+		From:      c.UserID,
+		To:        frame.from,
+		CreatedAt: time.Now(),
+	}
+	data, err := json.Marshal(receipt)
+	if err != nil {
+		return
+	}
+	if err := c.Manager.SendToUser(frame.from, data); err != nil {
+		global.GVA_LOG.Errorf("向用户 %s 发送送达回执失败: %v", frame.from, err)
+	}
+}
+
+// ackedKey 获取确认记录的key
+func ackedKey(userID, messageID string) string {
+	return ackedKeyPrefix + userID + ":" + messageID
+}
+
+// claimAck 登记用户对消息的确认，只有第一次确认返回true。Redis出错时按第一次确认处理
+func (m *Manager) claimAck(userID, messageID string) bool {
+	if m.redisStore != nil {
+		ok, err := global.GVA_REDIS.SetNX(context.Background(), ackedKey(userID, messageID), 1, ackedTTL).Result()
+		if err != nil {
+			global.GVA_LOG.Errorf("登记用户 %s 对消息 %s 的确认失败: %v", userID, messageID, err)
+			return true
+		}
+		return ok
+	}
+
+	a := &m.acks
+	key := ackedKey(userID, messageID)
+	now := time.Now()
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.entries == nil {
+		a.entries = make(map[string]time.Time)
+	}
+	if expireAt, ok := a.entries[key]; ok && now.Before(expireAt) {
+		return false
+	}
+	if len(a.entries) >= localAcksLimit {
+		for k, expireAt := range a.entries {
+			if !now.Before(expireAt) {
+				delete(a.entries, k)
+			}
+		}
+	}
+	a.entries[key] = now.Add(ackedTTL)
+	return true
+}
+
+// acked 筛选出用户已经确认过的消息，Redis出错时视为都未确认
+func (m *Manager) acked(userID string, messageIDs []string) map[string]bool {
+	result := make(map[string]bool)
+	if len(messageIDs) == 0 {
+		return result
+	}
+	if m.redisStore != nil {
+		ctx := context.Background()
+		pipe := global.GVA_REDIS.Pipeline()
+		cmds := make([]*redis.IntCmd, len(messageIDs))
+		for i, id := range messageIDs {
+			cmds[i] = pipe.Exists(ctx, ackedKey(userID, id))
+		}
+		if _, err := pipe.Exec(ctx); err != nil {
+			global.GVA_LOG.Errorf("查询用户 %s 的确认记录失败: %v", userID, err)
+			return result
+		}
+		for i, cmd := range cmds {
+			if cmd.Val() > 0 {
+				result[messageIDs[i]] = true
+			}
+		}
+		return result
+	}
+
+	now := time.Now()
+	m.acks.mu.Lock()
+	defer m.acks.mu.Unlock()
+	for _, id := range messageIDs {
+		if expireAt, ok := m.acks.entries[ackedKey(userID, id)]; ok && now.Before(expireAt) {
+			result[id] = true
+		}
+	}
+	return result
+}
+
+// ackOtherDevices 用户在一个设备上确认后，其他设备不再等待该消息的确认，断开时也不再转入离线存储
+func (m *Manager) ackOtherDevices(c *Client, messageID string) {
+	m.dropInflight(c.UserID, messageID, c)
+	if m.redisStore == nil {
+		return
+	}
+	devices, err := m.lookupDevices(context.Background(), c.UserID)
+	if err != nil {
+		global.GVA_LOG.Errorf("查询用户 %s 的连接信息失败: %v", c.UserID, err)
+		return
+	}
+	notified := make(map[string]bool)
+	for _, info := range devices {
+		if info.ServerID == m.serverID || notified[info.ServerID] {
+			continue
+		}
+		notified[info.ServerID] = true
+		m.publish(info.ServerID, envelope{Kind: envelopeAck, UserID: c.UserID, MessageID: messageID})
+	}
+}
+
+// dropInflight 将消息移出用户在本节点上除except外所有连接的等待确认窗口
+func (m *Manager) dropInflight(userID, messageID string, except *Client) {
+	m.clients.Range(func(key, value interface{}) bool {
+		client := value.(*Client)
+		if client.UserID == userID && client != except {
+			client.inflightMu.Lock()
+			delete(client.inflight, messageID)
+			client.inflightMu.Unlock()
+		}
+		return true
+	})
+}
+
+// storeUnacked 将未确认的消息转入离线存储，跳过用户已在其他设备上确认的消息
+func (c *Client) storeUnacked(frames map[string]*inflightFrame) {
+	ids := make([]string, 0, len(frames))
+	for id := range frames {
+		ids = append(ids, id)
+	}
+	acked := c.Manager.acked(c.UserID, ids)
+	for id, frame := range frames {
+		if acked[id] {
+			continue
+		}
+		if err := c.Manager.storeOffline(c.UserID, frame.data); err != nil {
+			global.GVA_LOG.Errorf("存储未确认消息失败: %v", err)
+		}
+	}
+}
+
+// retransmitLoop 定期重传超时未确认的消息，超过最大重传次数的消息转入离线存储
+func (c *Client) retransmitLoop() {
+	timeout := time.Duration(global.WebSocketConfig().AckTimeout) * time.Second
+	if timeout <= 0 {
+		timeout = defaultAckTimeout * time.Second
+	}
+	maxRetries := global.WebSocketConfig().AckRetries
+	if maxRetries <= 0 {
+		maxRetries = defaultAckRetries
+	}
+
+	ticker := time.NewTicker(timeout / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			expired := make(map[string]*inflightFrame)
+			c.inflightMu.Lock()
+			for id, frame := range c.inflight {
+				if time.Since(frame.sentAt) < timeout {
+					continue
+				}
+				if frame.retries >= maxRetries {
+					expired[id] = frame
+					delete(c.inflight, id)
+					continue
+				}
+				if queued, _ := c.enqueue(frame.data); queued {
+					frame.retries++
+					frame.sentAt = time.Now()
+					global.GVA_LOG.Infof("客户端 %s 的消息 %s 超时未确认，第 %d 次重传", c.ID, id, frame.retries)
+				}
+			}
+			c.inflightMu.Unlock()
+
+			if len(expired) > 0 {
+				global.GVA_LOG.Warnf("客户端 %s 有 %d 条消息超过最大重传次数，转入离线存储", c.ID, len(expired))
+				c.storeUnacked(expired)
+			}
+		}
+	}
+}
+
+// flushInflight 连接断开时将所有未确认的消息转入离线存储
+func (c *Client) flushInflight() {
+	c.inflightMu.Lock()
+	frames := c.inflight
+	c.inflight = make(map[string]*inflightFrame)
+	c.inflightMu.Unlock()
+
+	if len(frames) == 0 {
+		return
+	}
+	global.GVA_LOG.Infof("客户端 %s 断开时有 %d 条消息未确认，转入离线存储", c.ID, len(frames))
+	c.storeUnacked(frames)
+}
+
+// ackWindow 每个连接等待确认窗口的大小
+func (c *Client) ackWindow() int {
+	if global.WebSocketConfig().AckWindow > 0 {
+		return global.WebSocketConfig().AckWindow
+	}
+	return defaultAckWindow
+}
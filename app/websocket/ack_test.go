@@ -0,0 +1,87 @@
+package websocket
+
+import (
+	"campus2/app/websocket/model"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestClaimAck(t *testing.T) {
+	for _, withRedis := range []bool{false, true} {
+		name := "本地"
+		if withRedis {
+			name = "Redis"
+		}
+		t.Run(name, func(t *testing.T) {
+			var m *Manager
+			if withRedis {
+				m, _ = newRedisManager(t)
+			} else {
+				m = newTestManager(t)
+			}
+			if !m.claimAck("u1", "m1") {
+				t.Fatal("第一次确认应返回true")
+			}
+			if m.claimAck("u1", "m1") {
+				t.Error("同一用户的其他设备再次确认应返回false")
+			}
+			if !m.claimAck("u2", "m1") {
+				t.Error("确认按用户区分，其他用户确认同一消息应返回true")
+			}
+			acked := m.acked("u1", []string{"m1", "m2"})
+			if !acked["m1"] || acked["m2"] {
+				t.Errorf("应只有m1被确认，实际为%v", acked)
+			}
+		})
+	}
+}
+
+func TestHandleAckAcrossDevices(t *testing.T) {
+	m := newTestManager(t)
+	phone := newTestClient(m, "u1", "phone")
+	pad := newTestClient(m, "u1", "pad")
+	sender := newTestClient(m, "u2", "phone")
+	for _, c := range []*Client{phone, pad, sender} {
+		m.clients.Store(c.ID, c)
+	}
+
+	data, _ := json.Marshal(model.Message{ID: "m1", Type: model.MessageTypeChat, From: "u2", To: "u1", CreatedAt: time.Now()})
+	phone.deliver(data)
+	pad.deliver(data)
+
+	phone.handleAck("m1")
+	pad.handleAck("m1")
+
+	if len(pad.inflight) != 0 {
+		t.Error("一个设备确认后其他设备不应再等待确认")
+	}
+	receipts := 0
+	for len(sender.Send) > 0 {
+		var msg model.Message
+		json.Unmarshal(<-sender.Send, &msg)
+		if msg.Type == model.MessageTypeDelivered {
+			receipts++
+		}
+	}
+	if receipts != 1 {
+		t.Errorf("应只发送1条送达回执，实际为%d条", receipts)
+	}
+}
+
+func TestStoreOfflineKeepsTimestamp(t *testing.T) {
+	m, _ := newRedisManager(t)
+	sent := time.Now().Add(-time.Hour).Truncate(time.Millisecond)
+	data, _ := json.Marshal(model.OfflineMessage{ID: "m1", Type: model.MessageTypeSystem, To: "u1", Timestamp: sent})
+
+	if err := m.storeOffline("u1", data); err != nil {
+		t.Fatalf("存储离线消息失败: %v", err)
+	}
+	messages, err := m.redisStore.GetOfflineMessages("u1")
+	if err != nil || len(messages) != 1 {
+		t.Fatalf("应转存1条离线消息，实际为%v, err=%v", messages, err)
+	}
+	if !messages[0].Timestamp.Equal(sent) {
+		t.Errorf("离线消息的发送时间应为%v，实际为%v", sent, messages[0].Timestamp)
+	}
+}
@@ -0,0 +1,351 @@
+package websocket
+
+import (
+	"campus2/app/websocket/model"
+	"campus2/pkg/global"
+	"campus2/pkg/utils"
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+const (
+	// broadcastChannel 全员广播频道，所有节点订阅后推送给本节点上的连接
+	broadcastChannel = "ws:broadcast"
+	// systemSender 系统消息的发送者
+	systemSender = "system"
+	// maxSessionPage 每页最多返回的在线用户数
+	maxSessionPage = 500
+)
+
+var errOfflineStoreDisabled = errors.New("未启用离线消息存储")
+
+// Session 一个设备的连接信息
+type Session struct {
+	ConnInfo
+	Local   bool           `json:"local"`             // 连接是否在处理本次请求的节点上
+	Metrics *ClientMetrics `json:"metrics,omitempty"` // 发送统计，只有本节点上的连接才有
+}
+
+// UserSessions 用户的所有在线设备
+type UserSessions struct {
+	UserID   string    `json:"userId"`
+	Online   bool      `json:"online"`
+	Sessions []Session `json:"sessions"`
+}
+
+// UserDetail 用户的连接和离线消息情况
+type UserDetail struct {
+	UserSessions
+	OfflineTotal  int64 `json:"offlineTotal"`  // 离线消息总数，只有Redis存储支持统计
+	OfflineUnread int64 `json:"offlineUnread"` // 未读离线消息数
+}
+
+// SessionPage 分页的在线用户列表
+type SessionPage struct {
+	Total  int64          `json:"total"`  // 在线用户总数
+	Cursor uint64         `json:"cursor"` // 下一页的游标，为0时表示已经是最后一页
+	Users  []UserSessions `json:"users"`
+}
+
+// offlinePurger 支持清空用户离线消息的存储
+type offlinePurger interface {
+	PurgeMessages(userID string) (int64, error)
+}
+
+// offlineCounter 支持统计用户离线消息的存储
+type offlineCounter interface {
+	CountMessages(userID string) (total int64, unread int64, err error)
+}
+
+// ListSessions 分页列出所有节点上的在线用户及其设备。未启用Redis时只能列出本节点的连接，且不分页
+func (m *Manager) ListSessions(cursor uint64, count int64) (*SessionPage, error) {
+	if count <= 0 || count > maxSessionPage {
+		count = maxSessionPage
+	}
+	if m.redisStore == nil {
+		users := make(map[string]*UserSessions)
+		var order []string
+		m.clients.Range(func(key, value interface{}) bool {
+			client := value.(*Client)
+			us, ok := users[client.UserID]
+			if !ok {
+				us = &UserSessions{UserID: client.UserID, Online: true}
+				users[client.UserID] = us
+				order = append(order, client.UserID)
+			}
+			us.Sessions = append(us.Sessions, m.localSession(client))
+			return true
+		})
+		page := &SessionPage{Total: int64(len(order)), Users: make([]UserSessions, 0, len(order))}
+		for _, userID := range order {
+			page.Users = append(page.Users, *users[userID])
+		}
+		return page, nil
+	}
+
+	ctx := context.Background()
+	total, err := global.GVA_REDIS.HLen(ctx, connMapKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	// HSCAN返回field和value交替排列
+	items, next, err := global.GVA_REDIS.HScan(ctx, connMapKey, cursor, "", count).Result()
+	if err != nil {
+		return nil, err
+	}
+	page := &SessionPage{Total: total, Cursor: next, Users: make([]UserSessions, 0, len(items)/2)}
+	for i := 0; i < len(items); i += 2 {
+		us, err := m.userSessions(ctx, items[i])
+		if err != nil {
+			return nil, err
+		}
+		page.Users = append(page.Users, *us)
+	}
+	return page, nil
+}
+
+// InspectUser 查询用户在所有节点上的连接，以及离线消息的数量
+func (m *Manager) InspectUser(userID string) (*UserDetail, error) {
+	us, err := m.userSessions(context.Background(), userID)
+	if err != nil {
+		return nil, err
+	}
+	detail := &UserDetail{UserSessions: *us}
+	if counter, ok := m.offlineStore().(offlineCounter); ok {
+		if detail.OfflineTotal, detail.OfflineUnread, err = counter.CountMessages(userID); err != nil {
+			return nil, err
+		}
+	}
+	return detail, nil
+}
+
+// userSessions 查询用户的所有设备，本节点上的连接附带发送统计
+func (m *Manager) userSessions(ctx context.Context, userID string) (*UserSessions, error) {
+	us := &UserSessions{UserID: userID, Sessions: []Session{}}
+	local := make(map[string]*Client)
+	m.clients.Range(func(key, value interface{}) bool {
+		client := value.(*Client)
+		if client.UserID == userID {
+			local[client.ID] = client
+		}
+		return true
+	})
+
+	if m.redisStore == nil {
+		for _, client := range local {
+			us.Sessions = append(us.Sessions, m.localSession(client))
+		}
+	} else {
+		devices, err := m.lookupDevices(ctx, userID)
+		if err != nil {
+			return nil, err
+		}
+		for _, info := range devices {
+			if client, ok := local[info.ConnID]; ok {
+				us.Sessions = append(us.Sessions, m.localSession(client))
+				continue
+			}
+			us.Sessions = append(us.Sessions, Session{ConnInfo: info})
+		}
+	}
+	us.Online = len(us.Sessions) > 0
+	return us, nil
+}
+
+// localSession 本节点上连接的信息
+func (m *Manager) localSession(client *Client) Session {
+	metrics := client.Metrics()
+	return Session{
+		ConnInfo: ConnInfo{
+			UserID:    client.UserID,
+			DeviceID:  client.DeviceID,
+			ConnID:    client.ID,
+			ServerID:  m.serverID,
+			Transport: client.Transport,
+			LastPing:  client.LastPing().Unix(),
+			Idle:      client.idle.Load(),
+		},
+		Local:   true,
+		Metrics: &metrics,
+	}
+}
+
+// Disconnect 断开用户在所有节点上的连接，deviceID不为空时只断开该设备，返回断开的连接数和吊销的token数。
+// 连接以1008关闭码断开，连接使用的token同时被吊销，客户端需要重新登录
+func (m *Manager) Disconnect(userID, deviceID, reason string) (int, int) {
+	disconnected := 0
+	local := make(map[string]bool)
+	tokens := make(map[string]time.Time)
+	m.clients.Range(func(key, value interface{}) bool {
+		client := value.(*Client)
+		if client.UserID == userID && (deviceID == "" || client.DeviceID == deviceID) {
+			local[client.ID] = true
+			for _, id := range client.tokens {
+				tokens[id] = client.tokensExpireAt
+			}
+			client.kick(reason)
+			disconnected++
+		}
+		return true
+	})
+	if m.redisStore == nil {
+		return disconnected, 0
+	}
+
+	devices, err := m.lookupDevices(context.Background(), userID)
+	if err != nil {
+		global.GVA_LOG.Errorf("查询用户 %s 的连接信息失败: %v", userID, err)
+	}
+	for _, info := range devices {
+		if deviceID != "" && info.DeviceID != deviceID {
+			continue
+		}
+		for _, id := range info.TokenIDs {
+			tokens[id] = time.Unix(info.TokenExpiresAt, 0)
+		}
+		if local[info.ConnID] || info.ServerID == m.serverID {
+			continue
+		}
+		receivers := m.publish(info.ServerID, envelope{
+			Kind:     envelopeKick,
+			UserID:   info.UserID,
+			DeviceID: info.DeviceID,
+			ConnID:   info.ConnID,
+			Reason:   reason,
+		})
+		if receivers > 0 {
+			disconnected++
+		}
+	}
+	return disconnected, m.revokeTokens(userID, tokens)
+}
+
+// revokeTokens 吊销被断开的连接使用的token，返回吊销成功的数量
+func (m *Manager) revokeTokens(userID string, tokens map[string]time.Time) int {
+	revoked := 0
+	for id, expiresAt := range tokens {
+		if err := utils.RevokeTokenID(id, expiresAt); err != nil {
+			global.GVA_LOG.Errorf("吊销用户 %s 的token %s 失败: %v", userID, id, err)
+			continue
+		}
+		revoked++
+	}
+	return revoked
+}
+
+// PushSystem 向指定用户推送系统消息，用户不在线时写入离线存储；userIDs为空时推送给所有在线用户。
+// 返回消息ID，推送给所有人时离线用户不会收到
+func (m *Manager) PushSystem(userIDs []string, content interface{}) (string, error) {
+	msg, err := m.systemMessage(content)
+	if err != nil {
+		return "", err
+	}
+
+	if len(userIDs) == 0 {
+		data, err := json.Marshal(msg)
+		if err != nil {
+			return "", err
+		}
+		m.publishBroadcast(&broadcastFrame{Payload: data})
+		return msg.ID, nil
+	}
+	for _, userID := range userIDs {
+		msg.To = userID
+		data, err := json.Marshal(msg)
+		if err != nil {
+			return "", err
+		}
+		if err := m.SendToUser(userID, data); err != nil {
+			global.GVA_LOG.Errorf("向用户 %s 推送系统消息失败: %v", userID, err)
+		}
+	}
+	return msg.ID, nil
+}
+
+// PushSegments 向属于任一分组(matchAll为true时属于所有分组)的在线连接推送系统消息。
+// offline为true时给分组中当前不在线的成员补发离线消息(需要启用Redis)，返回消息ID和补发的人数
+func (m *Manager) PushSegments(segments []string, matchAll, offline bool, content interface{}) (string, int, error) {
+	for _, segment := range segments {
+		if !validSegment(segment) {
+			return "", 0, invalidPayload("无效的分组: " + segment)
+		}
+	}
+	msg, err := m.systemMessage(content)
+	if err != nil {
+		return "", 0, err
+	}
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return "", 0, err
+	}
+	m.publishBroadcast(&broadcastFrame{Segments: segments, MatchAll: matchAll, Payload: data})
+
+	if !offline {
+		return msg.ID, 0, nil
+	}
+	if m.redisStore == nil {
+		global.GVA_LOG.Warnf("未启用Redis，无法给分组 %v 的离线成员补发消息 %s", segments, msg.ID)
+		return msg.ID, 0, nil
+	}
+	stored, err := m.storeSegmentOffline(segments, matchAll, data)
+	return msg.ID, stored, err
+}
+
+// systemMessage 生成系统消息并校验内容
+func (m *Manager) systemMessage(content interface{}) (*model.Message, error) {
+	msg := &model.Message{
+		ID:        m.nextMessageID(),
+		Type:      model.MessageTypeSystem,
+		Content:   content,
+		From:      systemSender,
+		CreatedAt: time.Now(),
+	}
+	if err := validatePayload(msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// PurgeOffline 清空用户的离线消息，返回删除的条数
+func (m *Manager) PurgeOffline(userID string) (int64, error) {
+	if m.redisStore == nil && m.kafkaStore == nil {
+		return 0, errOfflineStoreDisabled
+	}
+	var purged int64
+	for _, s := range []model.MessageStore{m.redisStore, m.kafkaStore} {
+		purger, ok := s.(offlinePurger)
+		if !ok {
+			continue
+		}
+		n, err := purger.PurgeMessages(userID)
+		if err != nil {
+			return purged, err
+		}
+		if n > purged {
+			purged = n // Kafka是Redis的备份，两者记录的是同一批消息
+		}
+	}
+	return purged, nil
+}
+
+// subscribeBroadcast 订阅全员广播频道，推送给本节点上的连接
+func (m *Manager) subscribeBroadcast() {
+	pubsub := m.subscribe(broadcastChannel)
+	if pubsub == nil {
+		return
+	}
+	defer pubsub.Close()
+	global.GVA_LOG.Infof("已订阅全员广播频道: %s", broadcastChannel)
+	m.trackPubSub(pubsub)
+
+	for msg := range pubsub.Channel() {
+		var frame broadcastFrame
+		if err := json.Unmarshal([]byte(msg.Payload), &frame); err != nil {
+			global.GVA_LOG.Errorf("解析广播失败: %v", err)
+			continue
+		}
+		m.broadcast <- &frame
+	}
+}
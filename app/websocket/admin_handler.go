@@ -0,0 +1,232 @@
+package websocket
+
+import (
+	"campus2/pkg/global"
+	"campus2/pkg/utils"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 一次推送系统消息最多指定的用户数和分组数
+const (
+	maxSystemRecipients = 1000
+	maxSystemSegments   = 20
+)
+
+var (
+	errInvalidSystemTarget = errors.New("userIds、segments和all必须指定其一")
+	errTooManyRecipients   = errors.New("接收者或分组过多")
+	errAdminForbidden      = errors.New("角色无权访问管理接口")
+)
+
+// AdminHandler WebSocket管理接口，只有websocket.adminRoles中的角色可以访问
+type AdminHandler struct {
+	manager *Manager
+}
+
+// NewAdminHandler 创建管理接口处理器
+func NewAdminHandler(manager *Manager) *AdminHandler {
+	return &AdminHandler{manager: manager}
+}
+
+// SystemPushRequest 推送系统消息的请求，userIds、segments和all必须指定其一
+type SystemPushRequest struct {
+	UserIDs  []string    `json:"userIds"`                    // 接收者，离线用户写入离线存储
+	Segments []string    `json:"segments"`                   // 目标分组，如school:xxx、grade:2023、tag:xxx
+	MatchAll bool        `json:"matchAll"`                   // 为true时只推送给同时属于所有分组的连接
+	Offline  bool        `json:"offline"`                    // 给分组中不在线的成员补发离线消息
+	All      bool        `json:"all"`                        // 推送给所有在线用户
+	Content  interface{} `json:"content" binding:"required"` // 字符串或{title, text}
+}
+
+// adminRoles 允许调用管理接口的角色
+func adminRoles() []string {
+	if roles := global.WebSocketConfig().AdminRoles; len(roles) > 0 {
+		return roles
+	}
+	return []string{"admin"}
+}
+
+// ListSessions godoc
+// @Summary 在线用户列表
+// @Description 分页列出所有节点上的在线用户及其设备，cursor为上一页返回的游标
+// @Tags WebSocket管理
+// @Produce json
+// @Param cursor query int false "游标，首页为0"
+// @Param count query int false "每页数量，最多500"
+// @Success 200 {object} SessionPage
+// @Router /admin/ws/sessions [get]
+func (h *AdminHandler) ListSessions(c *gin.Context) {
+	cursor, _ := strconv.ParseUint(c.Query("cursor"), 10, 64)
+	count, _ := strconv.ParseInt(c.Query("count"), 10, 64)
+
+	page, err := h.manager.ListSessions(cursor, count)
+	if err != nil {
+		global.GVA_LOG.Errorf("查询在线用户列表失败: %v", err)
+		audit(c, "list_sessions", "", err, "cursor=%d", cursor)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	audit(c, "list_sessions", "", nil, "cursor=%d, 返回 %d 个用户", cursor, len(page.Users))
+	c.JSON(http.StatusOK, page)
+}
+
+// InspectUser godoc
+// @Summary 查询用户的连接
+// @Description 用户在所有节点上的连接、本节点连接的发送统计以及离线消息数量
+// @Tags WebSocket管理
+// @Produce json
+// @Param id path string true "用户ID"
+// @Success 200 {object} UserDetail
+// @Router /admin/ws/users/{id} [get]
+func (h *AdminHandler) InspectUser(c *gin.Context) {
+	userID := c.Param("id")
+	detail, err := h.manager.InspectUser(userID)
+	if err != nil {
+		global.GVA_LOG.Errorf("查询用户 %s 的连接失败: %v", userID, err)
+		audit(c, "inspect_user", userID, err, "")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	audit(c, "inspect_user", userID, nil, "%d 个连接", len(detail.Sessions))
+	c.JSON(http.StatusOK, detail)
+}
+
+// Disconnect godoc
+// @Summary 强制断开用户的连接
+// @Description 断开用户在所有节点上的连接，指定device_id时只断开该设备。客户端收到关闭码1008，连接使用的token同时被吊销
+// @Tags WebSocket管理
+// @Produce json
+// @Param id path string true "用户ID"
+// @Param device_id query string false "设备ID"
+// @Success 200 {object} map[string]int
+// @Router /admin/ws/users/{id}/sessions [delete]
+func (h *AdminHandler) Disconnect(c *gin.Context) {
+	userID := c.Param("id")
+	deviceID := c.Query("device_id")
+	disconnected, revoked := h.manager.Disconnect(userID, deviceID, "已被管理员断开")
+	audit(c, "disconnect", userID, nil, "device=%s, 断开 %d 个连接, 吊销 %d 个token", deviceID, disconnected, revoked)
+	c.JSON(http.StatusOK, gin.H{"disconnected": disconnected, "revoked": revoked})
+}
+
+// PushSystem godoc
+// @Summary 推送系统消息
+// @Description 推送给指定用户(离线时写入离线存储)、指定分组或所有节点上的在线用户
+// @Tags WebSocket管理
+// @Accept json
+// @Produce json
+// @Param body body SystemPushRequest true "接收者和内容"
+// @Success 200 {object} map[string]interface{}
+// @Router /admin/ws/system [post]
+func (h *AdminHandler) PushSystem(c *gin.Context) {
+	var req SystemPushRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		audit(c, "push_system", "", err, "请求格式错误")
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	targets := 0
+	for _, set := range []bool{req.All, len(req.UserIDs) > 0, len(req.Segments) > 0} {
+		if set {
+			targets++
+		}
+	}
+	if targets != 1 {
+		audit(c, "push_system", "", errInvalidSystemTarget, "")
+		c.JSON(http.StatusBadRequest, gin.H{"error": errInvalidSystemTarget.Error()})
+		return
+	}
+	if len(req.UserIDs) > maxSystemRecipients || len(req.Segments) > maxSystemSegments {
+		audit(c, "push_system", "", errTooManyRecipients, "%d 个用户, %d 个分组", len(req.UserIDs), len(req.Segments))
+		c.JSON(http.StatusBadRequest, gin.H{"error": errTooManyRecipients.Error()})
+		return
+	}
+
+	var (
+		id      string
+		offline int
+		err     error
+		target  = "all"
+	)
+	switch {
+	case len(req.Segments) > 0:
+		target = "segments:" + strings.Join(req.Segments, ",")
+		id, offline, err = h.manager.PushSegments(req.Segments, req.MatchAll, req.Offline, req.Content)
+	case len(req.UserIDs) > 0:
+		target = strings.Join(req.UserIDs, ",")
+		id, err = h.manager.PushSystem(req.UserIDs, req.Content)
+	default:
+		id, err = h.manager.PushSystem(nil, req.Content)
+	}
+	if err != nil {
+		global.GVA_LOG.Errorf("推送系统消息失败: %v", err)
+		audit(c, "push_system", target, err, "消息 %s", id)
+		var payloadErr *PayloadError
+		if errors.As(err, &payloadErr) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": payloadErr.Message, "code": payloadErr.Code})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error(), "id": id})
+		return
+	}
+
+	audit(c, "push_system", target, nil, "消息 %s, 补发离线 %d 人", id, offline)
+	c.JSON(http.StatusOK, gin.H{"id": id, "offline": offline})
+}
+
+// PurgeOffline godoc
+// @Summary 清空用户的离线消息
+// @Tags WebSocket管理
+// @Produce json
+// @Param id path string true "用户ID"
+// @Success 200 {object} map[string]int64
+// @Router /admin/ws/users/{id}/offline [delete]
+func (h *AdminHandler) PurgeOffline(c *gin.Context) {
+	userID := c.Param("id")
+	purged, err := h.manager.PurgeOffline(userID)
+	if err != nil {
+		global.GVA_LOG.Errorf("清空用户 %s 的离线消息失败: %v", userID, err)
+		audit(c, "purge_offline", userID, err, "")
+		status := http.StatusInternalServerError
+		if errors.Is(err, errOfflineStoreDisabled) {
+			status = http.StatusServiceUnavailable
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	audit(c, "purge_offline", userID, nil, "删除 %d 条", purged)
+	c.JSON(http.StatusOK, gin.H{"purged": purged})
+}
+
+// audit 记录管理操作的审计日志，err为nil时结果为成功，否则记录失败原因。
+// 参数错误、执行出错的操作同样记录，被拒绝访问的请求由auditDenied记录
+func audit(c *gin.Context, action, target string, err error, format string, args ...interface{}) {
+	detail := fmt.Sprintf(format, args...)
+	if err != nil {
+		global.GVA_LOG.Warnf("[审计] 管理员 %s (%s) 执行 %s, 对象: %s, 结果: 失败, %s, 原因: %v",
+			utils.GetUserID(c), c.ClientIP(), action, target, detail, err)
+		return
+	}
+	global.GVA_LOG.Infof("[审计] 管理员 %s (%s) 执行 %s, 对象: %s, 结果: 成功, %s",
+		utils.GetUserID(c), c.ClientIP(), action, target, detail)
+}
+
+// auditDenied 记录因角色不符被拒绝的管理请求，需要放在RequireRoles之前
+func auditDenied() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+		if !c.IsAborted() || c.Writer.Status() != http.StatusForbidden {
+			return
+		}
+		role := ""
+		if claims := utils.GetClaims(c); claims != nil {
+			role = claims.Role
+		}
+		audit(c, c.Request.Method+" "+c.FullPath(), c.Param("id"), errAdminForbidden, "role=%s", role)
+	}
+}
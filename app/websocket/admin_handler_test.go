@@ -0,0 +1,144 @@
+package websocket
+
+import (
+	"campus2/app/websocket/model"
+	"campus2/pkg/global"
+	"campus2/pkg/utils"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+)
+
+// newAdminRouter 按InitWebSocketRouter注册路由，private组中以role为当前用户的角色
+func newAdminRouter(m *Manager, role string) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	private := r.Group("", func(c *gin.Context) {
+		c.Set(utils.ClaimsKey, &utils.CustomClaims{
+			Role:             role,
+			RegisteredClaims: jwt.RegisteredClaims{Subject: "admin-1"},
+		})
+	})
+	app := &WebSocketApp{handler: NewHandler(m), adminHandler: NewAdminHandler(m), manager: m}
+	app.InitWebSocketRouter(private, r.Group(""))
+	return r
+}
+
+// serve 发起请求并返回响应
+func serve(r *gin.Engine, method, path string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(method, path, nil))
+	return w
+}
+
+// auditEntries 返回日志中的审计记录
+func auditEntries(hook *test.Hook) []*logrus.Entry {
+	var entries []*logrus.Entry
+	for _, entry := range hook.AllEntries() {
+		if strings.HasPrefix(entry.Message, "[审计]") {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+func TestAdminRolesReloaded(t *testing.T) {
+	m := newTestManager(t)
+	hook := test.NewLocal(global.GVA_LOG)
+	r := newAdminRouter(m, "operator")
+
+	if w := serve(r, http.MethodGet, "/admin/ws/users/u1"); w.Code != http.StatusForbidden {
+		t.Fatalf("默认配置下operator角色应被拒绝，实际状态码为%d", w.Code)
+	}
+	entries := auditEntries(hook)
+	if len(entries) != 1 || entries[0].Level != logrus.WarnLevel || !strings.Contains(entries[0].Message, "role=operator") {
+		t.Fatalf("被拒绝的请求应记录一条失败的审计日志，实际为%v", entries)
+	}
+
+	// 路由注册后修改配置，下一次请求即按新的角色校验
+	global.GVA_CONFIG.WebSocket.AdminRoles = []string{"operator"}
+	if w := serve(r, http.MethodGet, "/admin/ws/users/u1"); w.Code != http.StatusOK {
+		t.Fatalf("热更新adminRoles后operator角色应被允许，实际状态码为%d", w.Code)
+	}
+}
+
+func TestAdminDisconnect(t *testing.T) {
+	m := newTestManager(t)
+	hook := test.NewLocal(global.GVA_LOG)
+	r := newAdminRouter(m, "admin")
+	web, phone := newTestClient(m, "u1", "web"), newTestClient(m, "u1", "phone")
+	for _, c := range []*Client{web, phone} {
+		c.session = &virtualSession{stop: make(chan struct{})}
+		m.clients.Store(c.ID, c)
+	}
+
+	w := serve(r, http.MethodDelete, "/admin/ws/users/u1/sessions?device_id=web")
+	if w.Code != http.StatusOK {
+		t.Fatalf("断开连接应返回200，实际为%d: %s", w.Code, w.Body)
+	}
+	var resp struct {
+		Disconnected int `json:"disconnected"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp.Disconnected != 1 {
+		t.Errorf("应断开1个连接，实际为%d", resp.Disconnected)
+	}
+	select {
+	case <-web.session.stop:
+		if web.session.code != 1008 {
+			t.Errorf("被断开的连接关闭码应为1008，实际为%d", web.session.code)
+		}
+	default:
+		t.Error("指定设备的连接应被断开")
+	}
+	select {
+	case <-phone.session.stop:
+		t.Error("其他设备的连接不应被断开")
+	default:
+	}
+	entries := auditEntries(hook)
+	if len(entries) != 1 || !strings.Contains(entries[0].Message, "disconnect") || !strings.Contains(entries[0].Message, "成功") {
+		t.Errorf("断开连接应记录一条成功的审计日志，实际为%v", entries)
+	}
+}
+
+func TestAdminPurgeOffline(t *testing.T) {
+	t.Run("未启用离线存储", func(t *testing.T) {
+		r := newAdminRouter(newTestManager(t), "admin")
+		if w := serve(r, http.MethodDelete, "/admin/ws/users/u1/offline"); w.Code != http.StatusServiceUnavailable {
+			t.Errorf("未启用离线存储时应返回503，实际为%d", w.Code)
+		}
+	})
+
+	t.Run("Redis", func(t *testing.T) {
+		m, _ := newRedisManager(t)
+		r := newAdminRouter(m, "admin")
+		for _, id := range []string{"m1", "m2"} {
+			data, _ := json.Marshal(model.Message{ID: id, Type: model.MessageTypeChat, From: "u2", Content: "hi", CreatedAt: time.Now()})
+			if err := m.storeOffline("u1", data); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		w := serve(r, http.MethodDelete, "/admin/ws/users/u1/offline")
+		var resp struct {
+			Purged int64 `json:"purged"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		if w.Code != http.StatusOK || resp.Purged != 2 {
+			t.Fatalf("应清空2条离线消息，实际状态码为%d: %s", w.Code, w.Body)
+		}
+		messages, err := m.redisStore.GetOfflineMessages("u1")
+		if err != nil || len(messages) != 0 {
+			t.Errorf("清空后不应再有离线消息，实际为%d条, err=%v", len(messages), err)
+		}
+	})
+}
@@ -0,0 +1,246 @@
+package websocket
+
+import (
+	"campus2/app/websocket/model"
+	"campus2/pkg/global"
+	"context"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	aggKeyPrefix      = "ws:agg:"       // Hash存储窗口内的通知 ws:agg:{接收者}:类型:动态ID，field为发送者(评论为发送者:评论ID)
+	aggOwnerKeyPrefix = "ws:agg:owner:" // 负责在窗口结束时推送摘要的节点 ws:agg:owner:ws:agg:{接收者}:类型:动态ID
+	maxDigestActors   = 3               // 摘要中展示的最近参与用户数
+)
+
+// digestVerbs 各类型通知在摘要文案中的动作
+var digestVerbs = map[string]string{
+	model.MessageTypeLike:    "赞了你的动态",
+	model.MessageTypeCollect: "收藏了你的动态",
+	model.MessageTypeComment: "评论了你的动态",
+}
+
+// undoActions 取消类动作，窗口内尚未推送的对应通知会被撤回
+var undoActions = map[string]string{
+	model.MessageTypeLike:    "unlike",
+	model.MessageTypeCollect: "uncollect",
+}
+
+// aggEvent 窗口内的一条通知
+type aggEvent struct {
+	Nickname string          `json:"nickname,omitempty"`
+	At       int64           `json:"at"` // 毫秒时间戳
+	Message  json.RawMessage `json:"message"`
+}
+
+// localAggregator 未启用Redis时在节点内存中聚合，仅适用于单节点
+type localAggregator struct {
+	mu      sync.Mutex
+	buckets map[string]map[string]aggEvent // map[聚合key]map[field]通知
+}
+
+// aggregates 该类型的通知是否参与聚合
+func aggregates(msgType string) bool {
+	cfg := global.WebSocketConfig().Aggregation
+	if cfg.Disabled {
+		return false
+	}
+	types := cfg.Types
+	if len(types) == 0 {
+		types = []string{model.MessageTypeLike, model.MessageTypeCollect, model.MessageTypeComment}
+	}
+	for _, t := range types {
+		if t == msgType {
+			_, ok := digestVerbs[msgType]
+			return ok
+		}
+	}
+	return false
+}
+
+// aggKey 获取聚合窗口的key。接收者为集群哈希标签，窗口和负责节点的key位于同一个slot，可以在同一个脚本中删除
+func aggKey(userID, msgType, postID string) string {
+	return aggKeyPrefix + "{" + userID + "}:" + msgType + ":" + postID
+}
+
+// notify 推送点赞、收藏、评论通知。参与聚合的通知进入窗口，窗口结束时只有一条则原样推送，
+// 多条则合并为一条摘要；取消点赞、取消收藏撤回窗口内尚未推送的通知，不再单独推送
+func (m *Manager) notify(c *Client, msg *model.Message, data []byte) {
+	if !aggregates(msg.Type) {
+		m.SendToUser(msg.To, data)
+		return
+	}
+	key := aggKey(msg.To, msg.Type, msg.Extra.PostID)
+	field := msg.From
+	if msg.Type == model.MessageTypeComment {
+		field += ":" + msg.Extra.CommentID
+	}
+
+	if undo, ok := undoActions[msg.Type]; ok && msg.Extra.ActionType == undo {
+		m.retract(key, field)
+		return
+	}
+
+	event := aggEvent{Nickname: c.Nickname, At: time.Now().UnixMilli(), Message: data}
+	window := global.WebSocketConfig().Aggregation.GetWindow()
+	flush := func() { m.flushDigest(key, msg.To, msg.Type, msg.Extra.PostID) }
+
+	if m.redisStore != nil {
+		value, err := json.Marshal(event)
+		if err != nil {
+			return
+		}
+		ctx := context.Background()
+		pipe := global.GVA_REDIS.Pipeline()
+		pipe.HSet(ctx, key, field, value)
+		pipe.PExpire(ctx, key, window*3) // 负责的节点崩溃时，下一条通知会连同遗留的通知一起推送
+		owner := pipe.SetNX(ctx, aggOwnerKeyPrefix+key, m.serverID, window*2)
+		if _, err := pipe.Exec(ctx); err != nil {
+			global.GVA_LOG.Errorf("聚合用户 %s 的 %s 通知失败，直接推送: %v", msg.To, msg.Type, err)
+			m.SendToUser(msg.To, data)
+			return
+		}
+		if owner.Val() {
+			time.AfterFunc(window, flush)
+		}
+		return
+	}
+
+	a := &m.aggregator
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.buckets == nil {
+		a.buckets = make(map[string]map[string]aggEvent)
+	}
+	bucket, ok := a.buckets[key]
+	if !ok {
+		bucket = make(map[string]aggEvent)
+		a.buckets[key] = bucket
+		time.AfterFunc(window, flush)
+	}
+	bucket[field] = event
+}
+
+// retract 撤回窗口内尚未推送的通知
+func (m *Manager) retract(key, field string) {
+	if m.redisStore != nil {
+		if err := global.GVA_REDIS.HDel(context.Background(), key, field).Err(); err != nil {
+			global.GVA_LOG.Errorf("撤回通知 %s 失败: %v", key, err)
+		}
+		return
+	}
+	a := &m.aggregator
+	a.mu.Lock()
+	delete(a.buckets[key], field)
+	a.mu.Unlock()
+}
+
+// takeDigestScript 取出窗口内的所有通知并结束窗口，之后的通知开始新的窗口
+var takeDigestScript = redis.NewScript(`
+local items = redis.call('HVALS', KEYS[1])
+redis.call('DEL', KEYS[1], KEYS[2])
+return items
+`)
+
+// flushDigest 窗口结束时推送通知，用户离线时与普通消息一样写入离线存储
+func (m *Manager) flushDigest(key, userID, msgType, postID string) {
+	var events []aggEvent
+	if m.redisStore != nil {
+		items, err := takeDigestScript.Run(context.Background(), global.GVA_REDIS,
+			[]string{key, aggOwnerKeyPrefix + key}).StringSlice()
+		if err != nil {
+			global.GVA_LOG.Errorf("读取用户 %s 的聚合通知失败: %v", userID, err)
+			return
+		}
+		for _, item := range items {
+			var e aggEvent
+			if err := json.Unmarshal([]byte(item), &e); err == nil {
+				events = append(events, e)
+			}
+		}
+	} else {
+		a := &m.aggregator
+		a.mu.Lock()
+		for _, e := range a.buckets[key] {
+			events = append(events, e)
+		}
+		delete(a.buckets, key)
+		a.mu.Unlock()
+	}
+
+	switch len(events) {
+	case 0:
+		return // 窗口内的通知都已撤回
+	case 1:
+		m.SendToUser(userID, events[0].Message)
+		return
+	}
+
+	data, err := json.Marshal(m.digestMessage(userID, msgType, postID, events))
+	if err != nil {
+		return
+	}
+	global.GVA_LOG.Infof("向用户 %s 推送动态 %s 的 %d 条 %s 通知摘要", userID, postID, len(events), msgType)
+	if err := m.SendToUser(userID, data); err != nil {
+		global.GVA_LOG.Errorf("推送通知摘要失败: %v", err)
+	}
+}
+
+// digestMessage 生成摘要消息，extra取最新一条通知的extra，点击后跳转到最新的评论
+func (m *Manager) digestMessage(userID, msgType, postID string, events []aggEvent) model.Message {
+	sort.Slice(events, func(i, j int) bool { return events[i].At > events[j].At })
+
+	var latest model.Message
+	json.Unmarshal(events[0].Message, &latest)
+
+	content := model.DigestContent{Type: msgType, PostID: postID, Total: len(events)}
+	seen := make(map[string]bool)
+	for _, e := range events {
+		var msg model.Message
+		if err := json.Unmarshal(e.Message, &msg); err != nil || seen[msg.From] {
+			continue
+		}
+		seen[msg.From] = true
+		if len(content.Actors) < maxDigestActors {
+			content.Actors = append(content.Actors, model.DigestActor{UserID: msg.From, Nickname: e.Nickname})
+		}
+	}
+	content.Count = len(seen)
+	content.Text = digestText(content)
+
+	return model.Message{
+		ID:        m.nextMessageID(),
+		Type:      model.MessageTypeDigest,
+		Content:   content,
+		From:      latest.From,
+		To:        userID,
+		CreatedAt: time.Now(),
+		Extra:     latest.Extra,
+	}
+}
+
+// digestText 生成摘要文案，如"张三等12人赞了你的动态"，没有昵称时使用用户ID
+func digestText(content model.DigestContent) string {
+	if len(content.Actors) == 0 {
+		return ""
+	}
+	name := content.Actors[0].Nickname
+	if name == "" {
+		name = content.Actors[0].UserID
+	}
+	text := name
+	if content.Count > 1 {
+		text += "等" + strconv.Itoa(content.Count) + "人"
+	}
+	text += digestVerbs[content.Type]
+	if content.Total > content.Count {
+		text += "(共" + strconv.Itoa(content.Total) + "条)"
+	}
+	return text
+}
@@ -0,0 +1,171 @@
+package websocket
+
+import (
+	"campus2/app/websocket/model"
+	"campus2/pkg/global"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// aggregationManagers 分别使用本地聚合和Redis聚合的管理器，窗口足够长，由测试手动结束
+var aggregationManagers = []struct {
+	name  string
+	setup func(t *testing.T) *Manager
+}{
+	{"本地", newTestManager},
+	{"Redis", func(t *testing.T) *Manager {
+		m, _ := newRedisManager(t)
+		return m
+	}},
+}
+
+// interact 模拟sender对u1的动态p1发送一条通知
+func interact(m *Manager, sender, msgType, action, commentID string) {
+	msg := &model.Message{
+		ID: m.nextMessageID(), Type: msgType, From: sender, To: "u1",
+		Extra: model.MessageExtra{PostID: "p1", ActionType: action, CommentID: commentID},
+	}
+	data, _ := json.Marshal(msg)
+	m.notify(newTestClient(m, sender, "d1"), msg, data)
+}
+
+// received 取出接收者收到的所有消息
+func received(c *Client) []model.Message {
+	var messages []model.Message
+	for len(c.Send) > 0 {
+		var msg model.Message
+		json.Unmarshal(<-c.Send, &msg)
+		messages = append(messages, msg)
+	}
+	return messages
+}
+
+func TestAggregation(t *testing.T) {
+	tests := []struct {
+		name    string
+		msgType string
+		events  func(m *Manager)
+		want    string // 期望收到的消息类型，为空时不推送
+		count   int
+		total   int
+	}{
+		{"单条通知原样推送", model.MessageTypeLike, func(m *Manager) {
+			interact(m, "u2", model.MessageTypeLike, "like", "")
+		}, model.MessageTypeLike, 0, 0},
+		{"多条通知合并为摘要", model.MessageTypeLike, func(m *Manager) {
+			interact(m, "u2", model.MessageTypeLike, "like", "")
+			interact(m, "u3", model.MessageTypeLike, "like", "")
+			interact(m, "u4", model.MessageTypeLike, "like", "")
+			interact(m, "u2", model.MessageTypeLike, "like", "") // 同一用户重复点赞只计一次
+		}, model.MessageTypeDigest, 3, 3},
+		{"取消点赞撤回通知", model.MessageTypeLike, func(m *Manager) {
+			interact(m, "u2", model.MessageTypeLike, "like", "")
+			interact(m, "u2", model.MessageTypeLike, "unlike", "")
+		}, "", 0, 0},
+		{"撤回后剩余一条原样推送", model.MessageTypeCollect, func(m *Manager) {
+			interact(m, "u2", model.MessageTypeCollect, "collect", "")
+			interact(m, "u3", model.MessageTypeCollect, "collect", "")
+			interact(m, "u2", model.MessageTypeCollect, "uncollect", "")
+		}, model.MessageTypeCollect, 0, 0},
+		{"同一用户的多条评论分别计数", model.MessageTypeComment, func(m *Manager) {
+			interact(m, "u2", model.MessageTypeComment, "", "c1")
+			interact(m, "u2", model.MessageTypeComment, "", "c2")
+		}, model.MessageTypeDigest, 1, 2},
+	}
+	for _, mm := range aggregationManagers {
+		for _, tt := range tests {
+			t.Run(mm.name+"/"+tt.name, func(t *testing.T) {
+				m := mm.setup(t)
+				global.GVA_CONFIG.WebSocket.Aggregation.Window = "1h"
+				recipient := newTestClient(m, "u1", "d1")
+				m.clients.Store(recipient.ID, recipient)
+
+				tt.events(m)
+				if got := received(recipient); len(got) != 0 {
+					t.Fatalf("窗口结束前不应推送通知，实际为%v", got)
+				}
+				m.flushDigest(aggKey("u1", tt.msgType, "p1"), "u1", tt.msgType, "p1")
+
+				got := received(recipient)
+				if tt.want == "" {
+					if len(got) != 0 {
+						t.Fatalf("不应收到消息，实际为%v", got)
+					}
+					return
+				}
+				if len(got) != 1 || got[0].Type != tt.want {
+					t.Fatalf("应收到1条%s消息，实际为%v", tt.want, got)
+				}
+				if tt.want != model.MessageTypeDigest {
+					return
+				}
+				raw, _ := json.Marshal(got[0].Content)
+				var digest model.DigestContent
+				json.Unmarshal(raw, &digest)
+				if digest.Type != tt.msgType || digest.PostID != "p1" || digest.Count != tt.count || digest.Total != tt.total {
+					t.Fatalf("摘要内容不正确: %+v", digest)
+				}
+				if got[0].Extra.PostID != "p1" || !strings.HasSuffix(digest.Text, digestVerbs[tt.msgType]+tailText(digest)) {
+					t.Fatalf("摘要消息不正确: %+v", got[0])
+				}
+
+				// 窗口结束后开始新的窗口
+				m.flushDigest(aggKey("u1", tt.msgType, "p1"), "u1", tt.msgType, "p1")
+				if got := received(recipient); len(got) != 0 {
+					t.Fatalf("推送后的窗口应为空，实际为%v", got)
+				}
+			})
+		}
+	}
+}
+
+// tailText 摘要文案中通知条数的部分
+func tailText(d model.DigestContent) string {
+	if d.Total > d.Count {
+		return "(共" + strconv.Itoa(d.Total) + "条)"
+	}
+	return ""
+}
+
+func TestDigestText(t *testing.T) {
+	tests := []struct {
+		content model.DigestContent
+		want    string
+	}{
+		{model.DigestContent{}, ""},
+		{model.DigestContent{Type: model.MessageTypeLike, Count: 1, Total: 1, Actors: []model.DigestActor{{UserID: "u2", Nickname: "张三"}}}, "张三赞了你的动态"},
+		{model.DigestContent{Type: model.MessageTypeCollect, Count: 12, Total: 12, Actors: []model.DigestActor{{UserID: "u2"}}}, "u2等12人收藏了你的动态"},
+		{model.DigestContent{Type: model.MessageTypeComment, Count: 2, Total: 5, Actors: []model.DigestActor{{UserID: "u2", Nickname: "李四"}}}, "李四等2人评论了你的动态(共5条)"},
+	}
+	for _, tt := range tests {
+		if got := digestText(tt.content); got != tt.want {
+			t.Errorf("应为%q，实际为%q", tt.want, got)
+		}
+	}
+}
+
+func TestAggregates(t *testing.T) {
+	newTestManager(t)
+	tests := []struct {
+		cfg  []string
+		typ  string
+		want bool
+	}{
+		{nil, model.MessageTypeLike, true},
+		{nil, model.MessageTypeMention, false},
+		{[]string{model.MessageTypeComment}, model.MessageTypeLike, false},
+		{[]string{model.MessageTypeMention}, model.MessageTypeMention, false}, // 没有摘要文案的类型不能聚合
+	}
+	for _, tt := range tests {
+		global.GVA_CONFIG.WebSocket.Aggregation.Types = tt.cfg
+		if got := aggregates(tt.typ); got != tt.want {
+			t.Errorf("配置为%v时%s是否聚合应为%v，实际为%v", tt.cfg, tt.typ, tt.want, got)
+		}
+	}
+	global.GVA_CONFIG.WebSocket.Aggregation.Disabled = true
+	if aggregates(model.MessageTypeLike) {
+		t.Error("关闭聚合后不应聚合")
+	}
+}
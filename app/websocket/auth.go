@@ -0,0 +1,71 @@
+package websocket
+
+import (
+	"campus2/pkg/global"
+	"campus2/pkg/utils"
+	"net/http"
+	"time"
+)
+
+// handshake 握手鉴权的结果
+type handshake struct {
+	claims    *utils.CustomClaims // 请求携带的token的载荷
+	refreshed *utils.CustomClaims // token进入缓冲期时新签发的token，未刷新时为nil
+	header    http.Header         // 升级时需要附带的响应头
+}
+
+// tokenIDs 连接使用的token(jti)及其中最晚的过期时间，管理员断开连接时一并吊销
+func (a *handshake) tokenIDs() ([]string, time.Time) {
+	var (
+		ids       []string
+		expiresAt time.Time
+	)
+	for _, claims := range []*utils.CustomClaims{a.claims, a.refreshed} {
+		if claims == nil || claims.ID == "" {
+			continue
+		}
+		ids = append(ids, claims.ID)
+		if claims.ExpiresAt != nil && claims.ExpiresAt.After(expiresAt) {
+			expiresAt = claims.ExpiresAt.Time
+		}
+	}
+	return ids, expiresAt
+}
+
+// tokenRevoked 连接使用的token是否已被吊销，查询失败时视为未吊销
+func (c *Client) tokenRevoked() bool {
+	for _, id := range c.tokens {
+		revoked, err := utils.IsTokenRevoked(id)
+		if err != nil {
+			global.GVA_LOG.Warnf("检查客户端 %s 的token是否吊销失败: %v", c.ID, err)
+			return false
+		}
+		if revoked {
+			return true
+		}
+	}
+	return false
+}
+
+// authenticate 校验握手请求携带的JWT，返回载荷以及升级时需要附带的响应头。
+// token进入缓冲期时通过new-token/new-expires-at响应头下发新token
+func authenticate(r *http.Request) (*handshake, error) {
+	token, fromProtocol := utils.GetTokenFromRequest(r)
+	if token == "" {
+		return nil, utils.ErrTokenInvalid
+	}
+
+	j := utils.NewJWT()
+	claims, err := j.ValidateToken(token)
+	if err != nil {
+		return nil, err
+	}
+
+	auth := &handshake{claims: claims, header: http.Header{}}
+	if fromProtocol {
+		// 客户端声明了子协议时必须回应其中之一，否则浏览器会直接断开连接
+		auth.header.Set("Sec-WebSocket-Protocol", utils.TokenSubprotocol)
+	}
+	auth.refreshed = j.SetRefreshHeader(auth.header, claims)
+	return auth, nil
+}
@@ -0,0 +1,201 @@
+package websocket
+
+import (
+	"campus2/app/websocket/model"
+	"campus2/pkg/global"
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gorilla/websocket"
+)
+
+// defaultSendBufferSize 发送队列的默认长度，配置未设置时使用
+const defaultSendBufferSize = 256
+
+// 内置的慢消费者处理策略
+const (
+	PolicyDropOldest = "drop_oldest" // 丢弃队列中最早的一条消息，为新消息腾出位置
+	PolicySpill      = "spill"       // 新消息转入离线存储，下次连接时再推送
+	PolicyDisconnect = "disconnect"  // 以1013关闭码断开连接，客户端稍后重连
+)
+
+// SlowConsumerPolicy 客户端发送队列已满时的处理策略。
+// Overflow返回true表示消息已经处理(进入发送队列或已转存)，返回false时由调用方转入离线存储
+type SlowConsumerPolicy interface {
+	Overflow(c *Client, message []byte) bool
+}
+
+var (
+	policiesMu sync.RWMutex
+	policies   = map[string]SlowConsumerPolicy{
+		PolicyDropOldest: dropOldestPolicy{},
+		PolicySpill:      spillPolicy{},
+		PolicyDisconnect: disconnectPolicy{},
+	}
+)
+
+// RegisterSlowConsumerPolicy 注册自定义的慢消费者处理策略，通过websocket.slowConsumerPolicy按名称选用
+func RegisterSlowConsumerPolicy(name string, policy SlowConsumerPolicy) {
+	policiesMu.Lock()
+	defer policiesMu.Unlock()
+	policies[name] = policy
+}
+
+// slowConsumerPolicy 根据配置获取处理策略，未配置或名称无效时使用spill
+func slowConsumerPolicy() SlowConsumerPolicy {
+	name := global.WebSocketConfig().SlowConsumerPolicy
+	policiesMu.RLock()
+	defer policiesMu.RUnlock()
+	if policy, ok := policies[name]; ok {
+		return policy
+	}
+	if name != "" {
+		global.GVA_LOG.Warnf("未知的慢消费者处理策略 %s，使用 %s", name, PolicySpill)
+	}
+	return policies[PolicySpill]
+}
+
+// sendBufferSize 每个连接发送队列的长度
+func sendBufferSize() int {
+	if global.WebSocketConfig().SendBufferSize > 0 {
+		return global.WebSocketConfig().SendBufferSize
+	}
+	return defaultSendBufferSize
+}
+
+// dropOldestPolicy 丢弃最早的消息。需要确认的消息仍在等待确认窗口中，稍后会被重传
+type dropOldestPolicy struct{}
+
+func (dropOldestPolicy) Overflow(c *Client, message []byte) bool {
+	for i := 0; i < 3; i++ {
+		if !c.dropOldest() {
+			return false
+		}
+		c.metrics.dropped.Add(1)
+		if queued, closed := c.enqueue(message); queued {
+			return true
+		} else if closed {
+			return false
+		}
+	}
+	return false
+}
+
+// spillPolicy 将放不进队列的消息转入该用户的离线存储，临时消息直接丢弃
+type spillPolicy struct{}
+
+func (spillPolicy) Overflow(c *Client, message []byte) bool {
+	var h frameHeader
+	if err := json.Unmarshal(message, &h); err == nil && isEphemeral(h.Type) {
+		c.metrics.dropped.Add(1)
+		return true
+	}
+	if err := c.Manager.storeOffline(c.UserID, message); err != nil {
+		global.GVA_LOG.Errorf("客户端 %s 的溢出消息转入离线存储失败: %v", c.ID, err)
+		return false
+	}
+	// 已转入离线存储的消息不再等待确认，避免重复存储
+	c.inflightMu.Lock()
+	delete(c.inflight, h.ID)
+	c.inflightMu.Unlock()
+	c.metrics.spilled.Add(1)
+	return true
+}
+
+// isEphemeral 只推送给在线设备、不写入离线存储的消息类型
+func isEphemeral(msgType string) bool {
+	switch msgType {
+	case model.MessageTypeTyping, model.MessageTypeRead, model.MessageTypePresence, model.MessageTypeError, model.MessageTypeSent, model.MessageTypePong, model.MessageTypeResync:
+		return true
+	}
+	return false
+}
+
+// disconnectPolicy 断开跟不上的连接，未发送的消息由调用方转入离线存储
+type disconnectPolicy struct{}
+
+func (disconnectPolicy) Overflow(c *Client, message []byte) bool {
+	go c.closeWith(websocket.CloseTryAgainLater, "发送队列已满") // 不阻塞发送方
+	return false
+}
+
+// clientMetrics 连接的发送统计
+type clientMetrics struct {
+	queued    atomic.Uint64 // 进入发送队列的消息数
+	overflows atomic.Uint64 // 发送队列已满的次数
+	dropped   atomic.Uint64 // 因队列已满被丢弃的消息数
+	spilled   atomic.Uint64 // 因队列已满转入离线存储的消息数
+
+	rateLimitErrors atomic.Uint64 // 共享限流因Redis出错而降级的次数
+}
+
+// ClientMetrics 连接的发送统计快照
+type ClientMetrics struct {
+	ClientID  string `json:"clientId"`
+	UserID    string `json:"userId"`
+	QueueLen  int    `json:"queueLen"` // 当前发送队列中的消息数
+	QueueCap  int    `json:"queueCap"`
+	Queued    uint64 `json:"queued"`
+	Overflows uint64 `json:"overflows"`
+	Dropped   uint64 `json:"dropped"`
+	Spilled   uint64 `json:"spilled"`
+
+	RateLimitErrors uint64 `json:"rateLimitErrors"`
+}
+
+// Metrics 获取连接的发送统计
+func (c *Client) Metrics() ClientMetrics {
+	return ClientMetrics{
+		ClientID:  c.ID,
+		UserID:    c.UserID,
+		QueueLen:  len(c.Send),
+		QueueCap:  cap(c.Send),
+		Queued:    c.metrics.queued.Load(),
+		Overflows: c.metrics.overflows.Load(),
+		Dropped:   c.metrics.dropped.Load(),
+		Spilled:   c.metrics.spilled.Load(),
+
+		RateLimitErrors: c.metrics.rateLimitErrors.Load(),
+	}
+}
+
+// enqueue 非阻塞地放入发送队列，返回是否放入以及连接是否已关闭
+func (c *Client) enqueue(message []byte) (queued bool, closed bool) {
+	c.sendMu.RLock()
+	defer c.sendMu.RUnlock()
+	if c.sendClosed {
+		return false, true
+	}
+	select {
+	case c.Send <- message:
+		c.metrics.queued.Add(1)
+		return true, false
+	default:
+		return false, false
+	}
+}
+
+// dropOldest 丢弃发送队列中最早的一条消息，连接已关闭时返回false
+func (c *Client) dropOldest() bool {
+	c.sendMu.RLock()
+	defer c.sendMu.RUnlock()
+	if c.sendClosed {
+		return false
+	}
+	select {
+	case <-c.Send:
+	default:
+	}
+	return true
+}
+
+// closeSend 关闭发送队列，可以重复调用
+func (c *Client) closeSend() {
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+	if !c.sendClosed {
+		c.sendClosed = true
+		close(c.Send)
+	}
+}
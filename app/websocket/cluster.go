@@ -0,0 +1,196 @@
+package websocket
+
+import (
+	"campus2/pkg/global"
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// nodeChannelPrefix 每个节点订阅的Redis频道前缀，完整频道为 ws:node:{serverID}
+	nodeChannelPrefix = "ws:node:"
+
+	subscribeRetryMin = time.Second      // 订阅失败后第一次重试的等待时间
+	subscribeRetryMax = 30 * time.Second // 重试等待时间的上限
+)
+
+// 节点间转发的信封类型
+const (
+	envelopeDeliver = "deliver" // 投递给目标节点上的指定用户
+	envelopeKick    = "kick"    // 断开目标节点上指定设备的连接
+	envelopeAck     = "ack"     // 用户已在其他设备上确认消息，目标节点上的设备不再等待确认
+)
+
+// envelope 节点间通过Redis pub/sub转发的信封
+type envelope struct {
+	Kind      string          `json:"kind"`                // 信封类型
+	Origin    string          `json:"origin"`              // 来源节点
+	UserID    string          `json:"userId,omitempty"`    // 目标用户
+	DeviceID  string          `json:"deviceId,omitempty"`  // 目标设备
+	ConnID    string          `json:"connId,omitempty"`    // 目标连接
+	Payload   json.RawMessage `json:"payload,omitempty"`   // 原始消息
+	Ephemeral bool            `json:"ephemeral,omitempty"` // 临时消息，用户已下线时直接丢弃
+	Reason    string          `json:"reason,omitempty"`    // 断开连接的原因
+	MessageID string          `json:"messageId,omitempty"` // 已确认的消息
+}
+
+// nodeChannel 获取指定节点订阅的频道
+func nodeChannel(serverID string) string {
+	return nodeChannelPrefix + serverID
+}
+
+// lookupDevices 查询用户所有在线设备的连接信息
+func (m *Manager) lookupDevices(ctx context.Context, userID string) ([]ConnInfo, error) {
+	data, err := global.GVA_REDIS.HGetAll(ctx, connDevicesKey(userID)).Result()
+	if err != nil {
+		return nil, err
+	}
+	devices := make([]ConnInfo, 0, len(data))
+	for _, item := range data {
+		var info ConnInfo
+		if err := json.Unmarshal([]byte(item), &info); err != nil {
+			continue
+		}
+		devices = append(devices, info)
+	}
+	return devices, nil
+}
+
+// lookupDevice 查询用户指定设备的连接信息，设备不在线时返回nil
+func (m *Manager) lookupDevice(ctx context.Context, userID, deviceID string) (*ConnInfo, error) {
+	data, err := global.GVA_REDIS.HGet(ctx, connDevicesKey(userID), deviceID).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var info ConnInfo
+	if err := json.Unmarshal([]byte(data), &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+// kickRemote 通知连接所在节点断开该连接
+func (m *Manager) kickRemote(info *ConnInfo) {
+	m.publish(info.ServerID, envelope{
+		Kind:     envelopeKick,
+		UserID:   info.UserID,
+		DeviceID: info.DeviceID,
+		ConnID:   info.ConnID,
+	})
+}
+
+// publish 向指定节点发布信封，返回接收到的订阅者数量
+func (m *Manager) publish(serverID string, env envelope) int64 {
+	env.Origin = m.serverID
+	data, err := json.Marshal(env)
+	if err != nil {
+		global.GVA_LOG.Errorf("序列化转发信封失败: %v", err)
+		return 0
+	}
+	receivers, err := global.GVA_REDIS.Publish(context.Background(), nodeChannel(serverID), data).Result()
+	if err != nil {
+		global.GVA_LOG.Errorf("向节点 %s 发布 %s 信封失败: %v", serverID, env.Kind, err)
+		return 0
+	}
+	return receivers
+}
+
+// forwardToNode 将消息转发给用户所在的其他节点。
+// 只有目标节点的订阅者确认收到(PUBLISH返回的接收数大于0)才视为转发成功，
+// 目标节点收到后若用户已下线，由目标节点负责写入离线存储(临时消息除外)
+func (m *Manager) forwardToNode(serverID, userID string, message []byte, ephemeral bool) bool {
+	receivers := m.publish(serverID, envelope{
+		Kind:      envelopeDeliver,
+		UserID:    userID,
+		Payload:   message,
+		Ephemeral: ephemeral,
+	})
+	if receivers == 0 {
+		global.GVA_LOG.Warnf("节点 %s 未确认接收用户 %s 的消息，节点可能已下线", serverID, userID)
+		return false
+	}
+	global.GVA_LOG.Infof("已将用户 %s 的消息转发至节点 %s", userID, serverID)
+	return true
+}
+
+// subscribe 订阅频道并等待订阅确认，失败时按指数退避重试，直到成功或节点开始关闭(返回nil)。
+// 订阅建立后的断线由go-redis自动重连
+func (m *Manager) subscribe(channel string) *redis.PubSub {
+	ctx := context.Background()
+	backoff := subscribeRetryMin
+	for {
+		pubsub := global.GVA_REDIS.Subscribe(ctx, channel)
+		_, err := pubsub.Receive(ctx)
+		if err == nil {
+			return pubsub
+		}
+		pubsub.Close()
+		if m.closing.Load() {
+			return nil
+		}
+		global.GVA_LOG.Errorf("订阅频道 %s 失败，%v 后重试: %v", channel, backoff, err)
+		time.Sleep(backoff)
+		backoff = min(backoff*2, subscribeRetryMax)
+	}
+}
+
+// subscribeNode 订阅本节点频道，处理其他节点转发过来的消息
+func (m *Manager) subscribeNode() {
+	channel := nodeChannel(m.serverID)
+	// 等待订阅确认，保证后续转发的PUBLISH能统计到本节点
+	pubsub := m.subscribe(channel)
+	if pubsub == nil {
+		return
+	}
+	defer pubsub.Close()
+	global.GVA_LOG.Infof("已订阅节点频道: %s", channel)
+	m.trackPubSub(pubsub)
+
+	for msg := range pubsub.Channel() {
+		var env envelope
+		if err := json.Unmarshal([]byte(msg.Payload), &env); err != nil {
+			global.GVA_LOG.Errorf("解析转发信封失败: %v", err)
+			continue
+		}
+		m.handleEnvelope(&env)
+	}
+}
+
+// handleEnvelope 处理其他节点转发过来的信封
+func (m *Manager) handleEnvelope(env *envelope) {
+	switch env.Kind {
+	case envelopeDeliver:
+		global.GVA_LOG.Infof("收到节点 %s 转发给用户 %s 的消息", env.Origin, env.UserID)
+		if !m.deliverLocal(env.UserID, env.Payload) && !env.Ephemeral {
+			// 转发途中用户已断开，转入离线存储
+			if err := m.storeOffline(env.UserID, env.Payload); err != nil {
+				global.GVA_LOG.Errorf("存储转发失败的离线消息失败: %v", err)
+			}
+		}
+	case envelopeKick:
+		m.clients.Range(func(key, value interface{}) bool {
+			client := value.(*Client)
+			if client.ID == env.ConnID {
+				global.GVA_LOG.Infof("节点 %s 要求断开用户 %s 设备 %s 的连接", env.Origin, env.UserID, env.DeviceID)
+				reason := env.Reason
+				if reason == "" {
+					reason = "设备已在其他节点登录"
+				}
+				client.kick(reason)
+				return false
+			}
+			return true
+		})
+	case envelopeAck:
+		m.dropInflight(env.UserID, env.MessageID, nil)
+	default:
+		global.GVA_LOG.Warnf("未知的转发信封类型: %s", env.Kind)
+	}
+}
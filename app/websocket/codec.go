@@ -0,0 +1,112 @@
+package websocket
+
+import (
+	"campus2/app/websocket/model"
+	"campus2/pkg/utils"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/websocket"
+	"github.com/ugorji/go/codec"
+)
+
+// 内置编码对应的子协议
+const (
+	CodecJSON     = "json"
+	CodecMsgpack  = "msgpack"
+	CodecProtobuf = "protobuf"
+)
+
+// Codec 连接的消息编码，握手时通过Sec-WebSocket-Protocol协商。
+// 服务端内部(发送队列、节点转发、离线存储)统一使用JSON，只在读写连接时转换为连接协商的编码，
+// 因此发送方和接收方可以使用不同的编码
+type Codec interface {
+	// FrameType 写入连接时使用的帧类型，websocket.TextMessage或websocket.BinaryMessage
+	FrameType() int
+	Marshal(msg *model.Message) ([]byte, error)
+	Unmarshal(data []byte, msg *model.Message) error
+}
+
+var (
+	codecsMu sync.RWMutex
+	codecs   = map[string]Codec{
+		CodecJSON:     jsonCodec{},
+		CodecMsgpack:  newMsgpackCodec(),
+		CodecProtobuf: protobufCodec{},
+	}
+)
+
+// RegisterCodec 注册自定义编码，客户端在Sec-WebSocket-Protocol中声明name即可选用
+func RegisterCodec(name string, c Codec) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	codecs[name] = c
+}
+
+// negotiateCodec 按客户端声明的顺序选择第一个支持的编码，返回编码和需要回应的子协议。
+// 没有声明编码时使用JSON；token通过子协议传递时回应access_token，否则不回应子协议
+func negotiateCodec(r *http.Request) (Codec, string) {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	offered := websocket.Subprotocols(r)
+	for _, protocol := range offered {
+		if c, ok := codecs[strings.ToLower(protocol)]; ok {
+			return c, protocol
+		}
+	}
+	for _, protocol := range offered {
+		if protocol == utils.TokenSubprotocol {
+			return codecs[CodecJSON], protocol
+		}
+	}
+	return codecs[CodecJSON], ""
+}
+
+// encodeFrame 把发送队列中的JSON消息转换为连接的编码
+func encodeFrame(c Codec, message []byte) ([]byte, error) {
+	if _, ok := c.(jsonCodec); ok {
+		return message, nil
+	}
+	var msg model.Message
+	if err := json.Unmarshal(message, &msg); err != nil {
+		return nil, err
+	}
+	return c.Marshal(&msg)
+}
+
+// jsonCodec 默认编码，文本帧
+type jsonCodec struct{}
+
+func (jsonCodec) FrameType() int { return websocket.TextMessage }
+
+func (jsonCodec) Marshal(msg *model.Message) ([]byte, error) { return json.Marshal(msg) }
+
+func (jsonCodec) Unmarshal(data []byte, msg *model.Message) error { return json.Unmarshal(data, msg) }
+
+// msgpackCodec MessagePack编码，二进制帧。字段名与JSON相同，时间使用timestamp扩展类型(-1)
+type msgpackCodec struct {
+	handle *codec.MsgpackHandle
+}
+
+func newMsgpackCodec() msgpackCodec {
+	h := &codec.MsgpackHandle{}
+	h.WriteExt = true
+	h.RawToString = true
+	h.MapType = reflect.TypeOf(map[string]interface{}(nil)) // 与JSON解析结果一致，便于校验内容
+	return msgpackCodec{handle: h}
+}
+
+func (msgpackCodec) FrameType() int { return websocket.BinaryMessage }
+
+func (c msgpackCodec) Marshal(msg *model.Message) ([]byte, error) {
+	var out []byte
+	err := codec.NewEncoderBytes(&out, c.handle).Encode(msg)
+	return out, err
+}
+
+func (c msgpackCodec) Unmarshal(data []byte, msg *model.Message) error {
+	return codec.NewDecoderBytes(data, c.handle).Decode(msg)
+}
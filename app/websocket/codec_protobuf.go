@@ -0,0 +1,83 @@
+package websocket
+
+import (
+	"campus2/app/websocket/model"
+	"campus2/app/websocket/pb"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+//go:generate protoc -I ../../docs/websocket --go_out=pb --go_opt=paths=source_relative message.proto
+
+// protobufCodec Protobuf编码，二进制帧，消息定义见docs/websocket/message.proto，Go类型由其生成在pb包中。
+// content使用google.protobuf.Value，createdAt为毫秒时间戳
+type protobufCodec struct{}
+
+func (protobufCodec) FrameType() int { return websocket.BinaryMessage }
+
+func (protobufCodec) Marshal(msg *model.Message) ([]byte, error) {
+	m := &pb.Message{
+		Id:          msg.ID,
+		ClientMsgId: msg.ClientMsgID,
+		Type:        msg.Type,
+		From:        msg.From,
+		To:          msg.To,
+		Seq:         msg.Seq,
+	}
+	if msg.Content != nil {
+		value, err := structpb.NewValue(msg.Content)
+		if err != nil {
+			return nil, err
+		}
+		m.Content = value
+	}
+	if !msg.CreatedAt.IsZero() {
+		m.CreatedAt = msg.CreatedAt.UnixMilli()
+	}
+	if msg.Extra != (model.MessageExtra{}) {
+		m.Extra = &pb.Extra{
+			PostId:         msg.Extra.PostID,
+			CommentId:      msg.Extra.CommentID,
+			ActionType:     msg.Extra.ActionType,
+			Url:            msg.Extra.URL,
+			RoomId:         msg.Extra.RoomID,
+			ConversationId: msg.Extra.ConversationID,
+			HistoryId:      msg.Extra.HistoryID,
+		}
+	}
+	return proto.Marshal(m)
+}
+
+func (protobufCodec) Unmarshal(data []byte, msg *model.Message) error {
+	var m pb.Message
+	if err := proto.Unmarshal(data, &m); err != nil {
+		return err
+	}
+	msg.ID = m.GetId()
+	msg.ClientMsgID = m.GetClientMsgId()
+	msg.Type = m.GetType()
+	msg.From = m.GetFrom()
+	msg.To = m.GetTo()
+	msg.Seq = m.GetSeq()
+	if m.Content != nil {
+		msg.Content = m.Content.AsInterface()
+	}
+	if m.CreatedAt != 0 {
+		msg.CreatedAt = time.UnixMilli(m.CreatedAt)
+	}
+	if extra := m.GetExtra(); extra != nil {
+		msg.Extra = model.MessageExtra{
+			PostID:         extra.GetPostId(),
+			CommentID:      extra.GetCommentId(),
+			ActionType:     extra.GetActionType(),
+			URL:            extra.GetUrl(),
+			RoomID:         extra.GetRoomId(),
+			ConversationID: extra.GetConversationId(),
+			HistoryID:      extra.GetHistoryId(),
+		}
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package websocket
+
+import (
+	"campus2/app/websocket/model"
+	"campus2/app/websocket/pb"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+)
+
+func TestCodecRoundTrip(t *testing.T) {
+	createdAt := time.UnixMilli(1700000000123)
+	messages := []model.Message{
+		{Type: model.MessageTypePing},
+		{
+			ID: "m1", ClientMsgID: "c1", Seq: 7, Type: model.MessageTypeChat, Content: "你好",
+			From: "u1", To: "u2", CreatedAt: createdAt,
+			Extra: model.MessageExtra{RoomID: "3", ConversationID: "room:3", HistoryID: 42, URL: "https://example.com"},
+		},
+		{
+			ID: "m2", Type: model.MessageTypeSystem, Content: map[string]interface{}{"title": "公告", "text": "停电通知"},
+			From: systemSender, To: "u2", CreatedAt: createdAt,
+		},
+	}
+	for _, name := range []string{CodecJSON, CodecMsgpack, CodecProtobuf} {
+		c := codecs[name]
+		for _, msg := range messages {
+			t.Run(name+"/"+msg.Type, func(t *testing.T) {
+				data, err := c.Marshal(&msg)
+				if err != nil {
+					t.Fatal(err)
+				}
+				var got model.Message
+				if err := c.Unmarshal(data, &got); err != nil {
+					t.Fatal(err)
+				}
+				if !got.CreatedAt.Equal(msg.CreatedAt) {
+					t.Fatalf("createdAt应为%v，实际为%v", msg.CreatedAt, got.CreatedAt)
+				}
+				got.CreatedAt = msg.CreatedAt
+				if !reflect.DeepEqual(got, msg) {
+					t.Fatalf("解码结果应为%+v，实际为%+v", msg, got)
+				}
+			})
+		}
+	}
+}
+
+func TestEncodeOfflineFrame(t *testing.T) {
+	offline := &model.OfflineMessage{
+		ID: "m1", Type: model.MessageTypeLike, Content: "有新的点赞", From: "u1", To: "u2",
+		Timestamp: time.UnixMilli(1700000000123), Seq: 3, Extra: model.MessageExtra{PostID: "p1"},
+	}
+	data, err := json.Marshal(offline.Message())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{CodecJSON, CodecMsgpack, CodecProtobuf} {
+		t.Run(name, func(t *testing.T) {
+			c := codecs[name]
+			frame, err := encodeFrame(c, data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got model.Message
+			if err := c.Unmarshal(frame, &got); err != nil {
+				t.Fatal(err)
+			}
+			if !got.CreatedAt.Equal(offline.Timestamp) || got.Seq != offline.Seq || got.Extra.PostID != "p1" {
+				t.Fatalf("离线消息转换后丢失了字段: %+v", got)
+			}
+		})
+	}
+}
+
+func TestNegotiateCodec(t *testing.T) {
+	tests := []struct {
+		name      string
+		protocols string
+		codec     Codec
+		reply     string
+	}{
+		{"未声明", "", codecs[CodecJSON], ""},
+		{"按声明顺序选择", "protobuf, msgpack", codecs[CodecProtobuf], "protobuf"},
+		{"忽略大小写", "MsgPack", codecs[CodecMsgpack], "MsgPack"},
+		{"跳过不支持的编码", "cbor, msgpack", codecs[CodecMsgpack], "msgpack"},
+		{"只携带token", "access_token, xxx", codecs[CodecJSON], "access_token"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, _ := http.NewRequest(http.MethodGet, "/ws", nil)
+			if tt.protocols != "" {
+				r.Header.Set("Sec-WebSocket-Protocol", tt.protocols)
+			}
+			c, reply := negotiateCodec(r)
+			if c != tt.codec || reply != tt.reply {
+				t.Fatalf("应选用%T并回应%q，实际为%T %q", tt.codec, tt.reply, c, reply)
+			}
+		})
+	}
+}
+
+func TestProtobufCodecMatchesProto(t *testing.T) {
+	msg := model.Message{
+		ID: "m1", Type: model.MessageTypeChat, Content: map[string]interface{}{"kind": "text", "text": "你好"},
+		From: "u1", CreatedAt: time.UnixMilli(1700000000123), Seq: 9, Extra: model.MessageExtra{PostID: "p1", HistoryID: 5},
+	}
+	data, err := codecs[CodecProtobuf].Marshal(&msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 客户端按message.proto生成的代码解码
+	var got pb.Message
+	if err := proto.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.GetId() != "m1" || got.GetCreatedAt() != 1700000000123 || got.GetSeq() != 9 ||
+		got.GetExtra().GetPostId() != "p1" || got.GetExtra().GetHistoryId() != 5 ||
+		got.GetContent().GetStructValue().GetFields()["text"].GetStringValue() != "你好" {
+		t.Fatalf("按message.proto解码的结果不一致: %v", &got)
+	}
+
+	// 没有额外信息时不写入extra
+	data, _ = codecs[CodecProtobuf].Marshal(&model.Message{Type: model.MessageTypePing})
+	got.Reset()
+	if err := proto.Unmarshal(data, &got); err != nil || got.Extra != nil {
+		t.Fatalf("ping消息不应携带extra: %v, err=%v", &got, err)
+	}
+}
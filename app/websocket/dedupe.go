@@ -0,0 +1,172 @@
+package websocket
+
+import (
+	"campus2/app/websocket/model"
+	"campus2/pkg/global"
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	dedupeKeyPrefix      = "ws:dedupe:" // String存储clientMsgId对应的发送结果 ws:dedupe:{userID}:{clientMsgId}
+	maxClientMsgIDLength = 64           // clientMsgId最大长度
+	localDedupeLimit     = 10000        // 本地去重记录超过该数量时清理过期记录
+)
+
+// localDedupe 未启用Redis时在节点内存中记录发送结果，仅适用于单节点
+type localDedupe struct {
+	mu      sync.Mutex
+	entries map[string]localDedupeEntry
+}
+
+type localDedupeEntry struct {
+	result   model.SentContent
+	expireAt time.Time
+}
+
+// dedupeKey 获取发送结果的key，clientMsgId按用户区分
+func dedupeKey(userID, clientMsgID string) string {
+	return dedupeKeyPrefix + userID + ":" + clientMsgID
+}
+
+// claimClientMsgID 登记本次发送。同一用户在去重窗口内已经发送过该clientMsgId时返回首次发送的结果和true，
+// 调用方应直接回复该结果而不再投递。Redis出错时按首次发送处理
+func (c *Client) claimClientMsgID(msg *model.Message) (*model.SentContent, bool) {
+	result := sentResult(msg)
+	window := global.WebSocketConfig().GetDedupeWindow()
+
+	if c.Manager.redisStore != nil {
+		ctx := context.Background()
+		key := dedupeKey(c.UserID, msg.ClientMsgID)
+		data, err := json.Marshal(result)
+		if err != nil {
+			return nil, false
+		}
+		ok, err := global.GVA_REDIS.SetNX(ctx, key, data, window).Result()
+		if err != nil {
+			global.GVA_LOG.Errorf("登记用户 %s 的消息 %s 失败: %v", c.UserID, msg.ClientMsgID, err)
+			return nil, false
+		}
+		if ok {
+			return nil, false
+		}
+		existing, err := global.GVA_REDIS.Get(ctx, key).Bytes()
+		if err != nil {
+			// 首次发送被拒绝后释放了登记，按首次发送处理
+			if !errors.Is(err, redis.Nil) {
+				global.GVA_LOG.Errorf("读取用户 %s 的消息 %s 的发送结果失败: %v", c.UserID, msg.ClientMsgID, err)
+			}
+			return nil, false
+		}
+		var original model.SentContent
+		if err := json.Unmarshal(existing, &original); err != nil {
+			return nil, false
+		}
+		return &original, true
+	}
+
+	d := &c.Manager.dedupe
+	key := dedupeKey(c.UserID, msg.ClientMsgID)
+	now := time.Now()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.entries == nil {
+		d.entries = make(map[string]localDedupeEntry)
+	}
+	if entry, ok := d.entries[key]; ok && now.Before(entry.expireAt) {
+		original := entry.result
+		return &original, true
+	}
+	if len(d.entries) >= localDedupeLimit {
+		for k, entry := range d.entries {
+			if !now.Before(entry.expireAt) {
+				delete(d.entries, k)
+			}
+		}
+	}
+	d.entries[key] = localDedupeEntry{result: *result, expireAt: now.Add(window)}
+	return nil, false
+}
+
+// releaseClientMsgID 消息被拒绝时释放登记，客户端修正后可以用同一clientMsgId重新发送
+func (c *Client) releaseClientMsgID(msg *model.Message) {
+	key := dedupeKey(c.UserID, msg.ClientMsgID)
+	if c.Manager.redisStore != nil {
+		if err := global.GVA_REDIS.Del(context.Background(), key).Err(); err != nil {
+			global.GVA_LOG.Errorf("释放用户 %s 的消息 %s 失败: %v", c.UserID, msg.ClientMsgID, err)
+		}
+		return
+	}
+	d := &c.Manager.dedupe
+	d.mu.Lock()
+	delete(d.entries, key)
+	d.mu.Unlock()
+}
+
+// confirmSent 消息处理完成后更新发送结果(补充会话和历史消息游标)，并回复发送者
+func (c *Client) confirmSent(msg *model.Message) {
+	result := sentResult(msg)
+	key := dedupeKey(c.UserID, msg.ClientMsgID)
+	if c.Manager.redisStore != nil {
+		if data, err := json.Marshal(result); err == nil {
+			err = global.GVA_REDIS.SetArgs(context.Background(), key, data, redis.SetArgs{Mode: "XX", KeepTTL: true}).Err()
+			if err != nil && !errors.Is(err, redis.Nil) {
+				global.GVA_LOG.Errorf("更新用户 %s 的消息 %s 的发送结果失败: %v", c.UserID, msg.ClientMsgID, err)
+			}
+		}
+	} else {
+		d := &c.Manager.dedupe
+		d.mu.Lock()
+		if entry, ok := d.entries[key]; ok {
+			entry.result = *result
+			d.entries[key] = entry
+		}
+		d.mu.Unlock()
+	}
+	c.replySent(result)
+}
+
+// replySent 向发送消息的连接回复发送结果，发送结果不需要确认
+func (c *Client) replySent(result *model.SentContent) {
+	data, err := json.Marshal(model.Message{
+		Type:      model.MessageTypeSent,
+		Content:   result,
+		To:        c.UserID,
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		return
+	}
+	if !c.deliver(data) {
+		global.GVA_LOG.Warnf("向客户端 %s 回复消息 %s 的发送结果失败", c.ID, result.ClientMsgID)
+	}
+}
+
+// reject 拒绝已登记的消息：返回错误消息并释放clientMsgId的登记
+func (c *Client) reject(code int, message string, msg *model.Message) {
+	if tracksClientMsgID(msg) {
+		c.releaseClientMsgID(msg)
+	}
+	c.sendError(code, message, msg, 0)
+}
+
+// tracksClientMsgID 只有分配了服务端消息ID的消息按clientMsgId去重
+func tracksClientMsgID(msg *model.Message) bool {
+	return msg.ClientMsgID != "" && needsMessageID(msg.Type)
+}
+
+// sentResult 根据已分配ID的消息生成发送结果
+func sentResult(msg *model.Message) *model.SentContent {
+	return &model.SentContent{
+		ClientMsgID:    msg.ClientMsgID,
+		ID:             msg.ID,
+		CreatedAt:      msg.CreatedAt,
+		ConversationID: msg.Extra.ConversationID,
+		HistoryID:      msg.Extra.HistoryID,
+	}
+}
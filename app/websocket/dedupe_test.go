@@ -0,0 +1,91 @@
+package websocket
+
+import (
+	"campus2/app/websocket/model"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestClaimClientMsgID(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(t *testing.T) *Manager
+	}{
+		{"本地", newTestManager},
+		{"Redis", func(t *testing.T) *Manager {
+			m, _ := newRedisManager(t)
+			return m
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := tt.setup(t)
+			c := newTestClient(m, "u1", "d1")
+			first := &model.Message{Type: model.MessageTypeChat, ClientMsgID: "c1", ID: "m1", CreatedAt: time.Now()}
+			if _, dup := c.claimClientMsgID(first); dup {
+				t.Fatal("首次发送不应被判定为重复")
+			}
+
+			retry := &model.Message{Type: model.MessageTypeChat, ClientMsgID: "c1", ID: "m2"}
+			original, dup := c.claimClientMsgID(retry)
+			if !dup || original.ID != "m1" {
+				t.Fatalf("应判定为m1的重复发送，实际为%v %v", original, dup)
+			}
+
+			// 同一clientMsgId对其他用户不算重复
+			if _, dup := newTestClient(m, "u2", "d1").claimClientMsgID(retry); dup {
+				t.Fatal("其他用户的同一clientMsgId不应被判定为重复")
+			}
+
+			// 持久化后补充的游标在重复发送时一并返回
+			first.Extra.HistoryID = 42
+			c.confirmSent(first)
+			original, _ = c.claimClientMsgID(retry)
+			if original.HistoryID != 42 {
+				t.Fatalf("应返回持久化后的historyId 42，实际为%d", original.HistoryID)
+			}
+
+			// 被拒绝的消息释放登记后可以重新发送
+			c.reject(model.ErrorCodeInvalidPayload, "invalid", first)
+			if _, dup := c.claimClientMsgID(retry); dup {
+				t.Fatal("已释放的clientMsgId不应被判定为重复")
+			}
+		})
+	}
+}
+
+func TestConfirmSentReplies(t *testing.T) {
+	m := newTestManager(t)
+	c := newTestClient(m, "u1", "d1")
+	msg := &model.Message{Type: model.MessageTypeChat, ClientMsgID: "c1", ID: "m1", CreatedAt: time.Now()}
+	c.claimClientMsgID(msg)
+	c.confirmSent(msg)
+
+	var frame struct {
+		Type    string            `json:"type"`
+		Content model.SentContent `json:"content"`
+	}
+	if err := json.Unmarshal(<-c.Send, &frame); err != nil {
+		t.Fatal(err)
+	}
+	if frame.Type != model.MessageTypeSent || frame.Content.ClientMsgID != "c1" || frame.Content.ID != "m1" {
+		t.Fatalf("发送结果不正确: %+v", frame)
+	}
+}
+
+func TestTracksClientMsgID(t *testing.T) {
+	tests := []struct {
+		msg  model.Message
+		want bool
+	}{
+		{model.Message{Type: model.MessageTypeChat, ClientMsgID: "c1"}, true},
+		{model.Message{Type: model.MessageTypeChat}, false},
+		{model.Message{Type: model.MessageTypeTyping, ClientMsgID: "c1"}, false},
+	}
+	for _, tt := range tests {
+		if got := tracksClientMsgID(&tt.msg); got != tt.want {
+			t.Errorf("clientMsgId为%q的%s消息是否去重应为%v，实际为%v", tt.msg.ClientMsgID, tt.msg.Type, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,269 @@
+package websocket
+
+import (
+	"campus2/pkg/global"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// 客户端的传输方式
+const (
+	TransportWebSocket = "websocket"
+	TransportSSE       = "sse"  // Server-Sent Events下行，POST /poll上行
+	TransportPoll      = "poll" // 长轮询下行，POST /poll上行
+)
+
+const (
+	defaultPollWait = 25 * time.Second // 长轮询没有消息时的默认等待时间
+	maxPollWait     = 55 * time.Second
+	maxPollBatch    = 100 // 每次轮询最多返回的消息数
+)
+
+// virtualSession SSE和轮询会话的状态。这类会话没有WebSocket连接，
+// 以stop代替连接关闭，会话结束后由watchSession向Manager注销
+type virtualSession struct {
+	mu       sync.Mutex // 串行处理上行消息和心跳，handleFrame中的状态只允许一个协程访问
+	stop     chan struct{}
+	stopOnce sync.Once
+	code     int    // 结束会话的关闭码，与WebSocket关闭码含义相同
+	reason   string // 结束会话的原因
+}
+
+// PollResponse 长轮询的响应
+type PollResponse struct {
+	Session  string            `json:"session"`  // 会话ID，后续轮询和上行消息都需要携带
+	Messages []json.RawMessage `json:"messages"` // 按推送顺序排列的消息
+}
+
+// endSession 结束SSE或轮询会话，可以重复调用
+func (c *Client) endSession(code int, reason string) {
+	c.session.stopOnce.Do(func() {
+		c.session.code = code
+		c.session.reason = reason
+		close(c.session.stop)
+	})
+}
+
+// watchSession 会话结束后注销，与WebSocket连接的读取协程退出时注销相对应
+func (c *Client) watchSession() {
+	<-c.session.stop
+	global.GVA_LOG.Infof("客户端 %s 的%s会话结束: %s", c.ID, c.Transport, c.session.reason)
+	c.Manager.unregister <- c
+}
+
+// touchSession 收到客户端请求时更新心跳时间
+func (c *Client) touchSession() {
+	c.session.mu.Lock()
+	c.touch()
+	c.session.mu.Unlock()
+}
+
+// openSession 创建并注册SSE或轮询会话
+func (h *Handler) openSession(c *gin.Context, transport, resumeFrom string) (*Client, bool) {
+	if !checkOrigin(c.Request) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "不允许的来源"})
+		return nil, false
+	}
+	auth, ok := h.admit(c)
+	if !ok {
+		return nil, false
+	}
+	// 只下发续期的token，子协议只对WebSocket有意义
+	for _, key := range []string{"new-token", "new-expires-at"} {
+		if value := auth.header.Get(key); value != "" {
+			c.Header(key, value)
+		}
+	}
+
+	client := h.newClient(c, auth, transport)
+	client.session = &virtualSession{stop: make(chan struct{})}
+	h.start(c, client, resumeFrom)
+	go client.watchSession()
+	return client, true
+}
+
+// lookupSession 查找当前用户在本节点上的SSE或轮询会话，失败时直接写入响应。
+// 会话只存在于创建它的节点上，多节点部署时负载均衡需要按session参数保持粘性
+func (h *Handler) lookupSession(c *gin.Context) (*Client, bool) {
+	auth, ok := h.admit(c)
+	if !ok {
+		return nil, false
+	}
+	claims := auth.claims
+	if v, found := h.manager.clients.Load(c.Query("session")); found {
+		client := v.(*Client)
+		if client.session != nil && client.UserID == claims.Subject {
+			return client, true
+		}
+	}
+	c.JSON(http.StatusGone, gin.H{"error": "会话不存在或已过期，请重新建立"})
+	return nil, false
+}
+
+// HandleSSE 以Server-Sent Events推送消息，适用于无法使用WebSocket的网络和旧版WebView。
+// 第一个事件为session，携带上行消息需要的会话ID；消息事件的id为消息序号，断线重连时浏览器通过Last-Event-ID自动续传
+func (h *Handler) HandleSSE(c *gin.Context) {
+	resumeFrom := c.Query("resume_from")
+	if resumeFrom == "" {
+		resumeFrom = c.GetHeader("Last-Event-ID")
+	}
+	client, ok := h.openSession(c, TransportSSE, resumeFrom)
+	if !ok {
+		return
+	}
+
+	w := c.Writer
+	rc := http.NewResponseController(w)
+	// 服务端的写超时不适用于长连接，改为每次写入单独设置期限
+	rc.SetWriteDeadline(time.Time{})
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no") // 关闭nginx的响应缓冲
+	w.WriteHeader(http.StatusOK)
+
+	write := func(event string) bool {
+		rc.SetWriteDeadline(time.Now().Add(writeWait))
+		if _, err := io.WriteString(w, event); err != nil {
+			return false
+		}
+		return rc.Flush() == nil
+	}
+
+	session, _ := json.Marshal(gin.H{"session": client.ID, "heartbeat": int(heartbeatInterval().Seconds())})
+	if !write("event: session\ndata: " + string(session) + "\n\n") {
+		client.closeWith(websocket.CloseAbnormalClosure, "写入失败")
+		return
+	}
+
+	ticker := time.NewTicker(heartbeatInterval())
+	defer ticker.Stop()
+	for {
+		select {
+		case message, ok := <-client.Send:
+			if !ok {
+				return
+			}
+			var header frameHeader
+			event := "data: " + string(message) + "\n\n"
+			if err := json.Unmarshal(message, &header); err == nil && header.Seq != 0 {
+				event = "id: " + strconv.FormatUint(header.Seq, 10) + "\n" + event
+			}
+			if !write(event) {
+				global.GVA_LOG.Warnf("客户端 %s 的SSE写入失败", client.ID)
+				client.closeWith(websocket.CloseAbnormalClosure, "写入失败")
+				return
+			}
+		case <-ticker.C:
+			// 注释行作为心跳，写入成功说明连接仍然可用
+			if !write(": ping\n\n") {
+				client.closeWith(websocket.CloseAbnormalClosure, "写入失败")
+				return
+			}
+			client.touchSession()
+		case <-client.session.stop:
+			closing, _ := json.Marshal(gin.H{"code": client.session.code, "reason": client.session.reason})
+			write("event: close\ndata: " + string(closing) + "\n\n")
+			return
+		case <-c.Request.Context().Done():
+			client.closeWith(websocket.CloseGoingAway, "客户端断开")
+			return
+		}
+	}
+}
+
+// HandlePoll 长轮询。不带session时建立新会话并立即返回会话ID；
+// 带session时等待最多wait秒(默认25)，有消息时立即返回，超时返回空列表
+func (h *Handler) HandlePoll(c *gin.Context) {
+	if c.Query("session") == "" {
+		client, ok := h.openSession(c, TransportPoll, c.Query("resume_from"))
+		if !ok {
+			return
+		}
+		c.JSON(http.StatusOK, PollResponse{Session: client.ID, Messages: client.drain(nil)})
+		return
+	}
+
+	client, ok := h.lookupSession(c)
+	if !ok {
+		return
+	}
+	client.touchSession()
+
+	wait := defaultPollWait
+	if seconds, err := strconv.Atoi(c.Query("wait")); err == nil && seconds >= 0 {
+		wait = time.Duration(seconds) * time.Second
+	}
+	if wait > maxPollWait {
+		wait = maxPollWait
+	}
+	http.NewResponseController(c.Writer).SetWriteDeadline(time.Now().Add(wait + writeWait))
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	var messages []json.RawMessage
+	select {
+	case message, ok := <-client.Send:
+		if !ok {
+			c.JSON(http.StatusGone, gin.H{"error": "会话已结束"})
+			return
+		}
+		messages = client.drain([]json.RawMessage{message})
+	case <-client.session.stop:
+		c.JSON(http.StatusGone, gin.H{"error": fmt.Sprintf("会话已结束(%d): %s", client.session.code, client.session.reason)})
+		return
+	case <-timer.C:
+		messages = []json.RawMessage{}
+	case <-c.Request.Context().Done():
+		return
+	}
+	// 长时间等待后再更新一次心跳，避免刚返回就被判定为超时
+	client.touchSession()
+	c.JSON(http.StatusOK, PollResponse{Session: client.ID, Messages: messages})
+}
+
+// HandlePollSend 上行消息，请求体与WebSocket消息相同(JSON)，处理结果(发送结果、错误)通过下行推送
+func (h *Handler) HandlePollSend(c *gin.Context) {
+	client, ok := h.lookupSession(c)
+	if !ok {
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxMessageSize()))
+	if err != nil {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "消息过大"})
+		return
+	}
+
+	client.session.mu.Lock()
+	client.touch()
+	client.handleFrame(body)
+	client.session.mu.Unlock()
+	c.Status(http.StatusAccepted)
+}
+
+// drain 非阻塞地取出发送队列中的消息，最多maxPollBatch条
+func (c *Client) drain(messages []json.RawMessage) []json.RawMessage {
+	if messages == nil {
+		messages = []json.RawMessage{}
+	}
+	for len(messages) < maxPollBatch {
+		select {
+		case message, ok := <-c.Send:
+			if !ok {
+				return messages
+			}
+			messages = append(messages, message)
+		default:
+			return messages
+		}
+	}
+	return messages
+}
@@ -5,19 +5,15 @@ import (
 	"campus2/pkg/global"
 	"encoding/json"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
 )
 
-var upgrader = websocket.Upgrader{
-	ReadBufferSize:  1024,
-	WriteBufferSize: 1024,
-	CheckOrigin: func(r *http.Request) bool {
-		return true // 允许所有来源
-	},
-}
+// maxDeviceIDLength 设备ID最大长度
+const maxDeviceIDLength = 64
 
 // Handler WebSocket处理器
 type Handler struct {
@@ -31,60 +27,167 @@ func NewHandler(manager *Manager) *Handler {
 
 // HandleWebSocket 处理WebSocket连接
 func (h *Handler) HandleWebSocket(c *gin.Context) {
-	userID := c.Query("user_id") // 从查询参数获取用户ID
-	if userID == "" {
-		global.GVA_LOG.Error("用户ID为空，连接失败")
-		c.JSON(http.StatusBadRequest, gin.H{"error": "missing user_id"})
+	auth, ok := h.admit(c)
+	if !ok {
 		return
 	}
-	global.GVA_LOG.Info("开始处理WebSocket连接，获取userID:", userID)
 
-	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	codec, protocol := negotiateCodec(c.Request)
+	if protocol != "" {
+		auth.header.Set("Sec-WebSocket-Protocol", protocol)
+	} else {
+		auth.header.Del("Sec-WebSocket-Protocol")
+	}
+
+	conn, err := newUpgrader().Upgrade(c.Writer, c.Request, auth.header)
 	if err != nil {
 		global.GVA_LOG.Errorf("协议升级失败: %v", err)
 		return
 	}
 	global.GVA_LOG.Info("成功将http协议升级为ws协议")
 
+	client := h.newClient(c, auth, TransportWebSocket)
+	client.codec = codec
+	client.Socket = conn
+	h.start(c, client, c.Query("resume_from"))
+
+	// 启动读写goroutine
+	global.GVA_LOG.Infof("启动客户端 %s 的读写协程", client.ID)
+	go client.writePump()
+	go client.readPump()
+}
+
+// admit 校验服务状态和请求携带的JWT，失败时直接写入响应
+func (h *Handler) admit(c *gin.Context) (*handshake, bool) {
+	if h.manager.closing.Load() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "服务器正在关闭"})
+		return nil, false
+	}
+	auth, err := authenticate(c.Request)
+	if err != nil {
+		global.GVA_LOG.Warnf("WebSocket握手鉴权失败: %v", err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	return auth, true
+}
+
+// newClient 根据握手请求创建客户端，默认使用JSON编码
+func (h *Handler) newClient(c *gin.Context, auth *handshake, transport string) *Client {
+	claims := auth.claims
+	userID := claims.Subject // 以token中经过校验的subject作为用户ID
+	deviceID := getDeviceID(c)
+	global.GVA_LOG.Infof("开始处理%s连接，获取userID: %s, deviceID: %s", transport, userID, deviceID)
+
 	client := &Client{
-		ID:       userID + ":" + time.Now().String(),
-		UserID:   userID,
-		Socket:   conn,
-		Send:     make(chan []byte, 256),
-		Manager:  h.manager,
-		LastPing: time.Now(),
+		ID:        userID + ":" + deviceID + ":" + strconv.FormatInt(time.Now().UnixNano(), 36),
+		UserID:    userID,
+		DeviceID:  deviceID,
+		Role:      claims.Role,
+		Nickname:  claims.Nickname,
+		Transport: transport,
+		segments:  connSegments(claims, c.Query("tags")),
+		codec:     codecs[CodecJSON],
+		Send:      make(chan []byte, sendBufferSize()),
+		Manager:   h.manager,
+		inflight:  make(map[string]*inflightFrame),
+		done:      make(chan struct{}),
+		// 注册时会写入连接信息，第一次心跳刷新从现在开始计时
+		refreshedAt: time.Now(),
 	}
+	client.tokens, client.tokensExpireAt = auth.tokenIDs()
+	client.lastPing.Store(time.Now().UnixMilli())
 	global.GVA_LOG.Infof("创建新的客户端: %s", client.ID)
+	return client
+}
 
+// start 注册客户端并推送断开期间的消息，所有传输方式共用
+func (h *Handler) start(c *gin.Context, client *Client, resumeFrom string) {
+	// 续传完成前到达的实时消息先暂存，避免与重放的消息重复或乱序
+	client.resuming.Store(resumeFrom != "")
 	h.manager.register <- client
 	global.GVA_LOG.Infof("向WebSocket管理器注册客户端:%v", client.ID)
 
-	// 只有在启用存储时才获取离线消息
-	if h.manager.redisStore != nil {
-		messages, err := h.manager.redisStore.GetOfflineMessages(userID)
+	// 换机或重连的设备补齐缺失的聊天记录
+	client.syncHistory(c.Query("history_after"))
+
+	// 重连时续传断开期间的消息，已续传的消息不再作为离线消息推送
+	resumed := client.resume(resumeFrom)
+	client.releaseLive(resumed)
+
+	go client.retransmitLoop()
+	// 离线消息在后台读取，Kafka读取较慢时不阻塞连接
+	go client.pushOffline(resumed)
+}
+
+// pushOffline 推送离线消息。消息在客户端确认后才标记为已读，未确认的消息下次连接时重新推送。
+// 序号不大于resumed的消息已经通过续传推送，直接标记为已读
+func (c *Client) pushOffline(resumed uint64) {
+	offlineStore := c.Manager.offlineStore()
+	if offlineStore == nil {
+		return
+	}
+	messages, err := offlineStore.GetOfflineMessages(c.UserID)
+	if err != nil {
+		global.GVA_LOG.Errorf("获取离线消息失败: %v", err)
+		return
+	}
+	global.GVA_LOG.Infof("获取到 %d 条离线消息", len(messages))
+	for _, msg := range messages {
+		select {
+		case <-c.done:
+			return // 连接已断开，剩余消息仍保留在离线存储中
+		default:
+		}
+		if msg.Seq != 0 && msg.Seq <= resumed {
+			c.Manager.markRead(c.UserID, msg.ID)
+			continue
+		}
+		// 转换为在线消息的格式，二进制编码按createdAt字段编码发送时间
+		data, err := json.Marshal(msg.Message())
 		if err != nil {
-			global.GVA_LOG.Errorf("获取离线消息失败: %v", err)
-		} else {
-			global.GVA_LOG.Infof("获取到 %d 条离线消息", len(messages))
-			for _, msg := range messages {
-				data, err := json.Marshal(msg)
-				if err != nil {
-					continue
-				}
-				client.Send <- data
-			}
+			continue
+		}
+		if !c.deliver(data) {
+			// 发送队列或确认窗口已满，放回离线存储等待下次连接
+			c.Manager.storeOffline(c.UserID, data)
 		}
 	}
+}
 
-	// 启动读写goroutine
-	global.GVA_LOG.Infof("启动客户端 %s 的读写协程", client.ID)
-	go client.writePump()
-	go client.readPump()
+// getDeviceID 获取握手时声明的设备ID，未声明时为本次连接生成一个临时设备ID
+func getDeviceID(c *gin.Context) string {
+	deviceID := c.Query("device_id")
+	if deviceID == "" {
+		deviceID = c.GetHeader("X-Device-ID")
+	}
+	if deviceID == "" || len(deviceID) > maxDeviceIDLength {
+		deviceID = "anon-" + strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return deviceID
+}
+
+// kick 以1008关闭码断开连接，用于设备被新连接取代
+func (c *Client) kick(reason string) {
+	c.closeWith(websocket.ClosePolicyViolation, reason)
+}
+
+// closeWith 向客户端发送关闭帧并断开连接，读取协程随后会完成注销
+func (c *Client) closeWith(code int, reason string) {
+	if c.Socket == nil {
+		c.endSession(code, reason)
+		return
+	}
+	msg := websocket.FormatCloseMessage(code, reason)
+	if err := c.Socket.WriteControl(websocket.CloseMessage, msg, time.Now().Add(writeWait)); err != nil {
+		global.GVA_LOG.Warnf("向客户端 %s 发送关闭帧失败: %v", c.ID, err)
+	}
+	c.Socket.Close()
 }
 
 // writePump 处理向客户端写入消息
 func (c *Client) writePump() {
-	ticker := time.NewTicker(time.Second * time.Duration(global.GVA_CONFIG.WebSocket.HeartbeatTime))
+	ticker := time.NewTicker(heartbeatInterval())
 	defer func() {
 		global.GVA_LOG.Infof("客户端 %s 的写入协程结束", c.ID)
 		ticker.Stop()
@@ -96,16 +199,24 @@ func (c *Client) writePump() {
 		case message, ok := <-c.Send:
 			if !ok {
 				global.GVA_LOG.Infof("客户端 %s 的发送通道已关闭", c.ID)
+				c.Socket.SetWriteDeadline(time.Now().Add(writeWait))
 				c.Socket.WriteMessage(websocket.CloseMessage, []byte{})
 				return
 			}
 
-			w, err := c.Socket.NextWriter(websocket.TextMessage)
+			frame, err := encodeFrame(c.codec, message)
+			if err != nil {
+				global.GVA_LOG.Errorf("客户端 %s 的消息编码失败: %v", c.ID, err)
+				continue
+			}
+			c.Socket.SetWriteDeadline(time.Now().Add(writeWait))
+			c.applyWriteCompression(len(frame))
+			w, err := c.Socket.NextWriter(c.codec.FrameType())
 			if err != nil {
 				global.GVA_LOG.Errorf("客户端 %s 创建消息写入器失败: %v", c.ID, err)
 				return
 			}
-			w.Write(message)
+			w.Write(frame)
 
 			if err := w.Close(); err != nil {
 				global.GVA_LOG.Errorf("客户端 %s 关闭消息写入器失败: %v", c.ID, err)
@@ -113,6 +224,7 @@ func (c *Client) writePump() {
 			}
 			global.GVA_LOG.Infof("客户端 %s 成功发送消息", c.ID)
 		case <-ticker.C:
+			c.Socket.SetWriteDeadline(time.Now().Add(writeWait))
 			if err := c.Socket.WriteMessage(websocket.PingMessage, nil); err != nil {
 				global.GVA_LOG.Errorf("客户端 %s 发送心跳包失败: %v", c.ID, err)
 				return
@@ -130,10 +242,15 @@ func (c *Client) readPump() {
 		c.Socket.Close()
 	}()
 
-	c.Socket.SetReadLimit(int64(global.GVA_CONFIG.WebSocket.ReadBufferSize))
-	global.GVA_LOG.Infof("设置客户端 %s 的读取缓冲区大小为 %d", c.ID, global.GVA_CONFIG.WebSocket.ReadBufferSize)
+	// 超过期限没有收到任何数据时ReadMessage返回错误，半开连接随之注销
+	c.touch()
+	c.Socket.SetPongHandler(func(string) error {
+		c.touch()
+		return nil
+	})
 
 	for {
+		c.Socket.SetReadLimit(maxMessageSize()) // 每条消息前重新读取，修改配置后已有连接也生效
 		_, message, err := c.Socket.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
@@ -141,69 +258,163 @@ func (c *Client) readPump() {
 			}
 			break
 		}
+		c.touch()
+		c.handleFrame(message)
+	}
+}
 
-		// 处理收到的消息
-		var msg model.Message
-		if err := json.Unmarshal(message, &msg); err != nil {
-			global.GVA_LOG.Errorf("客户端 %s 解析消息失败: %v", c.ID, err)
-			continue
+// handleFrame 解码并处理客户端发来的一条消息，WebSocket连接和SSE/轮询的上行接口共用
+func (c *Client) handleFrame(message []byte) {
+	var msg model.Message
+	if err := c.codec.Unmarshal(message, &msg); err != nil {
+		global.GVA_LOG.Errorf("客户端 %s 解析消息失败: %v", c.ID, err)
+		// 无法解析的消息计入合计限流，避免错误回复被刷屏
+		if ok, retryAfter := c.allow(""); !ok {
+			c.throttle(&msg, retryAfter)
+		} else {
+			c.sendError(model.ErrorCodeBadFrame, "消息格式错误，无法按协商的编码解析", nil, 0)
 		}
+		return
+	}
 
-		msg.From = c.UserID // 设置发送者ID
-		msg.CreatedAt = time.Now()
-
-		global.GVA_LOG.Infof("收到客户端 %s 的消息: type=%s, from=%s, to=%s", c.ID, msg.Type, msg.From, msg.To)
-
-		// 根据消息类型处理
-		switch msg.Type {
-		case model.MessageTypeChat:
-			// 处理聊天消息
-			if msg.To != "" {
-				global.GVA_LOG.Infof("客户端 %s 发送私聊消息给用户 %s", c.ID, msg.To)
-				data, _ := json.Marshal(msg)
-				c.Manager.SendToUser(msg.To, data)
-			} else {
-				global.GVA_LOG.Info("客户端 %s 发送广播消息", c.ID)
-				data, _ := json.Marshal(msg)
-				c.Manager.broadcast <- data
-			}
+	// 确认消息不限流，其余消息按用户和类型检查令牌桶
+	if msg.Type != model.MessageTypeAck {
+		if ok, retryAfter := c.allow(msg.Type); !ok {
+			c.throttle(&msg, retryAfter)
+			return
+		}
+	}
 
-		case model.MessageTypeLike:
-			// 处理点赞通知
-			if msg.Extra.PostID != "" {
-				global.GVA_LOG.Infof("用户 %s 点赞了动态 %s", c.UserID, msg.Extra.PostID)
-				data, _ := json.Marshal(msg)
-				c.Manager.SendToUser(msg.To, data)
-			}
+	// 按消息类型校验内容，不通过时返回错误消息而不是静默丢弃
+	if msg.Type == model.MessageTypeSystem {
+		c.sendError(model.ErrorCodeForbidden, "系统消息只能由服务端发送", &msg, 0)
+		return
+	}
+	if err := validatePayload(&msg); err != nil {
+		global.GVA_LOG.Warnf("客户端 %s 的 %s 消息校验失败: %v", c.ID, msg.Type, err)
+		c.sendError(err.Code, err.Message, &msg, 0)
+		return
+	}
 
-		case model.MessageTypeCollect:
-			// 处理收藏通知
-			if msg.Extra.PostID != "" {
-				global.GVA_LOG.Infof("用户 %s 收藏了动态 %s", c.UserID, msg.Extra.PostID)
-				data, _ := json.Marshal(msg)
-				c.Manager.SendToUser(msg.To, data)
-			}
+	msg.From = c.UserID // 设置发送者ID
+	msg.Seq = 0         // 序号由服务端按接收者分配
+	msg.CreatedAt = time.Now()
+	if needsMessageID(msg.Type) {
+		msg.ID = c.Manager.nextMessageID() // 分配服务端消息ID，忽略客户端传入的值
+	}
 
-		case model.MessageTypeComment:
-			// 处理评论通知
-			if msg.Extra.PostID != "" {
-				global.GVA_LOG.Infof("用户 %s 评论了动态 %s", c.UserID, msg.Extra.PostID)
-				data, _ := json.Marshal(msg)
-				c.Manager.SendToUser(msg.To, data)
-			}
+	// 重连后重发的消息不再投递，直接返回首次发送的结果
+	tracked := tracksClientMsgID(&msg)
+	if tracked {
+		if original, duplicate := c.claimClientMsgID(&msg); duplicate {
+			global.GVA_LOG.Infof("客户端 %s 重复发送消息 %s，返回首次发送的结果 %s", c.ID, msg.ClientMsgID, original.ID)
+			original.Duplicate = true
+			c.replySent(original)
+			return
+		}
+	}
+
+	global.GVA_LOG.Infof("收到客户端 %s 的消息: type=%s, from=%s, to=%s", c.ID, msg.Type, msg.From, msg.To)
 
-		case model.MessageTypeMention:
-			// 处理@通知
-			if msg.To != "" {
-				global.GVA_LOG.Infof("用户 %s 在动态/评论中@了用户 %s", c.UserID, msg.To)
-				data, _ := json.Marshal(msg)
-				c.Manager.SendToUser(msg.To, data)
+	// 根据消息类型处理
+	switch msg.Type {
+	case model.MessageTypeChat:
+		// 处理聊天消息
+		if msg.Extra.RoomID != "" {
+			global.GVA_LOG.Infof("客户端 %s 发送群聊消息到房间 %s", c.ID, msg.Extra.RoomID)
+			members, err := c.Manager.roomMembers(c.UserID, msg.Extra.RoomID)
+			if err != nil {
+				global.GVA_LOG.Errorf("客户端 %s 发送群聊消息失败: %v", c.ID, err)
+				c.sendRoomError(err, &msg)
+				return
+			}
+			msg.To = ""
+			c.Manager.persistChat(&msg)
+			data, _ := json.Marshal(msg)
+			c.Manager.sendToMembers(c.UserID, c, msg.Extra.RoomID, members, data)
+		} else if msg.To != "" {
+			global.GVA_LOG.Infof("客户端 %s 发送私聊消息给用户 %s", c.ID, msg.To)
+			c.Manager.persistChat(&msg)
+			data, _ := json.Marshal(msg)
+			c.Manager.SendToUser(msg.To, data)
+			if msg.To != c.UserID {
+				c.Manager.syncToSender(c, data)
+			}
+		} else {
+			if !c.canBroadcast() {
+				global.GVA_LOG.Warnf("客户端 %s 没有权限发送全员广播", c.ID)
+				c.reject(model.ErrorCodeForbidden, "没有权限发送全员广播", &msg)
+				return
 			}
+			global.GVA_LOG.Infof("客户端 %s 发送广播消息", c.ID)
+			data, _ := json.Marshal(msg)
+			c.Manager.publishBroadcast(&broadcastFrame{Payload: data})
+		}
+
+	case model.MessageTypeLike:
+		// 处理点赞通知
+		if msg.Extra.PostID != "" {
+			global.GVA_LOG.Infof("用户 %s 点赞了动态 %s", c.UserID, msg.Extra.PostID)
+			data, _ := json.Marshal(msg)
+			c.Manager.notify(c, &msg, data)
+		}
 
-		case "ping":
-			// 更新最后心跳时间
-			c.LastPing = time.Now()
-			global.GVA_LOG.Debugf("更新客户端 %s 的心跳时间: %v", c.ID, c.LastPing)
+	case model.MessageTypeCollect:
+		// 处理收藏通知
+		if msg.Extra.PostID != "" {
+			global.GVA_LOG.Infof("用户 %s 收藏了动态 %s", c.UserID, msg.Extra.PostID)
+			data, _ := json.Marshal(msg)
+			c.Manager.notify(c, &msg, data)
 		}
+
+	case model.MessageTypeComment:
+		// 处理评论通知
+		if msg.Extra.PostID != "" {
+			global.GVA_LOG.Infof("用户 %s 评论了动态 %s", c.UserID, msg.Extra.PostID)
+			data, _ := json.Marshal(msg)
+			c.Manager.notify(c, &msg, data)
+		}
+
+	case model.MessageTypeMention:
+		// 处理@通知
+		if msg.To != "" {
+			global.GVA_LOG.Infof("用户 %s 在动态/评论中@了用户 %s", c.UserID, msg.To)
+			data, _ := json.Marshal(msg)
+			c.Manager.SendToUser(msg.To, data)
+		}
+
+	case model.MessageTypeTyping:
+		// 正在输入，限频后只推送给在线设备
+		c.handleTyping(&msg)
+
+	case model.MessageTypeRead:
+		// 已读回执，持久化已读位置后通知会话的其他参与者
+		c.handleRead(&msg)
+
+	case model.MessageTypePresenceSub:
+		// 订阅用户的在线状态
+		c.handlePresenceSub(&msg)
+
+	case model.MessageTypePresenceUnsub:
+		c.handlePresenceUnsub(&msg)
+
+	case model.MessageTypePresence:
+		// 客户端上报自己处于活跃或空闲状态
+		c.handlePresenceStatus(&msg)
+
+	case model.MessageTypeAck:
+		// 客户端确认收到消息
+		if msg.ID != "" {
+			c.handleAck(msg.ID)
+		}
+
+	case model.MessageTypePing:
+		// 读取到消息时已经更新了心跳时间，这里只需回复
+		c.handlePing()
+	}
+
+	// 处理完成后回复发送结果，客户端据此把clientMsgId对应到服务端消息ID
+	if tracked {
+		c.confirmSent(&msg)
 	}
 }
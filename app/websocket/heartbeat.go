@@ -0,0 +1,92 @@
+package websocket
+
+import (
+	"campus2/app/websocket/model"
+	"campus2/pkg/global"
+	"encoding/json"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	defaultHeartbeatTime = 30 * time.Second // 配置未设置时的心跳间隔
+	writeWait            = 10 * time.Second // 单次写入的最长时间，超时视为连接已断开
+)
+
+// heartbeatInterval 服务端发送ping的间隔，也是客户端应发送心跳的间隔
+func heartbeatInterval() time.Duration {
+	if seconds := global.WebSocketConfig().HeartbeatTime; seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return defaultHeartbeatTime
+}
+
+// heartbeatTimeout 超过该时间没有收到客户端的任何数据(消息、心跳或pong)时断开连接，
+// 允许错过一次心跳
+func heartbeatTimeout() time.Duration {
+	return heartbeatInterval()*2 + writeWait
+}
+
+// LastPing 最近一次收到客户端数据的时间
+func (c *Client) LastPing() time.Time {
+	return time.UnixMilli(c.lastPing.Load())
+}
+
+// touch 收到客户端数据时延长读取期限，心跳期间定期刷新Redis中的连接信息，让其他节点看到的在线状态保持最新。
+// 刷新时检查连接使用的token，退出登录吊销token后连接在一个心跳周期内断开
+func (c *Client) touch() {
+	now := time.Now()
+	c.lastPing.Store(now.UnixMilli())
+	if c.Socket != nil {
+		c.Socket.SetReadDeadline(now.Add(heartbeatTimeout()))
+	}
+
+	if c.Manager.redisStore == nil || now.Sub(c.refreshedAt) < heartbeatInterval()/2 {
+		return
+	}
+	c.refreshedAt = now
+	if c.tokenRevoked() {
+		global.GVA_LOG.Warnf("客户端 %s 使用的token已被吊销，断开连接", c.ID)
+		go c.closeWith(websocket.ClosePolicyViolation, "token已被吊销")
+		return
+	}
+	if err := c.Manager.saveConnInfo(c); err != nil {
+		global.GVA_LOG.Errorf("刷新客户端 %s 的连接信息失败: %v", c.ID, err)
+	}
+}
+
+// handlePing 客户端心跳，回复pong，客户端可以据此判断连接是否可用
+func (c *Client) handlePing() {
+	global.GVA_LOG.Debugf("收到客户端 %s 的心跳", c.ID)
+	data, err := json.Marshal(model.Message{
+		Type:      model.MessageTypePong,
+		To:        c.UserID,
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		return
+	}
+	c.deliver(data)
+}
+
+// reapIdle 定期断开超时未收到心跳的连接。读取期限通常已经让这些连接退出，
+// 这里兜底处理读取协程阻塞在其他地方的情况，避免半开连接一直显示为在线
+func (m *Manager) reapIdle() {
+	ticker := time.NewTicker(heartbeatInterval())
+	defer ticker.Stop()
+	for range ticker.C {
+		if m.closing.Load() {
+			return
+		}
+		deadline := time.Now().Add(-heartbeatTimeout())
+		m.clients.Range(func(key, value interface{}) bool {
+			client := value.(*Client)
+			if client.LastPing().Before(deadline) {
+				global.GVA_LOG.Warnf("客户端 %s 超过 %v 未发送心跳，断开连接", client.ID, heartbeatTimeout())
+				go client.closeWith(websocket.CloseGoingAway, "心跳超时")
+			}
+			return true
+		})
+	}
+}
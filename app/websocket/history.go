@@ -0,0 +1,53 @@
+package websocket
+
+import (
+	"campus2/app/websocket/model"
+	"campus2/pkg/global"
+	"encoding/json"
+	"strconv"
+	"time"
+)
+
+// persistChat 持久化聊天消息，并把会话ID和历史游标写回消息，未启用数据库时跳过
+func (m *Manager) persistChat(msg *model.Message) {
+	if m.chatService == nil {
+		return
+	}
+	saved, err := m.chatService.SaveMessage(msg.ID, msg.From, msg.To, msg.Extra.RoomID, msg.Content, msg.Extra, msg.CreatedAt)
+	if err != nil {
+		global.GVA_LOG.Errorf("持久化聊天消息 %s 失败: %v", msg.ID, err)
+		return
+	}
+	msg.Extra.ConversationID = saved.ConversationID
+	msg.Extra.HistoryID = saved.HistoryID
+}
+
+// syncHistory 握手时携带history_after参数的设备，连接后推送一次其缺失的聊天记录
+func (c *Client) syncHistory(historyAfter string) {
+	if historyAfter == "" || c.Manager.chatService == nil {
+		return
+	}
+	after, err := strconv.ParseUint(historyAfter, 10, 64)
+	if err != nil {
+		global.GVA_LOG.Warnf("客户端 %s 的history_after参数无效: %s", c.ID, historyAfter)
+		return
+	}
+
+	result, err := c.Manager.chatService.SyncMessages(c.UserID, after, 0, 0)
+	if err != nil {
+		global.GVA_LOG.Errorf("同步用户 %s 的聊天记录失败: %v", c.UserID, err)
+		return
+	}
+	data, err := json.Marshal(model.Message{
+		Type:      model.MessageTypeSync,
+		Content:   result,
+		To:        c.UserID,
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		return
+	}
+	if c.deliver(data) {
+		global.GVA_LOG.Infof("向客户端 %s 同步了 %d 条聊天记录", c.ID, len(result.Messages))
+	}
+}
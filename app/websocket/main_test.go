@@ -0,0 +1,58 @@
+package websocket
+
+import (
+	"campus2/pkg/global"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+)
+
+func TestMain(m *testing.M) {
+	global.GVA_LOG = logrus.New()
+	global.GVA_LOG.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// newTestManager 创建未启用Redis的管理器
+func newTestManager(t *testing.T) *Manager {
+	t.Helper()
+	config := global.GVA_CONFIG
+	t.Cleanup(func() { global.GVA_CONFIG = config })
+	global.GVA_CONFIG.System.UseRedis = false
+	global.GVA_CONFIG.System.ServerID = "node-a"
+	return NewManager()
+}
+
+// newRedisManager 使用miniredis创建启用Redis的管理器
+func newRedisManager(t *testing.T) (*Manager, *miniredis.Miniredis) {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	config, previous := global.GVA_CONFIG, global.GVA_REDIS
+	t.Cleanup(func() {
+		client.Close()
+		global.GVA_CONFIG, global.GVA_REDIS = config, previous
+	})
+	global.GVA_REDIS = client
+	global.GVA_CONFIG.System.UseRedis = true
+	global.GVA_CONFIG.System.ServerID = "node-a"
+	return NewManager(), mr
+}
+
+// newTestClient 创建未连接的客户端，只用于调用客户端方法
+func newTestClient(m *Manager, userID, deviceID string) *Client {
+	return &Client{
+		ID:       userID + ":" + deviceID,
+		UserID:   userID,
+		DeviceID: deviceID,
+		codec:    codecs[CodecJSON],
+		Send:     make(chan []byte, 16),
+		Manager:  m,
+		inflight: make(map[string]*inflightFrame),
+		done:     make(chan struct{}),
+	}
+}
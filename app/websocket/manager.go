@@ -5,54 +5,141 @@ import (
 	"context"
 	"encoding/json"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	chatservice "campus2/app/chat/service"
+	presencemodel "campus2/app/presence/model"
+	presenceservice "campus2/app/presence/service"
+	roomservice "campus2/app/room/service"
 	"campus2/app/websocket/model"
 	"campus2/app/websocket/store"
 
 	"github.com/gorilla/websocket"
+	"github.com/redis/go-redis/v9"
 )
 
 // Client WebSocket客户端
 type Client struct {
-	ID       string
-	UserID   string
-	Socket   *websocket.Conn
-	Send     chan []byte
-	Manager  *Manager
-	LastPing time.Time
+	ID        string // 连接唯一标识
+	UserID    string
+	DeviceID  string          // 设备标识，同一用户可以在多个设备上同时在线
+	Role      string          // JWT中的用户角色
+	Nickname  string          // JWT中的昵称，可能为空
+	Transport string          // 传输方式: websocket/sse/poll
+	Socket    *websocket.Conn // SSE和轮询会话为nil
+	Send      chan []byte     // 发送队列，只能通过enqueue写入、closeSend关闭
+	Manager   *Manager
+
+	tokens         []string  // 连接使用的token(jti)，包括握手时续期签发的新token
+	tokensExpireAt time.Time // 这些token中最晚的过期时间
+
+	lastPing    atomic.Int64 // 最近一次收到客户端数据的毫秒时间戳
+	refreshedAt time.Time    // 最近一次刷新Redis中连接信息的时间，只在读取协程中访问
+
+	sendMu     sync.RWMutex // 保护Send的关闭，避免向已关闭的通道写入
+	sendClosed bool
+	metrics    clientMetrics
+
+	inflight   map[string]*inflightFrame // 已推送但尚未确认的消息 map[消息ID]
+	inflightMu sync.Mutex
+	done       chan struct{} // 连接注销时关闭
+	doneOnce   sync.Once
+
+	resuming atomic.Bool // 正在续传断开期间的消息，期间实时推送的消息暂存在held中
+	resumeMu sync.Mutex  // 保护held，续传完成时推送暂存消息期间阻塞新的实时消息以保持顺序
+	held     [][]byte
+
+	typingAt    map[string]time.Time    // 最近一次转发"正在输入"的时间 map[会话]，只在读取协程中访问
+	buckets     map[string]*tokenBucket // 未启用Redis时的本地令牌桶，只在读取协程中访问
+	throttledAt time.Time               // 最近一次提示限流的时间
+
+	segments map[string]struct{} // 连接所属的分组，握手时确定，如school:xxx、tag:xxx
+	codec    Codec               // 握手时协商的消息编码
+
+	session *virtualSession // SSE和轮询会话的状态，WebSocket连接为nil
+
+	idle       atomic.Bool         // 客户端是否上报了空闲状态
+	presenceOf map[string]struct{} // 该连接订阅了在线状态的用户，由Manager.presenceMu保护
 }
 
 // Manager WebSocket管理器
 type Manager struct {
-	clients    sync.Map     // 本地连接的客户端 map[string]*Client
-	broadcast  chan []byte  // 广播消息通道
-	register   chan *Client // 注册通道
-	unregister chan *Client // 注销通道
-	// 根据配置决定是否初始化存储
-	redisStore *store.RedisMessageStore `json:"-"`
-	kafkaStore *store.KafkaMessageStore `json:"-"`
+	clients    sync.Map             // 本地连接的客户端 map[string]*Client
+	broadcast  chan *broadcastFrame // 广播消息通道
+	register   chan *Client         // 注册通道
+	unregister chan *Client         // 注销通道
+	serverID   string               // 当前节点标识
+	slowPolicy SlowConsumerPolicy   // 客户端发送队列已满时的处理策略
+	closing    atomic.Bool          // 正在关闭，不再接受新连接
+	pending    sync.WaitGroup       // 尚未完成的离线存储写入
+	pubsubMu   sync.Mutex
+	pubsubs    []*redis.PubSub // 本节点的频道订阅，关闭时一并退订
+	dedupe     localDedupe     // 未启用Redis时按clientMsgId去重
+	acks       localAcks       // 未启用Redis时记录已确认的消息
+	replay     localReplay     // 未启用Redis时的消息序号和重放缓冲
+	aggregator localAggregator // 未启用Redis时的通知聚合
+	// 根据配置决定是否初始化存储，redisStore为主存储，kafkaStore为备份
+	redisStore model.MessageStore `json:"-"`
+	kafkaStore model.MessageStore `json:"-"`
+	// 启用数据库时才支持房间消息和聊天记录
+	roomService *roomservice.RoomService
+	chatService *chatservice.ChatService
+	// 在线状态订阅
+	presenceService *presenceservice.PresenceService
+	presenceMu      sync.RWMutex
+	presenceSubs    map[string]map[*Client]struct{} // map[被订阅的用户ID]订阅的本地连接
+	localStatus     map[string]string               // 未启用Redis时记录本节点用户的在线状态
 }
 
 // ConnInfo 连接信息
 type ConnInfo struct {
-	UserID   string `json:"user_id"`
-	ServerID string `json:"server_id"` // 服务器标识
-	LastPing int64  `json:"last_ping"`
+	UserID    string `json:"user_id"`
+	DeviceID  string `json:"device_id"`           // 设备标识
+	ConnID    string `json:"conn_id"`             // 连接标识，用于区分同一设备的新旧连接
+	ServerID  string `json:"server_id"`           // 服务器标识
+	Transport string `json:"transport,omitempty"` // 传输方式: websocket/sse/poll
+	LastPing  int64  `json:"last_ping"`
+	Idle      bool   `json:"idle,omitempty"` // 设备是否处于空闲状态
+
+	TokenIDs       []string `json:"token_ids,omitempty"`        // 连接使用的token(jti)，管理员断开连接时吊销
+	TokenExpiresAt int64    `json:"token_expires_at,omitempty"` // token中最晚的过期时间(秒)
 }
 
 const (
 	// Redis key 前缀
-	connMapKey    = "ws:conn:map"     // Hash表存储用户连接信息
-	serverConnKey = "ws:server:conns" // Set存储服务器的在线连接
+	connMapKey           = presencemodel.OnlineKey   // Hash表存储在线用户最近一次的连接信息
+	connDevicesKeyPrefix = "ws:conn:devices:"        // Hash表存储用户每个设备的连接信息 field=deviceID
+	serverConnKeyPrefix  = "ws:server:conns:"        // Set存储节点上有连接的用户 ws:server:conns:{serverID}
+	lastSeenKey          = presencemodel.LastSeenKey // Hash表存储用户最后在线时间
 )
 
+// removeDeviceScript 仅当设备记录仍属于该连接时才删除，返回用户剩余的在线设备数
+var removeDeviceScript = redis.NewScript(`
+local cur = redis.call('HGET', KEYS[1], ARGV[1])
+if cur and cjson.decode(cur).conn_id == ARGV[2] then
+	redis.call('HDEL', KEYS[1], ARGV[1])
+end
+return redis.call('HLEN', KEYS[1])
+`)
+
+// connDevicesKey 获取用户设备连接信息的key
+func connDevicesKey(userID string) string {
+	return connDevicesKeyPrefix + userID
+}
+
 // NewManager 创建WebSocket管理器
 func NewManager() *Manager {
 	m := &Manager{
-		broadcast:  make(chan []byte),
+		broadcast:  make(chan *broadcastFrame),
 		register:   make(chan *Client),
 		unregister: make(chan *Client),
+		serverID:   global.GVA_CONFIG.System.ServerID,
+		slowPolicy: slowConsumerPolicy(),
+
+		presenceService: presenceservice.NewPresenceService(),
+		presenceSubs:    make(map[string]map[*Client]struct{}),
+		localStatus:     make(map[string]string),
 	}
 
 	// 根据配置初始化存储
@@ -62,6 +149,10 @@ func NewManager() *Manager {
 	if global.GVA_CONFIG.System.UseKafka {
 		m.kafkaStore = store.NewKafkaMessageStore(global.GVA_CONFIG.Kafka.Topic)
 	}
+	if global.GVA_DB != nil {
+		m.roomService = roomservice.NewRoomService()
+		m.chatService = chatservice.NewChatService()
+	}
 
 	return m
 }
@@ -69,44 +160,62 @@ func NewManager() *Manager {
 // Start 启动WebSocket管理器
 func (m *Manager) Start() {
 	global.GVA_LOG.Info("WebSocket管理器开始运行")
+	// 启用Redis时订阅本节点频道，接收其他节点转发的消息
+	if m.redisStore != nil {
+		m.sweepOwnLeftovers()
+		go m.subscribeNode()
+		go m.subscribePresence()
+		go m.subscribeBroadcast()
+		go m.keepAlive()
+	}
+	go m.reapIdle()
 	for {
 		select {
 		case client := <-m.register:
-			global.GVA_LOG.Infof("注册新的WebSocket客户端: %s, 用户ID: %s", client.ID, client.UserID)
+			global.GVA_LOG.Infof("注册新的WebSocket客户端: %s, 用户ID: %s, 设备ID: %s", client.ID, client.UserID, client.DeviceID)
+			// 同一设备在本节点上的旧连接被新连接取代
+			m.kickLocal(client.UserID, client.DeviceID, client.ID, "设备已在新连接上登录")
 			// 注册客户端到本地
 			m.clients.Store(client.ID, client)
 			// 只在启用Redis时更新连接信息
 			if m.redisStore != nil {
 				m.updateConnInfo(client)
+				m.joinSegments(client)
 			}
+			m.refreshPresence(client.UserID)
 			global.GVA_LOG.Infof("客户端注册完成: %s", client.ID)
+			// 关闭过程中才完成握手的连接同样断开
+			if m.closing.Load() {
+				go client.closeWith(websocket.CloseGoingAway, "服务器正在重启")
+			}
 
 		case client := <-m.unregister:
 			global.GVA_LOG.Infof("注销WebSocket客户端: %s, 用户ID: %s", client.ID, client.UserID)
-			if _, ok := m.clients.Load(client.ID); ok {
+			m.pending.Add(1) // 先登记再移除连接，Shutdown看到连接全部注销时不会漏掉这次写入
+			if v, ok := m.clients.Load(client.ID); ok && v == client {
 				m.clients.Delete(client.ID)
-				close(client.Send)
+				client.closeSend()
 				// 只在启用Redis时移除连接信息
 				if m.redisStore != nil {
 					m.removeConnInfo(client)
 				}
-				global.GVA_LOG.Infof("客户端注销完成: %s", client.ID)
+				m.refreshPresence(client.UserID)
+				metrics := client.Metrics()
+				global.GVA_LOG.Infof("客户端注销完成: %s, 共发送 %d 条, 队列满 %d 次, 丢弃 %d 条, 转存 %d 条",
+					client.ID, metrics.Queued, metrics.Overflows, metrics.Dropped, metrics.Spilled)
 			}
+			m.dropPresenceSubs(client)
+			client.doneOnce.Do(func() { close(client.done) })
+			// 未确认的消息转入离线存储，等待下次连接时重新推送
+			go func() {
+				defer m.pending.Done()
+				client.flushInflight()
+			}()
 
-		case message := <-m.broadcast:
-			global.GVA_LOG.Info("收到广播消息，准备向所有在线用户推送")
-			// 直接从本地clients广播
-			m.clients.Range(func(key, value interface{}) bool {
-				client := value.(*Client)
-				select {
-				case client.Send <- message:
-					global.GVA_LOG.Infof("广播消息已发送给用户: %s", client.UserID)
-				default:
-					close(client.Send)
-					m.clients.Delete(client.ID)
-				}
-				return true
-			})
+		case frame := <-m.broadcast:
+			global.GVA_LOG.Infof("收到广播消息，准备向本节点上属于分组 %v 的连接推送", frame.Segments)
+			// 推送给本节点上匹配的连接，其他节点各自推送
+			m.deliverBroadcast(frame)
 		}
 	}
 }
@@ -114,105 +223,280 @@ func (m *Manager) Start() {
 // updateConnInfo 更新Redis中的连接信息
 func (m *Manager) updateConnInfo(client *Client) {
 	ctx := context.Background()
-	connInfo := ConnInfo{
-		UserID:   client.UserID,
-		ServerID: global.GVA_CONFIG.System.ServerID,
-		LastPing: time.Now().Unix(),
+	// 同一设备在其他节点上的旧连接需要通知对应节点断开
+	if prev, err := m.lookupDevice(ctx, client.UserID, client.DeviceID); err != nil {
+		global.GVA_LOG.Errorf("查询用户 %s 设备 %s 的连接信息失败: %v", client.UserID, client.DeviceID, err)
+	} else if prev != nil && prev.ServerID != m.serverID {
+		m.kickRemote(prev)
+	}
+
+	global.GVA_LOG.Infof("更新用户 %s 设备 %s 的连接信息到Redis", client.UserID, client.DeviceID)
+	if err := m.saveConnInfo(client); err != nil {
+		global.GVA_LOG.Errorf("更新连接信息到Redis失败: %v", err)
+	} else {
+		global.GVA_LOG.Infof("成功更新用户 %s 的连接信息", client.UserID)
 	}
+}
 
+// saveConnInfo 将连接信息写入Redis，注册和心跳时调用
+func (m *Manager) saveConnInfo(client *Client) error {
+	connInfo := ConnInfo{
+		UserID:    client.UserID,
+		DeviceID:  client.DeviceID,
+		ConnID:    client.ID,
+		ServerID:  m.serverID,
+		Transport: client.Transport,
+		LastPing:  client.LastPing().Unix(),
+		Idle:      client.idle.Load(),
+
+		TokenIDs:       client.tokens,
+		TokenExpiresAt: client.tokensExpireAt.Unix(),
+	}
 	data, err := json.Marshal(connInfo)
 	if err != nil {
-		global.GVA_LOG.Errorf("序列化连接信息失败: %v", err)
-		return
+		return err
 	}
 
-	global.GVA_LOG.Infof("更新用户 %s 的连接信息到Redis", client.UserID)
+	ctx := context.Background()
 	// 使用Redis Hash存储用户连接信息
 	pipe := global.GVA_REDIS.Pipeline()
+	pipe.HSet(ctx, connDevicesKey(client.UserID), client.DeviceID, data)
+	pipe.Expire(ctx, connDevicesKey(client.UserID), global.GVA_CONFIG.Redis.GetDuration())
+	// ws:conn:map不设置整体过期时间，宕机节点的残留记录由sweepDeadNodes清理
 	pipe.HSet(ctx, connMapKey, client.UserID, data)
-	pipe.Expire(ctx, connMapKey, global.GVA_CONFIG.Redis.GetDuration())
-	pipe.HSet(ctx, "online:last_seen", client.UserID, time.Now().Unix())
-	pipe.Expire(ctx, "online:last_seen", global.GVA_CONFIG.Redis.GetDuration())
+	pipe.SAdd(ctx, serverConnKey(m.serverID), client.UserID)
+	pipe.HSet(ctx, lastSeenKey, client.UserID, time.Now().Unix())
+	pipe.Expire(ctx, lastSeenKey, global.GVA_CONFIG.Redis.GetDuration())
 	_, err = pipe.Exec(ctx)
-	if err != nil {
-		global.GVA_LOG.Errorf("更新连接信息到Redis失败: %v", err)
-	} else {
-		global.GVA_LOG.Infof("成功更新用户 %s 的连接信息", client.UserID)
-	}
+	return err
 }
 
-// removeConnInfo 从Redis中移除连接信息
+// removeConnInfo 从Redis中移除连接信息，用户最后一个设备断开时才视为下线
 func (m *Manager) removeConnInfo(client *Client) {
 	ctx := context.Background()
-	global.GVA_LOG.Infof("从Redis中移除用户 %s 的连接信息", client.UserID)
-	err := global.GVA_REDIS.HDel(ctx, connMapKey, client.UserID).Err()
+	global.GVA_LOG.Infof("从Redis中移除用户 %s 设备 %s 的连接信息", client.UserID, client.DeviceID)
+	remaining, err := removeDeviceScript.Run(ctx, global.GVA_REDIS,
+		[]string{connDevicesKey(client.UserID)}, client.DeviceID, client.ID).Int()
 	if err != nil {
 		global.GVA_LOG.Errorf("从Redis移除连接信息失败: %v", err)
-	} else {
-		global.GVA_LOG.Infof("成功移除用户 %s 的连接信息", client.UserID)
+		return
 	}
+	if !m.hasLocalUser(client.UserID) {
+		global.GVA_REDIS.SRem(ctx, serverConnKey(m.serverID), client.UserID)
+	}
+	if remaining > 0 {
+		global.GVA_LOG.Infof("用户 %s 仍有 %d 个设备在线", client.UserID, remaining)
+		return
+	}
+
+	pipe := global.GVA_REDIS.Pipeline()
+	pipe.HDel(ctx, connMapKey, client.UserID)
+	pipe.HSet(ctx, lastSeenKey, client.UserID, time.Now().Unix())
+	if _, err := pipe.Exec(ctx); err != nil {
+		global.GVA_LOG.Errorf("从Redis移除连接信息失败: %v", err)
+		return
+	}
+	// 删除期间可能有新设备上线，重新确认一次避免误判为离线
+	if devices, err := m.lookupDevices(ctx, client.UserID); err == nil && len(devices) > 0 {
+		if data, err := json.Marshal(devices[0]); err == nil {
+			global.GVA_REDIS.HSet(ctx, connMapKey, client.UserID, data)
+		}
+		return
+	}
+	global.GVA_LOG.Infof("用户 %s 的所有设备均已下线", client.UserID)
+}
+
+// hasLocalUser 用户在本节点上是否还有其他连接
+func (m *Manager) hasLocalUser(userID string) bool {
+	found := false
+	m.clients.Range(func(key, value interface{}) bool {
+		found = value.(*Client).UserID == userID
+		return !found
+	})
+	return found
 }
 
-// SendToUser 发送消息给指定用户
+// SendToUser 发送消息给指定用户的所有在线设备。
+// 先投递给本节点上的连接，再根据ws:conn:devices中记录的ServerID转发给其他设备所在的节点，
+// 没有任何设备收到(目标节点不存在或未确认接收)时才写入离线存储。
+// 被接收者的通知偏好静音的消息只计入静音统计，不推送
 func (m *Manager) SendToUser(userID string, message []byte) error {
+	if m.muted(userID, message) {
+		return nil
+	}
+	return m.sendToUser(userID, m.sequence(userID, message), true)
+}
+
+// sendEphemeral 推送临时消息(正在输入、已读回执)，用户没有设备在线时直接丢弃，不写入离线存储
+func (m *Manager) sendEphemeral(userID string, message []byte) {
+	m.sendToUser(userID, message, false)
+}
+
+// sendToUser 投递给用户的所有在线设备，offline为true时无设备收到则写入离线存储
+func (m *Manager) sendToUser(userID string, message []byte, offline bool) error {
 	global.GVA_LOG.Infof("准备向用户 %s 发送消息", userID)
 
+	delivered := m.deliverLocal(userID, message)
+	if m.forwardToDevices(userID, message, !offline) {
+		delivered = true
+	}
+
+	if delivered || !offline {
+		return nil
+	}
+	return m.storeOffline(userID, message)
+}
+
+// syncToSender 把用户自己发出的聊天消息同步给该用户的其他在线连接，发出消息的连接除外。
+// 同步只推送在线连接，不分配序号也不写入离线存储，离线的设备通过聊天记录接口获取
+func (m *Manager) syncToSender(origin *Client, message []byte) {
+	m.clients.Range(func(key, value interface{}) bool {
+		client := value.(*Client)
+		if client.UserID == origin.UserID && client != origin {
+			client.deliver(message)
+		}
+		return true
+	})
+	m.forwardToDevices(origin.UserID, message, true)
+}
+
+// forwardToDevices 根据ws:conn:devices中记录的ServerID把消息转发给用户其他设备所在的节点，
+// 返回是否至少有一个节点确认接收
+func (m *Manager) forwardToDevices(userID string, message []byte, ephemeral bool) bool {
+	if m.redisStore == nil {
+		return false
+	}
+	devices, err := m.lookupDevices(context.Background(), userID)
+	if err != nil {
+		global.GVA_LOG.Errorf("查询用户 %s 的连接信息失败: %v", userID, err)
+	}
+	delivered := false
+	forwarded := make(map[string]bool)
+	for _, info := range devices {
+		if info.ServerID == m.serverID || forwarded[info.ServerID] {
+			continue
+		}
+		forwarded[info.ServerID] = true
+		if m.forwardToNode(info.ServerID, userID, message, ephemeral) {
+			delivered = true
+		}
+	}
+	return delivered
+}
+
+// deliverLocal 投递给本节点上该用户的所有连接，返回是否至少有一个连接收到
+func (m *Manager) deliverLocal(userID string, message []byte) bool {
 	var messageSent bool
-	// 在本地查找用户
 	m.clients.Range(func(key, value interface{}) bool {
 		client := value.(*Client)
 		if client.UserID == userID {
-			select {
-			case client.Send <- message:
-				global.GVA_LOG.Infof("成功向用户 %s 发送消息", userID)
+			if client.deliver(message) {
+				global.GVA_LOG.Infof("成功向用户 %s 的设备 %s 发送消息", userID, client.DeviceID)
 				messageSent = true
-				return false
-			default:
-				global.GVA_LOG.Warnf("向用户 %s 发送消息失败，清理连接", userID)
-				close(client.Send)
-				m.clients.Delete(client.ID)
+			} else {
+				global.GVA_LOG.Warnf("向用户 %s 的设备 %s 发送消息失败", userID, client.DeviceID)
 			}
 		}
 		return true
 	})
+	return messageSent
+}
 
-	if !messageSent {
-		// 如果启用了Redis/Kafka，则存储离线消息
-		if m.redisStore != nil || m.kafkaStore != nil {
-			var msg model.Message
-			if err := json.Unmarshal(message, &msg); err != nil {
-				return err
-			}
+// kickLocal 断开本节点上指定用户设备的连接，exceptID为需要保留的连接
+func (m *Manager) kickLocal(userID, deviceID, exceptID, reason string) {
+	m.clients.Range(func(key, value interface{}) bool {
+		client := value.(*Client)
+		if client.UserID == userID && client.DeviceID == deviceID && client.ID != exceptID {
+			global.GVA_LOG.Infof("断开用户 %s 设备 %s 的旧连接 %s: %s", userID, deviceID, client.ID, reason)
+			client.kick(reason)
+		}
+		return true
+	})
+}
 
-			offlineMsg := &model.OfflineMessage{
-				ID:        time.Now().Format("20060102150405") + ":" + msg.From,
-				Type:      msg.Type,
-				Content:   msg.Content,
-				From:      msg.From,
-				To:        msg.To,
-				Timestamp: time.Now(),
-				Status:    0,
-			}
+// storeOffline 将消息写入指定用户的离线存储
+func (m *Manager) storeOffline(userID string, message []byte) error {
+	// 如果启用了Redis/Kafka，则存储离线消息
+	if m.redisStore == nil && m.kafkaStore == nil {
+		global.GVA_LOG.Warnf("用户 %s 不在线，且未启用离线消息存储", userID)
+		return nil
+	}
 
-			if m.redisStore != nil {
-				if err := m.redisStore.StoreMessage(offlineMsg); err != nil {
-					global.GVA_LOG.Errorf("存储离线消息到Redis失败: %v", err)
-				}
-			}
+	var msg struct {
+		model.Message
+		Timestamp time.Time `json:"timestamp"` // 兼容旧版本节点推送的离线消息，以timestamp表示发送时间
+	}
+	if err := json.Unmarshal(message, &msg); err != nil {
+		return err
+	}
 
-			if m.kafkaStore != nil {
-				if err := m.kafkaStore.StoreMessage(offlineMsg); err != nil {
-					global.GVA_LOG.Warnf("备份离线消息到Kafka失败: %v", err)
-				}
-			}
-		} else {
-			global.GVA_LOG.Warnf("用户 %s 不在线，且未启用离线消息存储", userID)
+	if msg.ID == "" {
+		msg.ID = m.nextMessageID() // 同一秒内的多条消息不会互相覆盖
+	}
+	if msg.CreatedAt.IsZero() {
+		msg.CreatedAt = msg.Timestamp
+	}
+	if msg.CreatedAt.IsZero() {
+		msg.CreatedAt = time.Now()
+	}
+	offlineMsg := &model.OfflineMessage{
+		ID:        msg.ID,
+		Type:      msg.Type,
+		Content:   msg.Content,
+		From:      msg.From,
+		To:        userID,
+		Timestamp: msg.CreatedAt, // 重新存储未确认的消息时保持原有顺序
+		Status:    0,
+		Seq:       msg.Seq,
+		Extra:     msg.Extra,
+	}
+
+	if m.redisStore != nil {
+		if err := m.redisStore.StoreMessage(offlineMsg); err != nil {
+			global.GVA_LOG.Errorf("存储离线消息到Redis失败: %v", err)
 		}
 	}
 
+	if m.kafkaStore != nil {
+		if err := m.kafkaStore.StoreMessage(offlineMsg); err != nil {
+			global.GVA_LOG.Warnf("备份离线消息到Kafka失败: %v", err)
+		}
+	}
 	return nil
 }
 
+// offlineStore 读取离线消息使用的存储，优先使用Redis，未启用Redis时从Kafka读取
+func (m *Manager) offlineStore() model.MessageStore {
+	if m.redisStore != nil {
+		return m.redisStore
+	}
+	return m.kafkaStore
+}
+
+// markRead 客户端确认收到后，将该用户对应的离线消息标记为已读
+func (m *Manager) markRead(userID, messageID string) {
+	if m.redisStore != nil {
+		if err := m.redisStore.MarkMessageAsRead(userID, messageID); err != nil {
+			global.GVA_LOG.Warnf("标记离线消息 %s 为已读失败: %v", messageID, err)
+		}
+	}
+	if m.kafkaStore != nil {
+		if err := m.kafkaStore.MarkMessageAsRead(userID, messageID); err != nil {
+			global.GVA_LOG.Warnf("同步离线消息 %s 的已读状态到Kafka失败: %v", messageID, err)
+		}
+	}
+}
+
+// ClientMetrics 获取本节点所有连接的发送统计
+func (m *Manager) ClientMetrics() []ClientMetrics {
+	var result []ClientMetrics
+	m.clients.Range(func(key, value interface{}) bool {
+		result = append(result, value.(*Client).Metrics())
+		return true
+	})
+	return result
+}
+
 // GetOnlineUsers 获取在线用户列表
 func (m *Manager) GetOnlineUsers() ([]string, error) {
 	ctx := context.Background()
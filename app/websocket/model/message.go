@@ -12,16 +12,89 @@ const (
 	MessageTypeComment = "comment" // 评论通知
 	MessageTypeMention = "mention" // @通知
 	MessageTypeSystem  = "system"  // 系统消息
+
+	MessageTypeAck       = "ack"       // 客户端确认收到消息
+	MessageTypeDelivered = "delivered" // 送达回执，通知发送者消息已被接收方确认
+	MessageTypeSync      = "sync"      // 历史消息同步
+	MessageTypeTyping    = "typing"    // 正在输入，只推送给在线设备，不存储
+	MessageTypeRead      = "read"      // 已读回执，extra中携带会话ID和已读到的historyId
+
+	MessageTypePresence      = "presence"       // 在线状态，服务端推送订阅用户的状态，客户端发送时上报自己是否空闲
+	MessageTypePresenceSub   = "presence_sub"   // 订阅用户的在线状态
+	MessageTypePresenceUnsub = "presence_unsub" // 取消订阅
+
+	MessageTypeError = "error" // 服务端拒绝处理客户端消息时返回的错误
+	MessageTypeSent  = "sent"  // 发送结果，服务端处理完带clientMsgId的消息后回复发送者
+	MessageTypePing  = "ping"  // 客户端心跳
+	MessageTypePong  = "pong"  // 服务端对心跳的回复
+
+	MessageTypeResync = "resync" // 重连时无法续传缺失的消息，客户端需要全量同步
+	MessageTypeDigest = "digest" // 聚合窗口内同一动态的多条点赞、收藏或评论通知
+)
+
+// 错误消息的错误码
+const (
+	ErrorCodeBadFrame       = 4000 // 消息不是合法的JSON
+	ErrorCodeUnknownType    = 4001 // 未知或客户端不能发送的消息类型
+	ErrorCodeInvalidPayload = 4002 // 消息内容或extra不符合该类型的要求
+	ErrorCodeForbidden      = 4003 // 没有权限，如普通用户发送全员广播
+	ErrorCodeTooLarge       = 4013 // 消息内容或链接超过长度限制
+	ErrorCodeRateLimited    = 4029 // 发送过于频繁
+	ErrorCodeUnavailable    = 4503 // 服务端暂时无法处理，如未启用或访问数据库失败
 )
 
+// ErrorContent 错误消息的内容
+type ErrorContent struct {
+	Code       int    `json:"code"`                 // 错误码
+	Message    string `json:"message"`              // 错误说明
+	RefType    string `json:"refType,omitempty"`    // 被拒绝的消息类型
+	RefID      string `json:"refId,omitempty"`      // 被拒绝消息的clientMsgId
+	RetryAfter int64  `json:"retryAfter,omitempty"` // 建议的重试等待时间(毫秒)
+}
+
+// SentContent 发送结果消息的内容。重复发送同一clientMsgId时返回首次发送的结果
+type SentContent struct {
+	ClientMsgID    string    `json:"clientMsgId"`              // 客户端生成的消息ID
+	ID             string    `json:"id"`                       // 服务端分配的消息ID
+	CreatedAt      time.Time `json:"createdAt"`                // 服务端收到消息的时间
+	ConversationID string    `json:"conversationId,omitempty"` // 聊天消息所属的会话
+	HistoryID      uint64    `json:"historyId,omitempty"`      // 聊天消息的历史消息游标
+	Duplicate      bool      `json:"duplicate,omitempty"`      // 是否为重复发送
+}
+
+// ResyncContent 无法续传时通知客户端的内容
+type ResyncContent struct {
+	From   uint64 `json:"from"`   // 客户端携带的resume_from
+	Latest uint64 `json:"latest"` // 当前最新序号，全量同步后从该序号开始续传
+}
+
+// DigestActor 通知摘要中的用户
+type DigestActor struct {
+	UserID   string `json:"userId"`
+	Nickname string `json:"nickname,omitempty"`
+}
+
+// DigestContent 通知摘要的内容
+type DigestContent struct {
+	Type   string        `json:"type"`   // 被聚合的通知类型: like/collect/comment
+	PostID string        `json:"postId"` // 动态ID
+	Count  int           `json:"count"`  // 参与的人数
+	Total  int           `json:"total"`  // 通知条数，同一用户的多条评论分别计数
+	Actors []DigestActor `json:"actors"` // 最近参与的用户，最多3个，最新的在前
+	Text   string        `json:"text"`   // 展示文案，如"张三等12人赞了你的动态"
+}
+
 // Message 消息结构
 type Message struct {
-	Type      string       `json:"type"`      // 消息类型
-	Content   interface{}  `json:"content"`   // 消息内容
-	From      string       `json:"from"`      // 发送者ID
-	To        string       `json:"to"`        // 接收者ID
-	CreatedAt time.Time    `json:"createdAt"` // 创建时间
-	Extra     MessageExtra `json:"extra"`     // 额外信息
+	ID          string       `json:"id,omitempty"`          // 服务端消息ID，客户端确认时回传
+	ClientMsgID string       `json:"clientMsgId,omitempty"` // 客户端生成的消息ID，用于去重，发送结果和错误消息中回传
+	Seq         uint64       `json:"seq,omitempty"`         // 按接收者递增的序号，重连时通过resume_from续传
+	Type        string       `json:"type"`                  // 消息类型
+	Content     interface{}  `json:"content"`               // 消息内容
+	From        string       `json:"from"`                  // 发送者ID
+	To          string       `json:"to"`                    // 接收者ID
+	CreatedAt   time.Time    `json:"createdAt"`             // 创建时间
+	Extra       MessageExtra `json:"extra"`                 // 额外信息
 }
 
 // MessageExtra 消息额外信息
@@ -30,28 +103,47 @@ type MessageExtra struct {
 	CommentID  string `json:"commentId,omitempty"`  // 评论ID
 	ActionType string `json:"actionType,omitempty"` // 动作类型(like/unlike/collect/uncollect等)
 	URL        string `json:"url,omitempty"`        // 相关链接
+	RoomID     string `json:"roomId,omitempty"`     // 房间ID，群聊消息使用
+
+	ConversationID string `json:"conversationId,omitempty"` // 会话ID，聊天消息持久化后由服务端填写
+	HistoryID      uint64 `json:"historyId,omitempty"`      // 历史消息游标，聊天消息持久化后由服务端填写
 }
 
 // OfflineMessage 离线消息模型
 type OfflineMessage struct {
-	ID        string       `json:"id"`        // 消息ID
-	Type      string       `json:"type"`      // 消息类型
-	Content   interface{}  `json:"content"`   // 消息内容
-	From      string       `json:"from"`      // 发送者
-	To        string       `json:"to"`        // 接收者
-	Timestamp time.Time    `json:"timestamp"` // 发送时间
-	Status    int          `json:"status"`    // 消息状态(0:未读,1:已读)
-	Extra     MessageExtra `json:"extra"`     // 额外信息
+	ID        string       `json:"id"`            // 消息ID
+	Type      string       `json:"type"`          // 消息类型
+	Content   interface{}  `json:"content"`       // 消息内容
+	From      string       `json:"from"`          // 发送者
+	To        string       `json:"to"`            // 接收者
+	Timestamp time.Time    `json:"timestamp"`     // 发送时间
+	Status    int          `json:"status"`        // 消息状态(0:未读,1:已读)
+	Seq       uint64       `json:"seq,omitempty"` // 接收者的消息序号
+	Extra     MessageExtra `json:"extra"`         // 额外信息
+}
+
+// Message 转换为推送给客户端的消息，发送时间放在createdAt中，与在线推送的消息格式一致
+func (m *OfflineMessage) Message() *Message {
+	return &Message{
+		ID:        m.ID,
+		Seq:       m.Seq,
+		Type:      m.Type,
+		Content:   m.Content,
+		From:      m.From,
+		To:        m.To,
+		CreatedAt: m.Timestamp,
+		Extra:     m.Extra,
+	}
 }
 
-// MessageStore 消息存储接口
+// MessageStore 消息存储接口。离线消息按(接收者, 消息ID)区分，群发消息给每个接收者各存一份
 type MessageStore interface {
-	// 存储离线消息
+	// 存储离线消息，接收者为msg.To
 	StoreMessage(msg *OfflineMessage) error
 	// 获取用户的离线消息
 	GetOfflineMessages(userID string) ([]*OfflineMessage, error)
-	// 标记消息为已读
-	MarkMessageAsRead(messageID string) error
-	// 删除消息
-	DeleteMessage(messageID string) error
+	// 标记用户的消息为已读
+	MarkMessageAsRead(userID, messageID string) error
+	// 删除用户的消息
+	DeleteMessage(userID, messageID string) error
 }
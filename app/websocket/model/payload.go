@@ -0,0 +1,22 @@
+package model
+
+// 聊天消息的内容类型
+const (
+	ChatKindText  = "text"  // 文本，content也可以直接是字符串
+	ChatKindImage = "image" // 图片
+)
+
+// ChatContent 聊天消息的内容。文本消息可以直接发送字符串，等价于{"kind": "text", "text": "..."}
+type ChatContent struct {
+	Kind   string `json:"kind"`             // 内容类型: text/image
+	Text   string `json:"text,omitempty"`   // 文本内容，图片消息时为图片说明
+	URL    string `json:"url,omitempty"`    // 图片地址
+	Width  int    `json:"width,omitempty"`  // 图片宽度(像素)
+	Height int    `json:"height,omitempty"` // 图片高度(像素)
+}
+
+// SystemContent 系统消息的内容，也可以直接是字符串
+type SystemContent struct {
+	Title string `json:"title,omitempty"` // 标题
+	Text  string `json:"text"`            // 正文
+}
@@ -0,0 +1,246 @@
+package websocket
+
+import (
+	"campus2/app/websocket/model"
+	"campus2/pkg/global"
+	"encoding/json"
+	"net/url"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// 消息内容的默认长度限制，配置未设置时使用
+const (
+	defaultMaxContentLength = 2000 // 文本内容的最大字符数
+	defaultMaxURLLength     = 512  // 链接的最大长度
+)
+
+// PayloadError 消息内容校验失败，Code为错误消息中返回给客户端的错误码
+type PayloadError struct {
+	Code    int
+	Message string
+}
+
+func (e *PayloadError) Error() string {
+	return e.Message
+}
+
+// invalidPayload 内容不符合要求
+func invalidPayload(message string) *PayloadError {
+	return &PayloadError{Code: model.ErrorCodeInvalidPayload, Message: message}
+}
+
+// PayloadSchema 校验一种消息类型的内容和extra，校验失败时返回*PayloadError
+type PayloadSchema func(msg *model.Message) *PayloadError
+
+var (
+	schemasMu sync.RWMutex
+	// schemas 客户端可以发送的消息类型，值为nil的类型不校验内容
+	schemas = map[string]PayloadSchema{
+		model.MessageTypeChat:    validateChat,
+		model.MessageTypeLike:    validateReaction("like", "unlike"),
+		model.MessageTypeCollect: validateReaction("collect", "uncollect"),
+		model.MessageTypeComment: validateComment,
+		model.MessageTypeMention: validateMention,
+		model.MessageTypeSystem:  validateSystem,
+
+		model.MessageTypeAck:           nil,
+		model.MessageTypeTyping:        validateTyping,
+		model.MessageTypeRead:          validateRead,
+		model.MessageTypePresence:      nil,
+		model.MessageTypePresenceSub:   nil,
+		model.MessageTypePresenceUnsub: nil,
+		model.MessageTypePing:          nil,
+	}
+)
+
+// RegisterPayloadSchema 注册或替换消息类型的内容校验，schema为nil时该类型只做通用检查
+func RegisterPayloadSchema(msgType string, schema PayloadSchema) {
+	schemasMu.Lock()
+	defer schemasMu.Unlock()
+	schemas[msgType] = schema
+}
+
+// validatePayload 检查消息类型是否已注册，并按该类型的规则校验内容。
+// 所有类型的extra.url都需要通过链接检查
+func validatePayload(msg *model.Message) *PayloadError {
+	schemasMu.RLock()
+	schema, ok := schemas[msg.Type]
+	schemasMu.RUnlock()
+	if !ok {
+		return &PayloadError{Code: model.ErrorCodeUnknownType, Message: "未知的消息类型: " + msg.Type}
+	}
+	if len(msg.ClientMsgID) > maxClientMsgIDLength {
+		return invalidPayload("clientMsgId超过长度限制")
+	}
+	if msg.Extra.URL != "" {
+		if err := checkURL(msg.Extra.URL, true); err != nil {
+			return err
+		}
+	}
+	if schema == nil {
+		return nil
+	}
+	return schema(msg)
+}
+
+// validateChat 聊天消息：文本不能为空，图片必须带有效的地址
+func validateChat(msg *model.Message) *PayloadError {
+	if text, ok := msg.Content.(string); ok {
+		return checkText(text, true)
+	}
+	var content model.ChatContent
+	if !decodeContent(msg.Content, &content) {
+		return invalidPayload("聊天消息的内容必须是字符串或{kind, text, url}对象")
+	}
+	switch content.Kind {
+	case model.ChatKindText:
+		return checkText(content.Text, true)
+	case model.ChatKindImage:
+		if content.URL == "" {
+			return invalidPayload("图片消息缺少url")
+		}
+		if content.Width < 0 || content.Height < 0 {
+			return invalidPayload("图片尺寸不能为负数")
+		}
+		if err := checkURL(content.URL, false); err != nil {
+			return err
+		}
+		return checkText(content.Text, false)
+	default:
+		return invalidPayload("不支持的聊天内容类型: " + content.Kind)
+	}
+}
+
+// validateReaction 点赞、收藏通知：必须指定接收者和动态，actionType只能是给定的两种
+func validateReaction(action, undo string) PayloadSchema {
+	return func(msg *model.Message) *PayloadError {
+		if msg.To == "" || msg.Extra.PostID == "" {
+			return invalidPayload(msg.Type + "通知必须指定to和extra.postId")
+		}
+		if a := msg.Extra.ActionType; a != "" && a != action && a != undo {
+			return invalidPayload("actionType只能是" + action + "或" + undo)
+		}
+		return checkOptionalText(msg.Content)
+	}
+}
+
+// validateComment 评论通知：必须指定接收者、动态和评论
+func validateComment(msg *model.Message) *PayloadError {
+	if msg.To == "" || msg.Extra.PostID == "" || msg.Extra.CommentID == "" {
+		return invalidPayload("评论通知必须指定to、extra.postId和extra.commentId")
+	}
+	return checkOptionalText(msg.Content)
+}
+
+// validateMention @通知：必须指定被@的用户以及所在的动态或评论
+func validateMention(msg *model.Message) *PayloadError {
+	if msg.To == "" {
+		return invalidPayload("@通知必须指定to")
+	}
+	if msg.Extra.PostID == "" && msg.Extra.CommentID == "" {
+		return invalidPayload("@通知必须指定extra.postId或extra.commentId")
+	}
+	return checkOptionalText(msg.Content)
+}
+
+// validateSystem 系统消息：正文不能为空
+func validateSystem(msg *model.Message) *PayloadError {
+	if text, ok := msg.Content.(string); ok {
+		return checkText(text, true)
+	}
+	var content model.SystemContent
+	if !decodeContent(msg.Content, &content) {
+		return invalidPayload("系统消息的内容必须是字符串或{title, text}对象")
+	}
+	if err := checkText(content.Title, false); err != nil {
+		return err
+	}
+	return checkText(content.Text, true)
+}
+
+// validateTyping 正在输入：必须指定接收者或房间
+func validateTyping(msg *model.Message) *PayloadError {
+	if msg.To == "" && msg.Extra.RoomID == "" {
+		return invalidPayload("正在输入通知必须指定to或extra.roomId")
+	}
+	return nil
+}
+
+// validateRead 已读回执：必须指定会话和已读到的historyId
+func validateRead(msg *model.Message) *PayloadError {
+	if msg.Extra.ConversationID == "" || msg.Extra.HistoryID == 0 {
+		return invalidPayload("已读回执必须指定extra.conversationId和extra.historyId")
+	}
+	return nil
+}
+
+// checkOptionalText 通知类消息的content可以省略，填写时必须是文本
+func checkOptionalText(content interface{}) *PayloadError {
+	if content == nil {
+		return nil
+	}
+	text, ok := content.(string)
+	if !ok {
+		return invalidPayload("内容必须是字符串")
+	}
+	return checkText(text, false)
+}
+
+// checkText 检查文本长度，按字符计算
+func checkText(text string, required bool) *PayloadError {
+	if required && strings.TrimSpace(text) == "" {
+		return invalidPayload("内容不能为空")
+	}
+	if utf8.RuneCountInString(text) > maxContentLength() {
+		return &PayloadError{Code: model.ErrorCodeTooLarge, Message: "内容超过长度限制"}
+	}
+	return nil
+}
+
+// checkURL 链接只能是http(s)地址，allowPath为true时也可以是站内路径(以/开头)
+func checkURL(raw string, allowPath bool) *PayloadError {
+	if len(raw) > maxURLLength() {
+		return &PayloadError{Code: model.ErrorCodeTooLarge, Message: "链接超过长度限制"}
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return invalidPayload("链接格式错误")
+	}
+	if allowPath && u.Scheme == "" && u.Host == "" && strings.HasPrefix(raw, "/") && !strings.HasPrefix(raw, "//") {
+		return nil
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return invalidPayload("链接必须是http(s)地址")
+	}
+	return nil
+}
+
+// decodeContent 把解析为map的content转换为具体的结构，content不是对象时返回false
+func decodeContent(content interface{}, v interface{}) bool {
+	if _, ok := content.(map[string]interface{}); !ok {
+		return false
+	}
+	data, err := json.Marshal(content)
+	if err != nil {
+		return false
+	}
+	return json.Unmarshal(data, v) == nil
+}
+
+// maxContentLength 文本内容的最大字符数
+func maxContentLength() int {
+	if global.WebSocketConfig().MaxContentLength > 0 {
+		return global.WebSocketConfig().MaxContentLength
+	}
+	return defaultMaxContentLength
+}
+
+// maxURLLength 链接的最大长度
+func maxURLLength() int {
+	if global.WebSocketConfig().MaxURLLength > 0 {
+		return global.WebSocketConfig().MaxURLLength
+	}
+	return defaultMaxURLLength
+}
@@ -0,0 +1,91 @@
+package websocket
+
+import (
+	"campus2/app/websocket/model"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestValidatePayload(t *testing.T) {
+	tests := []struct {
+		name string
+		msg  model.Message
+		code int // 0表示校验通过
+	}{
+		{"未知类型", model.Message{Type: "unknown"}, model.ErrorCodeUnknownType},
+		{"服务端类型不能发送", model.Message{Type: model.MessageTypeDelivered}, model.ErrorCodeUnknownType},
+		{"文本聊天", model.Message{Type: model.MessageTypeChat, To: "u2", Content: "你好"}, 0},
+		{"空文本聊天", model.Message{Type: model.MessageTypeChat, To: "u2", Content: ""}, model.ErrorCodeInvalidPayload},
+		{"文本超长", model.Message{Type: model.MessageTypeChat, To: "u2", Content: strings.Repeat("字", defaultMaxContentLength+1)}, model.ErrorCodeTooLarge},
+		{"图片聊天", model.Message{Type: model.MessageTypeChat, To: "u2", Content: map[string]interface{}{"kind": "image", "url": "https://example.com/a.png"}}, 0},
+		{"图片缺少地址", model.Message{Type: model.MessageTypeChat, To: "u2", Content: map[string]interface{}{"kind": "image"}}, model.ErrorCodeInvalidPayload},
+		{"图片地址不是http", model.Message{Type: model.MessageTypeChat, To: "u2", Content: map[string]interface{}{"kind": "image", "url": "javascript:alert(1)"}}, model.ErrorCodeInvalidPayload},
+		{"不支持的聊天内容", model.Message{Type: model.MessageTypeChat, To: "u2", Content: map[string]interface{}{"kind": "video"}}, model.ErrorCodeInvalidPayload},
+		{"点赞", model.Message{Type: model.MessageTypeLike, To: "u2", Extra: model.MessageExtra{PostID: "p1", ActionType: "unlike"}}, 0},
+		{"点赞缺少动态", model.Message{Type: model.MessageTypeLike, To: "u2"}, model.ErrorCodeInvalidPayload},
+		{"点赞动作错误", model.Message{Type: model.MessageTypeLike, To: "u2", Extra: model.MessageExtra{PostID: "p1", ActionType: "collect"}}, model.ErrorCodeInvalidPayload},
+		{"评论缺少评论ID", model.Message{Type: model.MessageTypeComment, To: "u2", Extra: model.MessageExtra{PostID: "p1"}}, model.ErrorCodeInvalidPayload},
+		{"@通知", model.Message{Type: model.MessageTypeMention, To: "u2", Extra: model.MessageExtra{CommentID: "c1"}}, 0},
+		{"@通知缺少位置", model.Message{Type: model.MessageTypeMention, To: "u2"}, model.ErrorCodeInvalidPayload},
+		{"正在输入", model.Message{Type: model.MessageTypeTyping, To: "u2"}, 0},
+		{"房间内正在输入", model.Message{Type: model.MessageTypeTyping, Extra: model.MessageExtra{RoomID: "1"}}, 0},
+		{"正在输入缺少接收者", model.Message{Type: model.MessageTypeTyping}, model.ErrorCodeInvalidPayload},
+		{"已读回执", model.Message{Type: model.MessageTypeRead, Extra: model.MessageExtra{ConversationID: "single:u1:u2", HistoryID: 3}}, 0},
+		{"已读回执缺少位置", model.Message{Type: model.MessageTypeRead, Extra: model.MessageExtra{ConversationID: "single:u1:u2"}}, model.ErrorCodeInvalidPayload},
+		{"已读回执缺少会话", model.Message{Type: model.MessageTypeRead, Extra: model.MessageExtra{HistoryID: 3}}, model.ErrorCodeInvalidPayload},
+		{"extra链接不是http", model.Message{Type: model.MessageTypeTyping, To: "u2", Extra: model.MessageExtra{URL: "ftp://example.com"}}, model.ErrorCodeInvalidPayload},
+		{"clientMsgId超长", model.Message{Type: model.MessageTypeTyping, To: "u2", ClientMsgID: strings.Repeat("a", maxClientMsgIDLength+1)}, model.ErrorCodeInvalidPayload},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validatePayload(&tt.msg)
+			if tt.code == 0 {
+				if err != nil {
+					t.Fatalf("消息应通过校验，实际为%d %s", err.Code, err.Message)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("应返回错误码%d，实际通过了校验", tt.code)
+			}
+			if err.Code != tt.code {
+				t.Fatalf("应返回错误码%d，实际为%d %s", tt.code, err.Code, err.Message)
+			}
+		})
+	}
+}
+
+func TestHandleTypingToSelf(t *testing.T) {
+	m := newTestManager(t)
+	c := newTestClient(m, "u1", "d1")
+	c.handleTyping(&model.Message{Type: model.MessageTypeTyping, To: "u1"})
+	expectErrorFrame(t, c, model.ErrorCodeInvalidPayload)
+}
+
+func TestHandleReadWithoutDatabase(t *testing.T) {
+	m := newTestManager(t)
+	c := newTestClient(m, "u1", "d1")
+	c.handleRead(&model.Message{Type: model.MessageTypeRead, Extra: model.MessageExtra{ConversationID: "single:u1:u2", HistoryID: 1}})
+	expectErrorFrame(t, c, model.ErrorCodeUnavailable)
+}
+
+// expectErrorFrame 检查客户端收到了指定错误码的error消息
+func expectErrorFrame(t *testing.T, c *Client, code int) {
+	t.Helper()
+	select {
+	case data := <-c.Send:
+		var frame struct {
+			Type    string             `json:"type"`
+			Content model.ErrorContent `json:"content"`
+		}
+		if err := json.Unmarshal(data, &frame); err != nil {
+			t.Fatalf("解析消息失败: %v", err)
+		}
+		if frame.Type != model.MessageTypeError || frame.Content.Code != code {
+			t.Fatalf("应收到错误码为%d的error消息，实际为%s", code, data)
+		}
+	default:
+		t.Fatalf("应收到错误码为%d的error消息，实际没有收到", code)
+	}
+}
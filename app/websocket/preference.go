@@ -0,0 +1,73 @@
+package websocket
+
+import (
+	"campus2/app/websocket/model"
+	"campus2/pkg/global"
+	"encoding/json"
+	"time"
+
+	preferencemodel "campus2/app/preference/model"
+)
+
+// mutedHeader 判断静音时需要读取的消息字段
+type mutedHeader struct {
+	Type    string          `json:"type"`
+	Content json.RawMessage `json:"content"`
+	Extra   struct {
+		RoomID         string `json:"roomId"`
+		ConversationID string `json:"conversationId"`
+	} `json:"extra"`
+}
+
+// muted 按接收者的通知偏好判断消息是否静音，静音的消息只计入静音统计，不推送也不写入离线存储。
+// 只有互动通知、系统消息、摘要和聊天消息受偏好控制；未启用Redis或查询失败时照常推送
+func (m *Manager) muted(userID string, message []byte) bool {
+	if m.redisStore == nil {
+		return false
+	}
+	var header mutedHeader
+	if err := json.Unmarshal(message, &header); err != nil {
+		return false
+	}
+
+	notifyType, count := "", int64(1)
+	switch header.Type {
+	case model.MessageTypeLike, model.MessageTypeCollect, model.MessageTypeComment, model.MessageTypeMention, model.MessageTypeSystem:
+		notifyType = header.Type
+	case model.MessageTypeDigest:
+		var digest model.DigestContent
+		if err := json.Unmarshal(header.Content, &digest); err != nil || digest.Type == "" {
+			return false
+		}
+		notifyType = digest.Type
+		if digest.Total > 0 {
+			count = int64(digest.Total)
+		}
+	case model.MessageTypeChat:
+	default:
+		return false
+	}
+
+	prefs, err := preferencemodel.GetPreferences(userID)
+	if err != nil {
+		global.GVA_LOG.Errorf("查询用户 %s 的通知偏好失败: %v", userID, err)
+		return false
+	}
+	if !prefs.Muted(notifyType, header.Extra.ConversationID, header.Extra.RoomID, time.Now()) {
+		return false
+	}
+
+	field := notifyType
+	if field == "" {
+		field = header.Extra.ConversationID
+		if field == "" {
+			field = header.Extra.RoomID
+		}
+		field = preferencemodel.ConversationField + field
+	}
+	if err := preferencemodel.IncrMuted(userID, field, count); err != nil {
+		global.GVA_LOG.Errorf("记录用户 %s 的静音消息数失败: %v", userID, err)
+	}
+	global.GVA_LOG.Infof("用户 %s 已静音 %s，消息不推送", userID, field)
+	return true
+}
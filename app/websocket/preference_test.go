@@ -0,0 +1,80 @@
+package websocket
+
+import (
+	"campus2/app/websocket/model"
+	"encoding/json"
+	"testing"
+
+	preferencemodel "campus2/app/preference/model"
+)
+
+func TestMuted(t *testing.T) {
+	m, _ := newRedisManager(t)
+	err := preferencemodel.SavePreferences("u1", &preferencemodel.Preferences{
+		Types:              map[string]bool{model.MessageTypeLike: false},
+		MutedConversations: []string{"single:u1:u2"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := model.DigestContent{Type: model.MessageTypeLike, PostID: "p1", Count: 2, Total: 3}
+
+	tests := []struct {
+		name string
+		msg  model.Message
+		want bool
+	}{
+		{"关闭的类型", model.Message{Type: model.MessageTypeLike}, true},
+		{"开启的类型", model.Message{Type: model.MessageTypeComment}, false},
+		{"关闭类型的摘要", model.Message{Type: model.MessageTypeDigest, Content: digest}, true},
+		{"静音的会话", model.Message{Type: model.MessageTypeChat, Extra: model.MessageExtra{ConversationID: "single:u1:u2"}}, true},
+		{"其他会话", model.Message{Type: model.MessageTypeChat, Extra: model.MessageExtra{ConversationID: "single:u1:u3"}}, false},
+		{"控制消息不受偏好影响", model.Message{Type: model.MessageTypeDelivered}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, _ := json.Marshal(tt.msg)
+			if got := m.muted("u1", data); got != tt.want {
+				t.Fatalf("是否静音应为%v，实际为%v", tt.want, got)
+			}
+		})
+	}
+
+	counts, err := preferencemodel.GetMuted("u1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 一条点赞加上摘要中的3条
+	if counts[model.MessageTypeLike] != 4 || counts[preferencemodel.ConversationField+"single:u1:u2"] != 1 {
+		t.Fatalf("静音统计不正确: %v", counts)
+	}
+}
+
+func TestSendToUserSkipsMuted(t *testing.T) {
+	m, _ := newRedisManager(t)
+	preferencemodel.SavePreferences("u1", &preferencemodel.Preferences{Types: map[string]bool{model.MessageTypeLike: false}})
+	c := newTestClient(m, "u1", "d1")
+	m.clients.Store(c.ID, c)
+
+	like, _ := json.Marshal(model.Message{ID: "m1", Type: model.MessageTypeLike, To: "u1"})
+	comment, _ := json.Marshal(model.Message{ID: "m2", Type: model.MessageTypeComment, To: "u1"})
+	m.SendToUser("u1", like)
+	m.SendToUser("u1", comment)
+
+	if len(c.Send) != 1 {
+		t.Fatalf("应只推送评论通知，实际推送了%d条", len(c.Send))
+	}
+	var msg model.Message
+	json.Unmarshal(<-c.Send, &msg)
+	if msg.ID != "m2" || msg.Seq != 1 {
+		t.Fatalf("评论通知的序号应为1(静音的消息不占用序号)，实际为%+v", msg)
+	}
+}
+
+func TestMutedWithoutRedis(t *testing.T) {
+	m := newTestManager(t)
+	data, _ := json.Marshal(model.Message{Type: model.MessageTypeLike})
+	if m.muted("u1", data) {
+		t.Fatal("通知偏好依赖Redis，未启用Redis时不应静音")
+	}
+}
@@ -0,0 +1,298 @@
+package websocket
+
+import (
+	"campus2/app/websocket/model"
+	"campus2/pkg/global"
+	"context"
+	"encoding/json"
+	"time"
+
+	presencemodel "campus2/app/presence/model"
+	presenceservice "campus2/app/presence/service"
+	presencevo "campus2/app/presence/vo"
+)
+
+const (
+	maxPresenceSubs = 1000 // 每个连接最多订阅在线状态的用户数
+	maxUserIDLength = 64   // 用户ID最大长度
+)
+
+// handlePresenceSub 订阅content中列出的用户的在线状态，订阅后立即推送一次这些用户的当前状态
+func (c *Client) handlePresenceSub(msg *model.Message) {
+	userIDs := contentIDs(msg.Content)
+	if len(userIDs) > presenceservice.MaxQueryUsers {
+		userIDs = userIDs[:presenceservice.MaxQueryUsers]
+	}
+	added := c.Manager.addPresenceSubs(c, userIDs)
+	if len(added) == 0 {
+		return
+	}
+	global.GVA_LOG.Infof("客户端 %s 订阅了 %d 个用户的在线状态", c.ID, len(added))
+
+	presences, err := c.Manager.presenceSnapshot(c.UserID, added)
+	if err != nil {
+		global.GVA_LOG.Errorf("查询用户在线状态失败: %v", err)
+		return
+	}
+	c.pushPresence(presences)
+}
+
+// handlePresenceUnsub 取消订阅content中列出的用户的在线状态
+func (c *Client) handlePresenceUnsub(msg *model.Message) {
+	m := c.Manager
+	m.presenceMu.Lock()
+	defer m.presenceMu.Unlock()
+	for _, userID := range contentIDs(msg.Content) {
+		delete(c.presenceOf, userID)
+		m.removeSubscriber(userID, c)
+	}
+}
+
+// handlePresenceStatus 客户端上报自己处于活跃(online)或空闲(idle)状态，
+// 用户的所有在线设备都空闲时才对外显示为空闲
+func (c *Client) handlePresenceStatus(msg *model.Message) {
+	var idle bool
+	switch contentStatus(msg.Content) {
+	case presencemodel.StatusIdle:
+		idle = true
+	case presencemodel.StatusOnline:
+		idle = false
+	default:
+		return
+	}
+	if c.idle.Swap(idle) == idle {
+		return
+	}
+	if c.Manager.redisStore != nil {
+		c.Manager.updateConnInfo(c)
+	}
+	c.Manager.refreshPresence(c.UserID)
+}
+
+// pushPresence 向客户端推送在线状态，推送失败时直接丢弃
+func (c *Client) pushPresence(presences []presencevo.Presence) {
+	data, err := json.Marshal(model.Message{
+		Type:      model.MessageTypePresence,
+		Content:   presences,
+		To:        c.UserID,
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		return
+	}
+	if !c.deliver(data) {
+		global.GVA_LOG.Warnf("向客户端 %s 推送在线状态失败", c.ID)
+	}
+}
+
+// addPresenceSubs 登记订阅，返回本次新增的用户
+func (m *Manager) addPresenceSubs(c *Client, userIDs []string) []string {
+	m.presenceMu.Lock()
+	defer m.presenceMu.Unlock()
+	if c.presenceOf == nil {
+		c.presenceOf = make(map[string]struct{})
+	}
+	var added []string
+	for _, userID := range userIDs {
+		if _, ok := c.presenceOf[userID]; ok {
+			continue
+		}
+		if len(c.presenceOf) >= maxPresenceSubs {
+			global.GVA_LOG.Warnf("客户端 %s 订阅在线状态的用户数已达上限 %d", c.ID, maxPresenceSubs)
+			break
+		}
+		c.presenceOf[userID] = struct{}{}
+		subs, ok := m.presenceSubs[userID]
+		if !ok {
+			subs = make(map[*Client]struct{})
+			m.presenceSubs[userID] = subs
+		}
+		subs[c] = struct{}{}
+		added = append(added, userID)
+	}
+	return added
+}
+
+// dropPresenceSubs 连接注销时移除其所有订阅
+func (m *Manager) dropPresenceSubs(c *Client) {
+	m.presenceMu.Lock()
+	defer m.presenceMu.Unlock()
+	for userID := range c.presenceOf {
+		m.removeSubscriber(userID, c)
+	}
+	c.presenceOf = nil
+}
+
+// removeSubscriber 调用方需持有presenceMu
+func (m *Manager) removeSubscriber(userID string, c *Client) {
+	subs, ok := m.presenceSubs[userID]
+	if !ok {
+		return
+	}
+	delete(subs, c)
+	if len(subs) == 0 {
+		delete(m.presenceSubs, userID)
+	}
+}
+
+// presenceSnapshot 查询用户当前的在线状态，未启用Redis时只能看到本节点上的用户
+func (m *Manager) presenceSnapshot(viewerID string, userIDs []string) ([]presencevo.Presence, error) {
+	if m.redisStore != nil {
+		return m.presenceService.GetPresences(viewerID, userIDs)
+	}
+	m.presenceMu.RLock()
+	defer m.presenceMu.RUnlock()
+	presences := make([]presencevo.Presence, 0, len(userIDs))
+	for _, userID := range userIDs {
+		status, ok := m.localStatus[userID]
+		if !ok {
+			status = presencemodel.StatusOffline
+		}
+		presences = append(presences, presencevo.Presence{UserID: userID, Status: status})
+	}
+	return presences, nil
+}
+
+// currentStatus 根据用户所有设备的连接信息计算在线状态
+func (m *Manager) currentStatus(userID string) string {
+	online, active := false, false
+	if m.redisStore != nil {
+		devices, err := m.lookupDevices(context.Background(), userID)
+		if err != nil {
+			global.GVA_LOG.Errorf("查询用户 %s 的连接信息失败: %v", userID, err)
+		}
+		for _, info := range devices {
+			online = true
+			active = active || !info.Idle
+		}
+	} else {
+		m.clients.Range(func(key, value interface{}) bool {
+			client := value.(*Client)
+			if client.UserID == userID {
+				online = true
+				active = active || !client.idle.Load()
+			}
+			return true
+		})
+	}
+	switch {
+	case !online:
+		return presencemodel.StatusOffline
+	case active:
+		return presencemodel.StatusOnline
+	default:
+		return presencemodel.StatusIdle
+	}
+}
+
+// refreshPresence 重新计算用户的在线状态，与上次广播的状态不同时通知所有订阅者。
+// 启用Redis时通过频道广播给所有节点(包括本节点)，否则只通知本节点的订阅者
+func (m *Manager) refreshPresence(userID string) {
+	status := m.currentStatus(userID)
+	event := &presencemodel.Event{UserID: userID, Status: status}
+	if status == presencemodel.StatusOffline {
+		event.LastSeen = time.Now().Unix()
+	}
+
+	if m.redisStore != nil {
+		old, err := presencemodel.SwapStatus(userID, status)
+		if err != nil {
+			global.GVA_LOG.Errorf("更新用户 %s 的在线状态失败: %v", userID, err)
+			return
+		}
+		if old == status {
+			return
+		}
+		global.GVA_LOG.Infof("用户 %s 的在线状态由 %s 变为 %s", userID, old, status)
+		if err := presencemodel.PublishEvent(event); err != nil {
+			global.GVA_LOG.Errorf("广播用户 %s 的在线状态失败: %v", userID, err)
+		}
+		return
+	}
+
+	m.presenceMu.Lock()
+	old, ok := m.localStatus[userID]
+	if !ok {
+		old = presencemodel.StatusOffline
+	}
+	if status == presencemodel.StatusOffline {
+		delete(m.localStatus, userID)
+	} else {
+		m.localStatus[userID] = status
+	}
+	m.presenceMu.Unlock()
+	if old != status {
+		m.dispatchPresence(event, presencemodel.VisibilityEveryone)
+	}
+}
+
+// subscribePresence 订阅在线状态变更频道，推送给本节点上的订阅者
+func (m *Manager) subscribePresence() {
+	pubsub := m.subscribe(presencemodel.EventChannel)
+	if pubsub == nil {
+		return
+	}
+	defer pubsub.Close()
+	global.GVA_LOG.Infof("已订阅在线状态频道: %s", presencemodel.EventChannel)
+	m.trackPubSub(pubsub)
+
+	for msg := range pubsub.Channel() {
+		var event presencemodel.Event
+		if err := json.Unmarshal([]byte(msg.Payload), &event); err != nil {
+			global.GVA_LOG.Errorf("解析在线状态事件失败: %v", err)
+			continue
+		}
+		m.presenceMu.RLock()
+		_, subscribed := m.presenceSubs[event.UserID]
+		m.presenceMu.RUnlock()
+		if !subscribed {
+			continue
+		}
+		visibilities, err := presencemodel.GetVisibilities([]string{event.UserID})
+		if err != nil {
+			global.GVA_LOG.Errorf("查询用户 %s 的在线状态隐私设置失败: %v", event.UserID, err)
+			continue
+		}
+		m.dispatchPresence(&event, visibilities[event.UserID])
+	}
+}
+
+// dispatchPresence 按隐私设置向本节点上订阅了该用户的连接推送在线状态
+func (m *Manager) dispatchPresence(event *presencemodel.Event, visibility string) {
+	m.presenceMu.RLock()
+	subscribers := make([]*Client, 0, len(m.presenceSubs[event.UserID]))
+	for client := range m.presenceSubs[event.UserID] {
+		subscribers = append(subscribers, client)
+	}
+	m.presenceMu.RUnlock()
+
+	for _, client := range subscribers {
+		presence := presenceservice.ToPresence(event, visibility, client.UserID)
+		client.pushPresence([]presencevo.Presence{presence})
+	}
+}
+
+// contentIDs 读取消息内容中的用户ID列表
+func contentIDs(content interface{}) []string {
+	items, ok := content.([]interface{})
+	if !ok {
+		return nil
+	}
+	ids := make([]string, 0, len(items))
+	for _, item := range items {
+		if id, ok := item.(string); ok && id != "" && len(id) <= maxUserIDLength {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// contentStatus 读取客户端上报的状态 {"status": "idle"}
+func contentStatus(content interface{}) string {
+	fields, ok := content.(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	status, _ := fields["status"].(string)
+	return status
+}
@@ -0,0 +1,244 @@
+package websocket
+
+import (
+	"campus2/app/websocket/model"
+	"campus2/pkg/config"
+	"campus2/pkg/global"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// 上行消息限流的默认参数，配置未设置时使用
+const (
+	defaultRateLimit = 10 // 每个用户每秒补充的令牌数
+	defaultRateBurst = 30 // 每个用户的桶容量
+)
+
+const (
+	rateKeyPrefix      = "ws:rate:"         // Hash存储令牌桶 ws:rate:{userID}:type，type为*时表示所有类型合计，{userID}为集群哈希标签
+	rateFailRetry      = time.Second        // 按配置拒绝时建议的重试等待时间
+	violationKeyPrefix = "ws:violations:"   // ZSet按天统计用户被限流的次数 ws:violations:{yyyymmdd}
+	violationTTL       = 7 * 24 * time.Hour // 违规统计保留时间
+	throttleNoticeGap  = time.Second        // 同一连接两次限流提示的最小间隔
+)
+
+// defaultTypeRules 按消息类型的默认限流参数，可通过websocket.rateLimit.types覆盖
+var defaultTypeRules = map[string]config.RateLimitRule{
+	model.MessageTypeChat:        {Rate: 5, Burst: 10},
+	model.MessageTypeTyping:      {Rate: 1, Burst: 3},
+	model.MessageTypePresenceSub: {Rate: 1, Burst: 5},
+}
+
+// tokenBucketScript 同时检查多个令牌桶，全部有令牌时才各扣除一个。
+// KEYS为令牌桶，ARGV[1]为当前毫秒时间，之后每两个参数依次为对应桶的rate和burst。
+// 返回{是否放行, 建议等待的毫秒数}
+var tokenBucketScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local states = {}
+local wait = 0
+for i, key in ipairs(KEYS) do
+	local rate = tonumber(ARGV[i * 2])
+	local burst = tonumber(ARGV[i * 2 + 1])
+	local data = redis.call('HMGET', key, 'tokens', 'ts')
+	local tokens = tonumber(data[1])
+	local ts = tonumber(data[2])
+	if tokens == nil or ts == nil then
+		tokens = burst
+		ts = now
+	end
+	tokens = math.min(burst, tokens + math.max(0, now - ts) * rate / 1000)
+	if tokens < 1 then
+		wait = math.max(wait, math.ceil((1 - tokens) * 1000 / rate))
+	end
+	states[i] = {tokens, rate, burst}
+end
+local allowed = 0
+if wait == 0 then
+	allowed = 1
+end
+for i, key in ipairs(KEYS) do
+	local tokens = states[i][1]
+	if allowed == 1 then
+		tokens = tokens - 1
+	end
+	redis.call('HSET', key, 'tokens', tostring(tokens), 'ts', now)
+	redis.call('PEXPIRE', key, math.ceil(states[i][3] * 1000 / states[i][2]) + 1000)
+end
+return {allowed, wait}
+`)
+
+// tokenBucket 未启用Redis时在连接上使用的本地令牌桶
+type tokenBucket struct {
+	tokens float64
+	ts     time.Time
+}
+
+// rateRules 返回消息需要检查的令牌桶 map[桶名]参数，限流关闭时返回nil
+func rateRules(msgType string) map[string]config.RateLimitRule {
+	cfg := global.WebSocketConfig().RateLimit
+	if cfg.Disabled {
+		return nil
+	}
+	total := config.RateLimitRule{Rate: cfg.Rate, Burst: cfg.Burst}
+	if total.Rate <= 0 || total.Burst <= 0 {
+		total = config.RateLimitRule{Rate: defaultRateLimit, Burst: defaultRateBurst}
+	}
+	rules := map[string]config.RateLimitRule{"*": total}
+
+	rule, ok := cfg.Types[msgType]
+	if !ok {
+		rule, ok = defaultTypeRules[msgType]
+	}
+	if ok && rule.Rate > 0 && rule.Burst > 0 {
+		rules[msgType] = rule
+	}
+	return rules
+}
+
+// allow 检查用户发送该类型的消息是否超过限流，返回是否放行和建议的重试等待时间。
+// 启用Redis时令牌桶按用户在所有节点间共享。Redis出错时按failClosed配置拒绝消息，
+// 或退回本连接的本地令牌桶，两种情况都会记录警告并计入连接的rateLimitErrors
+func (c *Client) allow(msgType string) (bool, time.Duration) {
+	rules := rateRules(msgType)
+	if len(rules) == 0 {
+		return true, 0
+	}
+	now := time.Now()
+
+	if c.Manager.redisStore != nil {
+		allowed, wait, err := c.allowShared(rules, now)
+		if err == nil {
+			return allowed, wait
+		}
+		c.metrics.rateLimitErrors.Add(1)
+		if global.WebSocketConfig().RateLimit.FailClosed {
+			global.GVA_LOG.Warnf("检查用户 %s 的限流失败，按配置拒绝消息: %v", c.UserID, err)
+			return false, rateFailRetry
+		}
+		global.GVA_LOG.Warnf("检查用户 %s 的限流失败，改用本连接的令牌桶: %v", c.UserID, err)
+	}
+	return c.allowLocal(rules, now)
+}
+
+// allowShared 使用Redis中按用户共享的令牌桶，所有桶的key带有相同的哈希标签，集群模式下位于同一个slot
+func (c *Client) allowShared(rules map[string]config.RateLimitRule, now time.Time) (bool, time.Duration, error) {
+	keys := make([]string, 0, len(rules))
+	args := []interface{}{now.UnixMilli()}
+	for name, rule := range rules {
+		keys = append(keys, rateKey(c.UserID, name))
+		args = append(args, rule.Rate, rule.Burst)
+	}
+	result, err := tokenBucketScript.Run(context.Background(), global.GVA_REDIS, keys, args...).Int64Slice()
+	if err != nil {
+		return false, 0, err
+	}
+	if len(result) != 2 {
+		return false, 0, fmt.Errorf("限流脚本返回了%d个值", len(result))
+	}
+	return result[0] == 1, time.Duration(result[1]) * time.Millisecond, nil
+}
+
+// rateKey 用户某个令牌桶的key
+func rateKey(userID, name string) string {
+	return rateKeyPrefix + "{" + userID + "}:" + name
+}
+
+// allowLocal 使用连接上的本地令牌桶，只在读循环中调用，不需要加锁
+func (c *Client) allowLocal(rules map[string]config.RateLimitRule, now time.Time) (bool, time.Duration) {
+	if c.buckets == nil {
+		c.buckets = make(map[string]*tokenBucket)
+	}
+	var wait time.Duration
+	for name, rule := range rules {
+		b, ok := c.buckets[name]
+		if !ok {
+			b = &tokenBucket{tokens: float64(rule.Burst), ts: now}
+			c.buckets[name] = b
+		}
+		b.tokens = math.Min(float64(rule.Burst), b.tokens+now.Sub(b.ts).Seconds()*rule.Rate)
+		b.ts = now
+		if b.tokens < 1 {
+			if w := time.Duration((1 - b.tokens) / rule.Rate * float64(time.Second)); w > wait {
+				wait = w
+			}
+		}
+	}
+	if wait > 0 {
+		return false, wait
+	}
+	for name := range rules {
+		c.buckets[name].tokens--
+	}
+	return true, 0
+}
+
+// throttle 拒绝超过限流的消息：记录违规次数，并向客户端返回限流错误
+func (c *Client) throttle(msg *model.Message, retryAfter time.Duration) {
+	global.GVA_LOG.Warnf("客户端 %s 发送 %s 消息过于频繁，已拒绝", c.ID, msg.Type)
+	c.Manager.recordViolation(c.UserID)
+
+	// 持续刷屏时每秒最多提示一次，避免错误消息本身占满发送队列
+	now := time.Now()
+	if now.Sub(c.throttledAt) < throttleNoticeGap {
+		return
+	}
+	c.throttledAt = now
+	c.sendError(model.ErrorCodeRateLimited, "发送过于频繁，请稍后再试", msg, retryAfter)
+}
+
+// canBroadcast 只有配置中允许的角色可以发送全员广播
+func (c *Client) canBroadcast() bool {
+	roles := global.WebSocketConfig().BroadcastRoles
+	if len(roles) == 0 {
+		roles = []string{"admin"}
+	}
+	for _, role := range roles {
+		if c.Role != "" && c.Role == role {
+			return true
+		}
+	}
+	return false
+}
+
+// sendError 向客户端返回错误消息，ref为被拒绝的消息，错误消息不需要确认
+func (c *Client) sendError(code int, message string, ref *model.Message, retryAfter time.Duration) {
+	content := model.ErrorContent{
+		Code:       code,
+		Message:    message,
+		RetryAfter: retryAfter.Milliseconds(),
+	}
+	if ref != nil {
+		content.RefType = ref.Type
+		content.RefID = ref.ClientMsgID
+	}
+	data, err := json.Marshal(model.Message{
+		Type:      model.MessageTypeError,
+		Content:   content,
+		To:        c.UserID,
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		return
+	}
+	c.deliver(data)
+}
+
+// recordViolation 按天累计用户被限流的次数，供管理员排查刷屏用户
+func (m *Manager) recordViolation(userID string) {
+	if m.redisStore == nil {
+		return
+	}
+	ctx := context.Background()
+	key := violationKeyPrefix + time.Now().Format("20060102")
+	pipe := global.GVA_REDIS.Pipeline()
+	pipe.ZIncrBy(ctx, key, 1, userID)
+	pipe.Expire(ctx, key, violationTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		global.GVA_LOG.Errorf("记录用户 %s 的限流次数失败: %v", userID, err)
+	}
+}
@@ -0,0 +1,123 @@
+package websocket
+
+import (
+	"campus2/app/websocket/model"
+	"campus2/pkg/config"
+	"campus2/pkg/global"
+	"testing"
+	"time"
+)
+
+func TestRateRules(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  config.RateLimit
+		typ  string
+		want map[string]config.RateLimitRule
+	}{
+		{"关闭限流", config.RateLimit{Disabled: true}, model.MessageTypeChat, nil},
+		{"使用默认值", config.RateLimit{}, model.MessageTypeChat, map[string]config.RateLimitRule{
+			"*":                   {Rate: defaultRateLimit, Burst: defaultRateBurst},
+			model.MessageTypeChat: {Rate: 5, Burst: 10},
+		}},
+		{"没有单独限制的类型", config.RateLimit{Rate: 2, Burst: 4}, model.MessageTypeLike, map[string]config.RateLimitRule{
+			"*": {Rate: 2, Burst: 4},
+		}},
+		{"配置覆盖类型默认值", config.RateLimit{Types: map[string]config.RateLimitRule{model.MessageTypeTyping: {Rate: 3, Burst: 6}}}, model.MessageTypeTyping, map[string]config.RateLimitRule{
+			"*":                     {Rate: defaultRateLimit, Burst: defaultRateBurst},
+			model.MessageTypeTyping: {Rate: 3, Burst: 6},
+		}},
+		{"无效的类型配置被忽略", config.RateLimit{Types: map[string]config.RateLimitRule{model.MessageTypeLike: {Rate: 0, Burst: 6}}}, model.MessageTypeLike, map[string]config.RateLimitRule{
+			"*": {Rate: defaultRateLimit, Burst: defaultRateBurst},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newTestManager(t)
+			global.GVA_CONFIG.WebSocket.RateLimit = tt.cfg
+			got := rateRules(tt.typ)
+			if len(got) != len(tt.want) {
+				t.Fatalf("限流规则应为%v，实际为%v", tt.want, got)
+			}
+			for name, rule := range tt.want {
+				if got[name] != rule {
+					t.Fatalf("%s的限流规则应为%v，实际为%v", name, rule, got[name])
+				}
+			}
+		})
+	}
+}
+
+func TestAllowLocal(t *testing.T) {
+	m := newTestManager(t)
+	global.GVA_CONFIG.WebSocket.RateLimit = config.RateLimit{Rate: 1, Burst: 2}
+	c := newTestClient(m, "u1", "d1")
+
+	for i := 0; i < 2; i++ {
+		if ok, _ := c.allow(model.MessageTypeLike); !ok {
+			t.Fatalf("桶容量内的第%d条消息不应被拒绝", i)
+		}
+	}
+	ok, wait := c.allow(model.MessageTypeLike)
+	if ok || wait <= 0 || wait > time.Second {
+		t.Fatalf("超过桶容量应被拒绝且等待时间在(0, 1s]内，实际为ok=%v wait=%v", ok, wait)
+	}
+
+	// 模拟经过一秒，补充一个令牌
+	c.buckets["*"].ts = c.buckets["*"].ts.Add(-time.Second)
+	if ok, _ := c.allow(model.MessageTypeLike); !ok {
+		t.Fatal("补充令牌后应允许发送")
+	}
+}
+
+func TestAllowSharedAcrossDevices(t *testing.T) {
+	m, mr := newRedisManager(t)
+	global.GVA_CONFIG.WebSocket.RateLimit = config.RateLimit{Rate: 1, Burst: 2}
+	phone, laptop := newTestClient(m, "u1", "phone"), newTestClient(m, "u1", "laptop")
+
+	if ok, _ := phone.allow(model.MessageTypeLike); !ok {
+		t.Fatal("第一条消息不应被拒绝")
+	}
+	if ok, _ := laptop.allow(model.MessageTypeLike); !ok {
+		t.Fatal("第二条消息不应被拒绝")
+	}
+	if ok, wait := phone.allow(model.MessageTypeLike); ok || wait <= 0 {
+		t.Fatalf("共享的令牌桶应已耗尽，实际为ok=%v wait=%v", ok, wait)
+	}
+	if !mr.Exists("ws:rate:{u1}:*") {
+		t.Fatalf("令牌桶的key应带有hash tag，实际为%v", mr.Keys())
+	}
+	if ok, _ := newTestClient(m, "u2", "d1").allow(model.MessageTypeLike); !ok {
+		t.Fatal("其他用户应使用自己的令牌桶")
+	}
+}
+
+func TestAllowRedisFailure(t *testing.T) {
+	tests := []struct {
+		name       string
+		failClosed bool
+		want       bool
+	}{
+		{"退回本地令牌桶", false, true},
+		{"按配置拒绝", true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, mr := newRedisManager(t)
+			global.GVA_CONFIG.WebSocket.RateLimit = config.RateLimit{FailClosed: tt.failClosed}
+			c := newTestClient(m, "u1", "d1")
+			mr.Close()
+
+			ok, wait := c.allow(model.MessageTypeLike)
+			if ok != tt.want {
+				t.Fatalf("是否允许发送应为%v，实际为%v", tt.want, ok)
+			}
+			if !ok && wait != rateFailRetry {
+				t.Fatalf("重试等待时间应为%v，实际为%v", rateFailRetry, wait)
+			}
+			if got := c.Metrics().RateLimitErrors; got != 1 {
+				t.Fatalf("应记录1次限流错误，实际为%d次", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package websocket
+
+import (
+	"campus2/app/websocket/model"
+	"campus2/pkg/global"
+	"encoding/json"
+	"errors"
+	"time"
+
+	chatservice "campus2/app/chat/service"
+)
+
+// typingInterval 同一连接向同一会话转发"正在输入"的最小间隔，间隔内重复的通知直接丢弃
+const typingInterval = 2 * time.Second
+
+// handleTyping 转发"正在输入"通知。通知只推送给在线设备，不分配消息ID、不需要确认、不写入离线存储。
+// 接收者和房间已由validateTyping检查，无法转发时通过error消息告知客户端
+func (c *Client) handleTyping(msg *model.Message) {
+	target := msg.To
+	if msg.Extra.RoomID != "" {
+		target = "room:" + msg.Extra.RoomID
+	}
+	if target == c.UserID {
+		c.sendError(model.ErrorCodeInvalidPayload, "不能向自己发送正在输入通知", msg, 0)
+		return
+	}
+
+	now := time.Now()
+	if c.typingAt == nil {
+		c.typingAt = make(map[string]time.Time)
+	}
+	if last, ok := c.typingAt[target]; ok && now.Sub(last) < typingInterval {
+		return
+	}
+	c.typingAt[target] = now
+	// 清理过期的记录，避免长连接上记录无限增长
+	if len(c.typingAt) > 64 {
+		for key, at := range c.typingAt {
+			if now.Sub(at) >= typingInterval {
+				delete(c.typingAt, key)
+			}
+		}
+	}
+
+	if msg.Extra.RoomID != "" {
+		members, err := c.Manager.roomMembers(c.UserID, msg.Extra.RoomID)
+		if err != nil {
+			global.GVA_LOG.Debugf("客户端 %s 发送正在输入通知失败: %v", c.ID, err)
+			c.sendRoomError(err, msg)
+			return
+		}
+		msg.To = ""
+		data, _ := json.Marshal(msg)
+		for _, userID := range members {
+			if userID != c.UserID {
+				c.Manager.sendEphemeral(userID, data)
+			}
+		}
+		return
+	}
+
+	data, _ := json.Marshal(msg)
+	c.Manager.sendEphemeral(msg.To, data)
+}
+
+// handleRead 处理已读回执：持久化用户在会话中的已读位置，位置前进时通知会话的所有参与者，
+// 包括该用户的其他设备，用于同步未读状态。会话和位置已由validateRead检查，处理失败时通过error消息告知客户端
+func (c *Client) handleRead(msg *model.Message) {
+	chatService := c.Manager.chatService
+	if chatService == nil {
+		c.sendError(model.ErrorCodeUnavailable, "未启用数据库，无法同步已读状态", msg, 0)
+		return
+	}
+	conversationID := msg.Extra.ConversationID
+
+	mark, advanced, err := chatService.MarkRead(c.UserID, conversationID, msg.Extra.HistoryID)
+	if err != nil {
+		global.GVA_LOG.Errorf("更新用户 %s 在会话 %s 的已读位置失败: %v", c.UserID, conversationID, err)
+		switch {
+		case errors.Is(err, chatservice.ErrNotParticipant):
+			c.sendError(model.ErrorCodeForbidden, err.Error(), msg, 0)
+		case errors.Is(err, chatservice.ErrInvalidConversation), errors.Is(err, chatservice.ErrInvalidReadPosition):
+			c.sendError(model.ErrorCodeInvalidPayload, err.Error(), msg, 0)
+		default:
+			c.sendError(model.ErrorCodeUnavailable, "更新已读位置失败，请稍后重试", msg, 0)
+		}
+		return
+	}
+	if !advanced {
+		return
+	}
+	global.GVA_LOG.Infof("用户 %s 在会话 %s 已读到 %d", c.UserID, conversationID, mark.HistoryID)
+
+	participants, err := chatService.Participants(conversationID)
+	if err != nil {
+		global.GVA_LOG.Errorf("查询会话 %s 的参与者失败: %v", conversationID, err)
+		c.sendError(model.ErrorCodeUnavailable, "已读位置已保存，但通知会话参与者失败", msg, 0)
+		return
+	}
+	data, err := json.Marshal(model.Message{
+		Type:      model.MessageTypeRead,
+		From:      c.UserID,
+		CreatedAt: mark.ReadAt,
+		Extra: model.MessageExtra{
+			ConversationID: conversationID,
+			HistoryID:      mark.HistoryID,
+		},
+	})
+	if err != nil {
+		return
+	}
+	// 离线的参与者上线后通过会话列表或 GET /chat/conversations/:id/reads 获取已读位置
+	for _, userID := range participants {
+		c.Manager.sendEphemeral(userID, data)
+	}
+}
@@ -0,0 +1,284 @@
+package websocket
+
+import (
+	"campus2/app/websocket/model"
+	"campus2/pkg/global"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	seqKeyPrefix            = "ws:seq:"    // String存储用户最近分配的序号 ws:seq:{userID}，{userID}为集群哈希标签
+	seqIDsKeyPrefix         = "ws:seqids:" // ZSet记录最近的消息ID已分配的序号 ws:seqids:{userID}，score为序号
+	replayKeyPrefix         = "ws:replay:" // ZSet存储用户最近的下行消息 ws:replay:{userID}，score为序号
+	defaultResumeBufferSize = 500          // 每个用户保留的消息数，配置未设置时使用
+	localReplayLimit        = 10000        // 本地重放缓冲超过该用户数时清理过期记录
+)
+
+// localReplay 未启用Redis时在节点内存中分配序号并保留最近的消息，仅适用于单节点
+type localReplay struct {
+	mu    sync.Mutex
+	users map[string]*replayBuffer
+}
+
+type replayBuffer struct {
+	seq      uint64
+	frames   [][]byte // 按序号递增，最多resumeBufferSize条
+	expireAt time.Time
+}
+
+// assignSeqScript 为消息分配序号，同一消息ID重复分配时返回已有的序号。
+// 广播由每个节点分别推送给本节点上的设备，同一用户在多个节点上的设备因此收到相同的序号。
+// KEYS为用户的序号和消息ID记录，ARGV为消息ID、保留的毫秒数和保留的条数，返回{序号, 是否新分配}
+var assignSeqScript = redis.NewScript(`
+local existing = redis.call('ZSCORE', KEYS[2], ARGV[1])
+if existing then
+	return {tonumber(existing), 0}
+end
+local seq = redis.call('INCR', KEYS[1])
+redis.call('ZADD', KEYS[2], seq, ARGV[1])
+redis.call('ZREMRANGEBYRANK', KEYS[2], 0, -tonumber(ARGV[3]) - 1)
+redis.call('PEXPIRE', KEYS[1], ARGV[2])
+redis.call('PEXPIRE', KEYS[2], ARGV[2])
+return {seq, 1}
+`)
+
+// seqKey 用户的序号key，同一用户的序号、消息ID记录和重放缓冲使用相同的哈希标签
+func seqKey(userID string) string {
+	return seqKeyPrefix + "{" + userID + "}"
+}
+
+// seqIDsKey 用户最近的消息ID已分配的序号
+func seqIDsKey(userID string) string {
+	return seqIDsKeyPrefix + "{" + userID + "}"
+}
+
+// replayKey 用户的重放缓冲
+func replayKey(userID string) string {
+	return replayKeyPrefix + "{" + userID + "}"
+}
+
+// resumeBufferSize 每个用户保留的可重放消息数
+func resumeBufferSize() int {
+	return positiveOr(global.WebSocketConfig().ResumeBufferSize, defaultResumeBufferSize)
+}
+
+// sequence 为发给用户的消息分配递增的序号并写入重放缓冲，返回带序号的消息。
+// 启用Redis时同一消息ID只分配一次序号；临时消息不分配序号；分配失败时原样返回，客户端重连时无法续传这条消息
+func (m *Manager) sequence(userID string, message []byte) []byte {
+	var msg model.Message
+	if err := json.Unmarshal(message, &msg); err != nil || isEphemeral(msg.Type) || msg.Seq != 0 {
+		return message
+	}
+
+	if m.redisStore != nil {
+		ctx := context.Background()
+		window := global.WebSocketConfig().GetResumeWindow()
+		var (
+			seq      int64
+			assigned = true
+			err      error
+		)
+		if msg.ID == "" {
+			seq, err = global.GVA_REDIS.Incr(ctx, seqKey(userID)).Result()
+			if err == nil {
+				err = global.GVA_REDIS.Expire(ctx, seqKey(userID), window).Err()
+			}
+		} else {
+			var result []int64
+			result, err = assignSeqScript.Run(ctx, global.GVA_REDIS, []string{seqKey(userID), seqIDsKey(userID)},
+				msg.ID, window.Milliseconds(), resumeBufferSize()).Int64Slice()
+			if err == nil && len(result) == 2 {
+				seq, assigned = result[0], result[1] == 1
+			} else if err == nil {
+				err = fmt.Errorf("分配序号的脚本返回了%d个值", len(result))
+			}
+		}
+		if err != nil {
+			global.GVA_LOG.Errorf("分配用户 %s 的消息序号失败: %v", userID, err)
+			return message
+		}
+		msg.Seq = uint64(seq)
+		data, err := json.Marshal(msg)
+		if err != nil {
+			return message
+		}
+		if !assigned {
+			return data // 其他节点已写入重放缓冲
+		}
+		key := replayKey(userID)
+		pipe := global.GVA_REDIS.Pipeline()
+		pipe.ZAdd(ctx, key, redis.Z{Score: float64(seq), Member: data})
+		pipe.ZRemRangeByRank(ctx, key, 0, int64(-resumeBufferSize()-1))
+		pipe.Expire(ctx, key, window)
+		if _, err := pipe.Exec(ctx); err != nil {
+			global.GVA_LOG.Errorf("写入用户 %s 的重放缓冲失败: %v", userID, err)
+		}
+		return data
+	}
+
+	r := &m.replay
+	now := time.Now()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.users == nil {
+		r.users = make(map[string]*replayBuffer)
+	}
+	buf, ok := r.users[userID]
+	if !ok || !now.Before(buf.expireAt) {
+		if len(r.users) >= localReplayLimit {
+			for id, b := range r.users {
+				if !now.Before(b.expireAt) {
+					delete(r.users, id)
+				}
+			}
+		}
+		buf = &replayBuffer{}
+		r.users[userID] = buf
+	}
+	buf.seq++
+	msg.Seq = buf.seq
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return message
+	}
+	buf.frames = append(buf.frames, data)
+	if over := len(buf.frames) - resumeBufferSize(); over > 0 {
+		buf.frames = buf.frames[over:]
+	}
+	buf.expireAt = now.Add(global.WebSocketConfig().GetResumeWindow())
+	return data
+}
+
+// replayFrames 获取序号大于after的消息和当前最新序号。after之后的消息已经不在缓冲中(间隔过大或序号已过期重置)时ok为false
+func (m *Manager) replayFrames(userID string, after uint64) (frames [][]byte, latest uint64, ok bool) {
+	if m.redisStore != nil {
+		ctx := context.Background()
+		latest, err := global.GVA_REDIS.Get(ctx, seqKey(userID)).Uint64()
+		if err != nil && !errors.Is(err, redis.Nil) {
+			global.GVA_LOG.Errorf("查询用户 %s 的消息序号失败: %v", userID, err)
+			return nil, 0, false
+		}
+		if after == latest {
+			return nil, latest, true
+		}
+		if after > latest {
+			return nil, latest, false
+		}
+		items, err := global.GVA_REDIS.ZRangeByScoreWithScores(ctx, replayKey(userID), &redis.ZRangeBy{
+			Min: "(" + strconv.FormatUint(after, 10),
+			Max: strconv.FormatUint(latest, 10),
+		}).Result()
+		if err != nil {
+			global.GVA_LOG.Errorf("读取用户 %s 的重放缓冲失败: %v", userID, err)
+			return nil, latest, false
+		}
+		if len(items) == 0 || uint64(items[0].Score) != after+1 {
+			return nil, latest, false
+		}
+		frames = make([][]byte, 0, len(items))
+		for _, item := range items {
+			frames = append(frames, []byte(item.Member.(string)))
+		}
+		return frames, latest, true
+	}
+
+	r := &m.replay
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	buf, exists := r.users[userID]
+	if !exists || !time.Now().Before(buf.expireAt) {
+		return nil, 0, after == 0
+	}
+	latest = buf.seq
+	if after == latest {
+		return nil, latest, true
+	}
+	// frames[i]的序号为first+i
+	first := buf.seq - uint64(len(buf.frames)) + 1
+	if after > latest || after+1 < first {
+		return nil, latest, false
+	}
+	frames = append(frames, buf.frames[after+1-first:]...)
+	return frames, latest, true
+}
+
+// resume 客户端重连时携带resume_from(已处理的最大序号)，重新推送之后的消息，返回已重放到的序号。
+// 缺失的消息已不在缓冲中时通知客户端全量同步并返回0，此时离线消息照常推送
+func (c *Client) resume(resumeFrom string) uint64 {
+	if resumeFrom == "" {
+		return 0
+	}
+	after, err := strconv.ParseUint(resumeFrom, 10, 64)
+	if err != nil {
+		global.GVA_LOG.Warnf("客户端 %s 的resume_from参数无效: %s", c.ID, resumeFrom)
+		return 0
+	}
+	frames, latest, ok := c.Manager.replayFrames(c.UserID, after)
+	if !ok {
+		global.GVA_LOG.Infof("客户端 %s 从序号 %d 续传失败，最新序号为 %d，通知客户端全量同步", c.ID, after, latest)
+		c.sendResync(after, latest)
+		return 0
+	}
+	global.GVA_LOG.Infof("客户端 %s 从序号 %d 续传 %d 条消息", c.ID, after, len(frames))
+	for _, frame := range frames {
+		if !c.deliverNow(frame) {
+			// 未能放入发送队列的消息转入离线存储，下次连接时推送
+			c.Manager.storeOffline(c.UserID, frame)
+		}
+	}
+	return latest
+}
+
+// sendResync 通知客户端无法续传，需要通过聊天记录接口全量同步
+func (c *Client) sendResync(after, latest uint64) {
+	data, err := json.Marshal(model.Message{
+		Type:      model.MessageTypeResync,
+		Content:   model.ResyncContent{From: after, Latest: latest},
+		To:        c.UserID,
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		return
+	}
+	c.deliverNow(data)
+}
+
+// holdLive 续传期间暂存实时推送的消息，返回是否已暂存。
+// 连接先注册再读取重放缓冲，注册后分配序号的消息可能同时出现在重放和实时推送中，暂存后由releaseLive去重
+func (c *Client) holdLive(message []byte) bool {
+	if !c.resuming.Load() {
+		return false
+	}
+	c.resumeMu.Lock()
+	defer c.resumeMu.Unlock()
+	if !c.resuming.Load() {
+		return false
+	}
+	c.held = append(c.held, message)
+	return true
+}
+
+// releaseLive 续传完成后按顺序推送暂存的消息，跳过序号不大于replayed(已通过续传推送)的消息
+func (c *Client) releaseLive(replayed uint64) {
+	c.resumeMu.Lock()
+	defer c.resumeMu.Unlock()
+	for _, message := range c.held {
+		var h frameHeader
+		if err := json.Unmarshal(message, &h); err == nil && h.Seq != 0 && h.Seq <= replayed {
+			continue
+		}
+		if !c.deliverNow(message) {
+			c.Manager.storeOffline(c.UserID, message)
+		}
+	}
+	c.held = nil
+	c.resuming.Store(false)
+}
@@ -0,0 +1,167 @@
+package websocket
+
+import (
+	"campus2/app/websocket/model"
+	"campus2/pkg/global"
+	"encoding/json"
+	"strconv"
+	"testing"
+)
+
+// replayManagers 分别使用本地缓冲和Redis的管理器
+var replayManagers = []struct {
+	name  string
+	setup func(t *testing.T) *Manager
+}{
+	{"本地", newTestManager},
+	{"Redis", func(t *testing.T) *Manager {
+		m, _ := newRedisManager(t)
+		return m
+	}},
+}
+
+// sequenced 为用户生成一条业务消息并分配序号
+func sequenced(t *testing.T, m *Manager, userID, id string) uint64 {
+	t.Helper()
+	data, _ := json.Marshal(model.Message{ID: id, Type: model.MessageTypeLike, To: userID})
+	var msg model.Message
+	if err := json.Unmarshal(m.sequence(userID, data), &msg); err != nil {
+		t.Fatal(err)
+	}
+	return msg.Seq
+}
+
+func TestSequenceAndReplay(t *testing.T) {
+	for _, tt := range replayManagers {
+		t.Run(tt.name, func(t *testing.T) {
+			m := tt.setup(t)
+			global.GVA_CONFIG.WebSocket.ResumeBufferSize = 3
+
+			for i := 1; i <= 5; i++ {
+				if seq := sequenced(t, m, "u1", "m"+strconv.Itoa(i)); seq != uint64(i) {
+					t.Fatalf("第%d条消息的序号应为%d，实际为%d", i, i, seq)
+				}
+			}
+			if seq := sequenced(t, m, "u2", "m1"); seq != 1 {
+				t.Fatalf("序号应按用户分配，实际为%d", seq)
+			}
+			typing, _ := json.Marshal(model.Message{Type: model.MessageTypeTyping, To: "u1"})
+			if got := m.sequence("u1", typing); string(got) != string(typing) {
+				t.Fatalf("临时消息不应分配序号: %s", got)
+			}
+
+			tests := []struct {
+				after  uint64
+				frames int
+				ok     bool
+			}{
+				{5, 0, true},  // 已是最新
+				{3, 2, true},  // 缓冲中保留了4、5
+				{2, 3, true},  // 缓冲中恰好保留了3、4、5
+				{1, 0, false}, // 2已被挤出缓冲
+				{9, 0, false}, // 客户端的序号比服务端新(序号已过期重置)
+			}
+			for _, c := range tests {
+				frames, latest, ok := m.replayFrames("u1", c.after)
+				if ok != c.ok || len(frames) != c.frames || latest != 5 {
+					t.Fatalf("从%d续传应返回%d条 ok=%v latest=5，实际为%d条 ok=%v latest=%d",
+						c.after, c.frames, c.ok, len(frames), ok, latest)
+				}
+				for i, frame := range frames {
+					var msg model.Message
+					json.Unmarshal(frame, &msg)
+					if msg.Seq != c.after+uint64(i)+1 {
+						t.Fatalf("从%d续传的第%d条消息序号为%d", c.after, i, msg.Seq)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestResume(t *testing.T) {
+	for _, tt := range replayManagers {
+		t.Run(tt.name, func(t *testing.T) {
+			m := tt.setup(t)
+			global.GVA_CONFIG.WebSocket.ResumeBufferSize = 3
+			for i := 1; i <= 4; i++ {
+				sequenced(t, m, "u1", "m"+strconv.Itoa(i))
+			}
+
+			c := newTestClient(m, "u1", "d1")
+			if got := c.resume("2"); got != 4 {
+				t.Fatalf("应续传到序号4，实际为%d", got)
+			}
+			for _, want := range []uint64{3, 4} {
+				var msg model.Message
+				json.Unmarshal(<-c.Send, &msg)
+				if msg.Seq != want {
+					t.Fatalf("重放消息的序号应为%d，实际为%d", want, msg.Seq)
+				}
+			}
+
+			c = newTestClient(m, "u1", "d2")
+			if got := c.resume("0"); got != 0 {
+				t.Fatalf("间隔过大时应通知全量同步，实际续传到%d", got)
+			}
+			var frame struct {
+				Type    string              `json:"type"`
+				Content model.ResyncContent `json:"content"`
+			}
+			json.Unmarshal(<-c.Send, &frame)
+			if frame.Type != model.MessageTypeResync || frame.Content.From != 0 || frame.Content.Latest != 4 {
+				t.Fatalf("全量同步通知不正确: %+v", frame)
+			}
+
+			c = newTestClient(m, "u1", "d3")
+			if got := c.resume("abc"); got != 0 || len(c.Send) != 0 {
+				t.Fatal("无效的resume_from应被忽略")
+			}
+		})
+	}
+}
+
+func TestResumeHoldsLiveFrames(t *testing.T) {
+	for _, tt := range replayManagers {
+		t.Run(tt.name, func(t *testing.T) {
+			m := tt.setup(t)
+			sequenced(t, m, "u1", "m1")
+			sequenced(t, m, "u1", "m2")
+
+			// 与start相同：先注册，再续传，续传期间到达的实时消息暂存
+			c := newTestClient(m, "u1", "d1")
+			c.resuming.Store(true)
+			m.clients.Store(c.ID, c)
+			live := func(id string) {
+				data, _ := json.Marshal(model.Message{ID: id, Type: model.MessageTypeLike, To: "u1"})
+				if err := m.SendToUser("u1", data); err != nil {
+					t.Fatal(err)
+				}
+			}
+			live("m3") // 在读取重放缓冲之前分配序号，同时出现在重放中
+			resumed := c.resume("1")
+			live("m4") // 在读取重放缓冲之后分配序号
+			if len(c.Send) != 2 {
+				t.Fatalf("续传完成前只应推送重放的2条消息，实际为%d条", len(c.Send))
+			}
+			c.releaseLive(resumed)
+
+			for _, want := range []uint64{2, 3, 4} {
+				var msg model.Message
+				json.Unmarshal(<-c.Send, &msg)
+				if msg.Seq != want {
+					t.Fatalf("消息应按序号%d推送，实际为%d", want, msg.Seq)
+				}
+			}
+			if len(c.Send) != 0 {
+				t.Fatalf("不应重复推送已重放的消息，多出%d条", len(c.Send))
+			}
+
+			// 续传结束后实时消息直接推送
+			live("m5")
+			if len(c.Send) != 1 || len(c.held) != 0 {
+				t.Fatal("续传结束后实时消息应直接推送")
+			}
+		})
+	}
+}
@@ -0,0 +1,70 @@
+package websocket
+
+import (
+	"campus2/app/websocket/model"
+	"campus2/pkg/global"
+	"errors"
+	"strconv"
+)
+
+var (
+	errRoomDisabled  = errors.New("未启用数据库，无法使用房间功能")
+	errNotRoomMember = errors.New("不是房间成员")
+)
+
+// SendToRoom 向房间内除发送者外的所有成员推送消息
+func (m *Manager) SendToRoom(senderID, roomID string, message []byte) error {
+	members, err := m.roomMembers(senderID, roomID)
+	if err != nil {
+		return err
+	}
+	m.sendToMembers(senderID, nil, roomID, members, message)
+	return nil
+}
+
+// roomMembers 校验发送者是房间成员并返回房间所有成员
+func (m *Manager) roomMembers(senderID, roomID string) ([]string, error) {
+	if m.roomService == nil {
+		return nil, errRoomDisabled
+	}
+	id, err := strconv.ParseUint(roomID, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	isMember, err := m.roomService.IsMember(uint(id), senderID)
+	if err != nil {
+		return nil, err
+	}
+	if !isMember {
+		global.GVA_LOG.Warnf("用户 %s 不是房间 %s 的成员，拒绝发送", senderID, roomID)
+		return nil, errNotRoomMember
+	}
+	return m.roomService.MemberIDs(uint(id))
+}
+
+// sendRoomError 房间不可用或发送者不是成员时返回错误消息，并释放消息占用的clientMsgId
+func (c *Client) sendRoomError(err error, msg *model.Message) {
+	if errors.Is(err, errNotRoomMember) {
+		c.reject(model.ErrorCodeForbidden, err.Error(), msg)
+		return
+	}
+	c.reject(model.ErrorCodeInvalidPayload, "房间不存在或不可用", msg)
+}
+
+// sendToMembers 向除发送者外的成员逐个推送，origin不为nil时同时同步给发送者除origin外的其他连接。
+// 每个成员都经过SendToUser投递，因此成员在其他节点或离线时同样会被转发或存储为离线消息
+func (m *Manager) sendToMembers(senderID string, origin *Client, roomID string, members []string, message []byte) {
+	global.GVA_LOG.Infof("用户 %s 向房间 %s 的 %d 名成员发送消息", senderID, roomID, len(members)-1)
+	for _, userID := range members {
+		if userID == senderID {
+			continue
+		}
+		if err := m.SendToUser(userID, message); err != nil {
+			global.GVA_LOG.Errorf("向房间 %s 成员 %s 推送消息失败: %v", roomID, userID, err)
+		}
+	}
+	if origin != nil {
+		m.syncToSender(origin, message)
+	}
+}
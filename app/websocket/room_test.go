@@ -0,0 +1,50 @@
+package websocket
+
+import (
+	"campus2/app/websocket/model"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestSendToMembersSyncsSender(t *testing.T) {
+	m := newTestManager(t)
+	origin := newTestClient(m, "u1", "web")
+	phone := newTestClient(m, "u1", "phone")
+	member := newTestClient(m, "u2", "d1")
+	for _, c := range []*Client{origin, phone, member} {
+		m.clients.Store(c.ID, c)
+	}
+
+	data, _ := json.Marshal(model.Message{ID: "m1", Type: model.MessageTypeChat, From: "u1", Content: "hi", CreatedAt: time.Now()})
+	m.sendToMembers("u1", origin, "42", []string{"u1", "u2"}, data)
+
+	if len(origin.Send) != 0 {
+		t.Error("发出消息的连接不应收到自己的消息")
+	}
+	if len(phone.Send) != 1 {
+		t.Fatalf("发送者的其他设备应收到1条消息，实际为%d条", len(phone.Send))
+	}
+	if len(phone.inflight) != 0 {
+		t.Error("同步给发送者其他设备的消息不应等待确认")
+	}
+	if len(member.Send) != 1 || len(member.inflight) != 1 {
+		t.Errorf("房间成员应收到1条等待确认的消息，实际收到%d条、等待确认%d条", len(member.Send), len(member.inflight))
+	}
+}
+
+func TestSendRoomErrorReleasesClientMsgID(t *testing.T) {
+	m := newTestManager(t)
+	c := newTestClient(m, "u1", "d1")
+	msg := &model.Message{Type: model.MessageTypeChat, ClientMsgID: "c1", ID: "m1", Extra: model.MessageExtra{RoomID: "42"}}
+	c.claimClientMsgID(msg)
+
+	c.sendRoomError(errNotRoomMember, msg)
+	expectErrorFrame(t, c, model.ErrorCodeForbidden)
+	if _, dup := c.claimClientMsgID(&model.Message{Type: model.MessageTypeChat, ClientMsgID: "c1", ID: "m2"}); dup {
+		t.Error("房间错误后clientMsgId应被释放，可以重新发送")
+	}
+
+	c.sendRoomError(errRoomDisabled, msg)
+	expectErrorFrame(t, c, model.ErrorCodeInvalidPayload)
+}
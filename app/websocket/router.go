@@ -1,12 +1,15 @@
 package websocket
 
 import (
+	"campus2/pkg/middleware"
+
 	"github.com/gin-gonic/gin"
 )
 
 type WebSocketApp struct {
-	handler *Handler
-	manager *Manager
+	handler      *Handler
+	adminHandler *AdminHandler
+	manager      *Manager
 }
 
 func NewWebSocketApp() *WebSocketApp {
@@ -14,14 +17,30 @@ func NewWebSocketApp() *WebSocketApp {
 	go manager.Start() // 启动WebSocket管理器
 
 	return &WebSocketApp{
-		handler: NewHandler(manager),
-		manager: manager,
+		handler:      NewHandler(manager),
+		adminHandler: NewAdminHandler(manager),
+		manager:      manager,
 	}
 }
 
-func (app *WebSocketApp) InitWebSocketRouter(r *gin.Engine) {
-	ws := r.Group("/ws")
+func (app *WebSocketApp) InitWebSocketRouter(private *gin.RouterGroup, public *gin.RouterGroup) {
+	ws := public.Group("/ws")
 	{
 		ws.GET("", app.handler.HandleWebSocket)
 	}
+
+	// 无法使用WebSocket时的降级传输，与WebSocket连接共用同一个Manager
+	public.GET("/sse", app.handler.HandleSSE)
+	public.GET("/poll", app.handler.HandlePoll)
+	public.POST("/poll", app.handler.HandlePollSend)
+
+	// 管理接口需要JWT中的role属于websocket.adminRoles，每次请求都读取最新配置
+	admin := private.Group("admin/ws", auditDenied(), middleware.RequireRolesFunc(adminRoles))
+	{
+		admin.GET("sessions", app.adminHandler.ListSessions)
+		admin.GET("users/:id", app.adminHandler.InspectUser)
+		admin.DELETE("users/:id/sessions", app.adminHandler.Disconnect)
+		admin.DELETE("users/:id/offline", app.adminHandler.PurgeOffline)
+		admin.POST("system", app.adminHandler.PushSystem)
+	}
 }
@@ -0,0 +1,216 @@
+package websocket
+
+import (
+	"campus2/pkg/global"
+	"campus2/pkg/utils"
+	"context"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// 分组前缀，学校、学院、年级来自JWT，自定义标签来自握手参数tags
+const (
+	SegmentSchool  = "school:"
+	SegmentCollege = "college:"
+	SegmentGrade   = "grade:"
+	SegmentTag     = "tag:"
+)
+
+const (
+	segmentKeyPrefix = "ws:seg:"           // ZSet存储分组的成员 ws:seg:{分组}，score为最后一次连接的Unix时间，用于给离线成员补发
+	segmentTTL       = 30 * 24 * time.Hour // 成员关系在最后一次连接后保留的时间
+	maxSegmentTags   = 20                  // 每个连接最多携带的自定义标签数
+	maxSegmentLength = 64                  // 分组名最大长度
+	offlineCopyBatch = 500                 // 补发离线副本时每批查询在线状态的用户数
+)
+
+// broadcastFrame 通过ws:broadcast频道发布的广播。Segments为空时推送给所有连接，
+// 否则推送给属于任一分组(MatchAll为true时属于所有分组)的连接
+type broadcastFrame struct {
+	Segments []string        `json:"segments,omitempty"`
+	MatchAll bool            `json:"matchAll,omitempty"`
+	Payload  json.RawMessage `json:"payload"`
+}
+
+// matches 连接是否属于广播的目标分组
+func (f *broadcastFrame) matches(c *Client) bool {
+	if len(f.Segments) == 0 {
+		return true
+	}
+	for _, segment := range f.Segments {
+		_, ok := c.segments[segment]
+		if ok && !f.MatchAll {
+			return true
+		}
+		if !ok && f.MatchAll {
+			return false
+		}
+	}
+	return f.MatchAll
+}
+
+// deliverBroadcast 推送给本节点上匹配的连接。与SendToUser一样按接收者判断静音并分配序号，
+// 同一用户的多台设备收到相同的序号
+func (m *Manager) deliverBroadcast(frame *broadcastFrame) {
+	targets := make(map[string][]*Client)
+	m.clients.Range(func(key, value interface{}) bool {
+		client := value.(*Client)
+		if frame.matches(client) {
+			targets[client.UserID] = append(targets[client.UserID], client)
+		}
+		return true
+	})
+	for userID, clients := range targets {
+		if m.muted(userID, frame.Payload) {
+			continue
+		}
+		data := m.sequence(userID, frame.Payload)
+		for _, client := range clients {
+			if client.deliver(data) {
+				global.GVA_LOG.Infof("广播消息已发送给用户: %s", userID)
+			}
+		}
+	}
+}
+
+// connSegments 根据JWT和握手参数tags(逗号分隔)计算连接所属的分组
+func connSegments(claims *utils.CustomClaims, tags string) map[string]struct{} {
+	segments := make(map[string]struct{})
+	add := func(prefix, value string) {
+		value = strings.TrimSpace(value)
+		if value != "" && len(prefix)+len(value) <= maxSegmentLength {
+			segments[prefix+value] = struct{}{}
+		}
+	}
+	add(SegmentSchool, claims.School)
+	add(SegmentCollege, claims.College)
+	add(SegmentGrade, claims.Grade)
+	if tags != "" {
+		for i, tag := range strings.Split(tags, ",") {
+			if i >= maxSegmentTags {
+				break
+			}
+			add(SegmentTag, tag)
+		}
+	}
+	return segments
+}
+
+// validSegment 检查广播指定的分组名
+func validSegment(segment string) bool {
+	if len(segment) > maxSegmentLength {
+		return false
+	}
+	for _, prefix := range []string{SegmentSchool, SegmentCollege, SegmentGrade, SegmentTag} {
+		if strings.HasPrefix(segment, prefix) && len(segment) > len(prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// joinSegments 把用户登记到连接所属的分组，供给离线成员补发消息。
+// 每次登记刷新成员的连接时间并移除超过segmentTTL未连接的成员，整个分组无人连接时随key过期
+func (m *Manager) joinSegments(client *Client) {
+	if len(client.segments) == 0 {
+		return
+	}
+	ctx := context.Background()
+	now := time.Now()
+	stale := strconv.FormatInt(now.Add(-segmentTTL).Unix(), 10)
+	pipe := global.GVA_REDIS.Pipeline()
+	for segment := range client.segments {
+		key := segmentKeyPrefix + segment
+		pipe.ZAdd(ctx, key, redis.Z{Score: float64(now.Unix()), Member: client.UserID})
+		pipe.ZRemRangeByScore(ctx, key, "-inf", "("+stale)
+		pipe.Expire(ctx, key, segmentTTL)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		global.GVA_LOG.Errorf("登记用户 %s 的分组失败: %v", client.UserID, err)
+	}
+}
+
+// publishBroadcast 发布广播，所有节点推送给各自匹配的连接；未启用Redis时只推送给本节点
+func (m *Manager) publishBroadcast(frame *broadcastFrame) {
+	if m.redisStore == nil {
+		m.broadcast <- frame
+		return
+	}
+	data, err := json.Marshal(frame)
+	if err != nil {
+		global.GVA_LOG.Errorf("序列化广播失败: %v", err)
+		return
+	}
+	if err := global.GVA_REDIS.Publish(context.Background(), broadcastChannel, data).Err(); err != nil {
+		global.GVA_LOG.Errorf("发布广播失败: %v", err)
+	}
+}
+
+// storeSegmentOffline 给分组中当前不在线的成员补发一份离线消息，返回补发的人数。
+// message中的to为空，写入离线存储时按成员分别记录；与在线推送一样跳过已静音的成员并分配序号
+func (m *Manager) storeSegmentOffline(segments []string, matchAll bool, message []byte) (int, error) {
+	ctx := context.Background()
+	members, err := segmentMembers(ctx, segments, matchAll)
+	if err != nil {
+		return 0, err
+	}
+
+	stored := 0
+	for start := 0; start < len(members); start += offlineCopyBatch {
+		end := start + offlineCopyBatch
+		if end > len(members) {
+			end = len(members)
+		}
+		batch := members[start:end]
+		online, err := global.GVA_REDIS.HMGet(ctx, connMapKey, batch...).Result()
+		if err != nil {
+			return stored, err
+		}
+		for i, userID := range batch {
+			if online[i] != nil {
+				continue // 在线成员通过广播收到
+			}
+			if m.muted(userID, message) {
+				continue
+			}
+			if err := m.storeOffline(userID, m.sequence(userID, message)); err != nil {
+				global.GVA_LOG.Errorf("向分组成员 %s 补发离线消息失败: %v", userID, err)
+				continue
+			}
+			stored++
+		}
+	}
+	return stored, nil
+}
+
+// segmentMembers 查询segmentTTL内连接过、属于任一分组(matchAll为true时属于所有分组)的用户。
+// 各分组的key位于不同的slot，集群模式下不能使用ZINTER/ZUNION，逐个读取后在本地合并
+func segmentMembers(ctx context.Context, segments []string, matchAll bool) ([]string, error) {
+	since := strconv.FormatInt(time.Now().Add(-segmentTTL).Unix(), 10)
+	counts := make(map[string]int)
+	for _, segment := range segments {
+		members, err := global.GVA_REDIS.ZRangeByScore(ctx, segmentKeyPrefix+segment, &redis.ZRangeBy{
+			Min: since,
+			Max: "+inf",
+		}).Result()
+		if err != nil {
+			return nil, err
+		}
+		for _, userID := range members {
+			counts[userID]++
+		}
+	}
+	members := make([]string, 0, len(counts))
+	for userID, count := range counts {
+		if !matchAll || count == len(segments) {
+			members = append(members, userID)
+		}
+	}
+	sort.Strings(members)
+	return members, nil
+}
@@ -0,0 +1,120 @@
+package websocket
+
+import (
+	"campus2/app/websocket/model"
+	"context"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestSegmentMembers(t *testing.T) {
+	_, mr := newRedisManager(t)
+	now := float64(time.Now().Unix())
+	stale := float64(time.Now().Add(-segmentTTL - time.Hour).Unix())
+	for _, userID := range []string{"u1", "u2", "u3"} {
+		mr.ZAdd(segmentKeyPrefix+"school:a", now, userID)
+	}
+	for _, userID := range []string{"u2", "u3", "u4"} {
+		mr.ZAdd(segmentKeyPrefix+"grade:2023", now, userID)
+	}
+	mr.ZAdd(segmentKeyPrefix+"grade:2023", stale, "u5") // 超过segmentTTL未连接，尚未被清理
+
+	tests := []struct {
+		name     string
+		segments []string
+		matchAll bool
+		want     []string
+	}{
+		{"任一分组", []string{"school:a", "grade:2023"}, false, []string{"u1", "u2", "u3", "u4"}},
+		{"所有分组", []string{"school:a", "grade:2023"}, true, []string{"u2", "u3"}},
+		{"不存在的分组", []string{"school:a", "tag:none"}, true, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := segmentMembers(context.Background(), tt.segments, tt.matchAll)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("分组成员应为%v，实际为%v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestDeliverBroadcastSequencesPerUser(t *testing.T) {
+	m, _ := newRedisManager(t)
+	phone, laptop, other := newTestClient(m, "u1", "phone"), newTestClient(m, "u1", "laptop"), newTestClient(m, "u2", "phone")
+	for _, c := range []*Client{phone, laptop, other} {
+		c.segments = map[string]struct{}{"school:a": {}}
+		m.clients.Store(c.ID, c)
+	}
+	outsider := newTestClient(m, "u3", "phone")
+	m.clients.Store(outsider.ID, outsider)
+
+	msg, err := m.systemMessage("公告")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := json.Marshal(msg)
+	m.deliverBroadcast(&broadcastFrame{Segments: []string{"school:a"}, Payload: data})
+
+	seqs := make(map[string]uint64)
+	for _, c := range []*Client{phone, laptop, other} {
+		var got model.Message
+		if err := json.Unmarshal(<-c.Send, &got); err != nil {
+			t.Fatal(err)
+		}
+		if got.ID != msg.ID || got.Seq == 0 {
+			t.Fatalf("客户端 %s 应收到带序号的消息 %s，实际为%+v", c.ID, msg.ID, got)
+		}
+		seqs[c.ID] = got.Seq
+	}
+	if seqs[phone.ID] != seqs[laptop.ID] {
+		t.Fatalf("同一用户的设备收到的序号应相同，实际为%v", seqs)
+	}
+	if len(outsider.Send) != 0 {
+		t.Fatal("不属于分组的连接不应收到广播")
+	}
+
+	// 另一个节点推送同一条广播时沿用已分配的序号，不会在重放缓冲中重复
+	if again := m.sequence("u1", data); !json.Valid(again) {
+		t.Fatal("分配序号后的消息不是合法的JSON")
+	} else {
+		var got model.Message
+		json.Unmarshal(again, &got)
+		if got.Seq != seqs[phone.ID] {
+			t.Fatalf("应沿用已分配的序号%d，实际为%d", seqs[phone.ID], got.Seq)
+		}
+	}
+	frames, latest, ok := m.replayFrames("u1", 0)
+	if !ok || latest != 1 || len(frames) != 1 {
+		t.Fatalf("重放缓冲中应只有1条消息，实际为%d条 latest=%d ok=%v", len(frames), latest, ok)
+	}
+}
+
+func TestJoinSegmentsTrimsStaleMembers(t *testing.T) {
+	m, mr := newRedisManager(t)
+	key := segmentKeyPrefix + "school:a"
+	mr.ZAdd(key, float64(time.Now().Add(-segmentTTL-time.Hour).Unix()), "stale")
+	mr.ZAdd(key, float64(time.Now().Add(-time.Hour).Unix()), "recent")
+
+	c := newTestClient(m, "u1", "d1")
+	c.segments = map[string]struct{}{"school:a": {}}
+	m.joinSegments(c)
+
+	members, err := mr.ZMembers(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(members)
+	if want := []string{"recent", "u1"}; !reflect.DeepEqual(members, want) {
+		t.Fatalf("登记后分组成员应为%v，实际为%v", want, members)
+	}
+	if ttl := mr.TTL(key); ttl != segmentTTL {
+		t.Fatalf("分组的过期时间应为%v，实际为%v", segmentTTL, ttl)
+	}
+}
@@ -0,0 +1,103 @@
+package websocket
+
+import (
+	"campus2/pkg/global"
+	"context"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/redis/go-redis/v9"
+)
+
+// drainPollInterval 等待连接全部注销时的检查间隔
+const drainPollInterval = 50 * time.Millisecond
+
+// Shutdown 优雅关闭WebSocket服务：停止接受新连接，以1001关闭码断开所有客户端，
+// 等待连接注销以及未确认消息写入离线存储，最后退订频道并停止Kafka已读标记消费者。
+// ctx到期时直接返回，剩余的连接随进程退出断开
+func (app *WebSocketApp) Shutdown(ctx context.Context) error {
+	return app.manager.Shutdown(ctx)
+}
+
+// CloseSessions 以1001关闭码结束所有SSE和长轮询会话，用于HTTP服务关闭时让这些请求尽快返回
+func (app *WebSocketApp) CloseSessions() {
+	app.manager.clients.Range(func(key, value interface{}) bool {
+		if client := value.(*Client); client.session != nil {
+			client.endSession(websocket.CloseGoingAway, "服务器正在重启")
+		}
+		return true
+	})
+}
+
+// Shutdown 见WebSocketApp.Shutdown
+func (m *Manager) Shutdown(ctx context.Context) error {
+	if m.closing.Swap(true) {
+		return nil
+	}
+
+	var clients []*Client
+	m.clients.Range(func(key, value interface{}) bool {
+		clients = append(clients, value.(*Client))
+		return true
+	})
+	global.GVA_LOG.Infof("WebSocket服务开始关闭，断开 %d 个连接", len(clients))
+	for _, client := range clients {
+		client.closeWith(websocket.CloseGoingAway, "服务器正在重启")
+	}
+
+	// 读取协程退出后向Manager注销，注销时登记离线写入
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+	for m.localCount() > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+
+	flushed := make(chan struct{})
+	go func() {
+		m.pending.Wait()
+		close(flushed)
+	}()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-flushed:
+	}
+	global.GVA_LOG.Info("所有连接已注销，未确认消息已转入离线存储")
+
+	if m.redisStore != nil {
+		m.retire()
+	}
+
+	m.pubsubMu.Lock()
+	for _, pubsub := range m.pubsubs {
+		pubsub.Close()
+	}
+	m.pubsubs = nil
+	m.pubsubMu.Unlock()
+
+	if closer, ok := m.kafkaStore.(interface{ Close() }); ok {
+		closer.Close()
+	}
+	return nil
+}
+
+// trackPubSub 记录频道订阅，Shutdown时关闭
+func (m *Manager) trackPubSub(pubsub *redis.PubSub) {
+	m.pubsubMu.Lock()
+	defer m.pubsubMu.Unlock()
+	m.pubsubs = append(m.pubsubs, pubsub)
+}
+
+// localCount 本节点上的连接数
+func (m *Manager) localCount() int {
+	count := 0
+	m.clients.Range(func(key, value interface{}) bool {
+		count++
+		return true
+	})
+	return count
+}
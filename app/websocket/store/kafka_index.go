@@ -0,0 +1,135 @@
+package store
+
+import (
+	"campus2/pkg/global"
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Kafka离线消息索引在Redis中的存储结构:
+//
+//	kafka:offline:idx:{用户ID}     Hash    field=消息ID, value=分区:offset
+const (
+	kafkaIndexKeyPrefix = "kafka:offline:idx:"
+)
+
+// offsetEntry 离线消息在Kafka中的位置
+type offsetEntry struct {
+	MessageID string
+	Partition int32
+	Offset    int64
+}
+
+// offsetIndex 记录用户每条未读离线消息在Kafka中的位置，读取时按位置直接定位，无需扫描整个topic
+type offsetIndex interface {
+	add(userID string, entry offsetEntry) error
+	list(userID string) ([]offsetEntry, error)
+	remove(userID, messageID string) error
+}
+
+// newOffsetIndex 启用Redis时索引保存在Redis中供集群共享，否则保存在本节点内存中
+func newOffsetIndex(expiration time.Duration) offsetIndex {
+	if global.GVA_REDIS != nil {
+		return &redisOffsetIndex{expiration: expiration}
+	}
+	return &memoryOffsetIndex{
+		users: make(map[string]map[string]offsetEntry),
+	}
+}
+
+// redisOffsetIndex 基于Redis的索引
+type redisOffsetIndex struct {
+	expiration time.Duration
+}
+
+func (i *redisOffsetIndex) add(userID string, entry offsetEntry) error {
+	ctx := context.Background()
+	pipe := global.GVA_REDIS.TxPipeline()
+	pipe.HSet(ctx, kafkaIndexKeyPrefix+userID, entry.MessageID, formatPosition(entry.Partition, entry.Offset))
+	pipe.Expire(ctx, kafkaIndexKeyPrefix+userID, i.expiration)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (i *redisOffsetIndex) list(userID string) ([]offsetEntry, error) {
+	positions, err := global.GVA_REDIS.HGetAll(context.Background(), kafkaIndexKeyPrefix+userID).Result()
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]offsetEntry, 0, len(positions))
+	for messageID, position := range positions {
+		partition, offset, err := parsePosition(position)
+		if err != nil {
+			global.GVA_LOG.Warnf("用户 %s 的离线消息 %s 索引格式错误: %v", userID, messageID, err)
+			continue
+		}
+		entries = append(entries, offsetEntry{MessageID: messageID, Partition: partition, Offset: offset})
+	}
+	return entries, nil
+}
+
+func (i *redisOffsetIndex) remove(userID, messageID string) error {
+	return global.GVA_REDIS.HDel(context.Background(), kafkaIndexKeyPrefix+userID, messageID).Err()
+}
+
+// memoryOffsetIndex 本节点内存中的索引，仅适用于单节点部署
+type memoryOffsetIndex struct {
+	mu    sync.Mutex
+	users map[string]map[string]offsetEntry // map[用户ID]map[消息ID]
+}
+
+func (i *memoryOffsetIndex) add(userID string, entry offsetEntry) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	entries, ok := i.users[userID]
+	if !ok {
+		entries = make(map[string]offsetEntry)
+		i.users[userID] = entries
+	}
+	entries[entry.MessageID] = entry
+	return nil
+}
+
+func (i *memoryOffsetIndex) list(userID string) ([]offsetEntry, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	entries := make([]offsetEntry, 0, len(i.users[userID]))
+	for _, entry := range i.users[userID] {
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func (i *memoryOffsetIndex) remove(userID, messageID string) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	delete(i.users[userID], messageID)
+	if len(i.users[userID]) == 0 {
+		delete(i.users, userID)
+	}
+	return nil
+}
+
+func formatPosition(partition int32, offset int64) string {
+	return strconv.FormatInt(int64(partition), 10) + ":" + strconv.FormatInt(offset, 10)
+}
+
+func parsePosition(position string) (int32, int64, error) {
+	p, o, ok := strings.Cut(position, ":")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid position %q", position)
+	}
+	partition, err := strconv.ParseInt(p, 10, 32)
+	if err != nil {
+		return 0, 0, err
+	}
+	offset, err := strconv.ParseInt(o, 10, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	return int32(partition), offset, nil
+}
@@ -7,18 +7,57 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"sort"
+	"sync"
+	"time"
 
 	"github.com/IBM/sarama"
 )
 
+// maxScanGap 同一分区内两条待读取消息的offset相差超过该值时重新定位，而不是顺序扫描中间的消息
+const maxScanGap = 1000
+
+// 离线消息状态变更的类型，写入 {topic}.marks
+const (
+	markTypeRead   = "mark_read"
+	markTypeDelete = "mark_delete"
+)
+
+var _ model.MessageStore = (*KafkaMessageStore)(nil)
+
+// KafkaMessageStore 基于Kafka的离线消息存储。
+// 消息以接收者ID为key写入topic，每条未读消息的分区和offset记录在索引中；
+// 已读和删除通过 {topic}.marks 广播，各节点收到后从索引中移除对应消息
 type KafkaMessageStore struct {
-	topic string
+	topic        string
+	index        offsetIndex
+	fetchTimeout time.Duration // 读取离线消息的最长等待时间
+	stop         chan struct{}
+	stopOnce     sync.Once
+}
+
+// markMessage 离线消息状态变更
+type markMessage struct {
+	Type      string `json:"type"`
+	UserID    string `json:"user_id"`
+	MessageID string `json:"message_id"`
+	Action    string `json:"action"`
 }
 
 func NewKafkaMessageStore(topic string) *KafkaMessageStore {
-	return &KafkaMessageStore{
-		topic: topic,
+	s := &KafkaMessageStore{
+		topic:        topic,
+		index:        newOffsetIndex(global.GVA_CONFIG.Kafka.GetMessageExpiration()),
+		fetchTimeout: global.GVA_CONFIG.Kafka.GetFetchTimeout(),
+		stop:         make(chan struct{}),
 	}
+	go s.consumeMarks()
+	return s
+}
+
+// marksTopic 离线消息状态变更的topic
+func (s *KafkaMessageStore) marksTopic() string {
+	return s.topic + ".marks"
 }
 
 // StoreMessage 存储离线消息
@@ -29,14 +68,20 @@ func (s *KafkaMessageStore) StoreMessage(msg *model.OfflineMessage) error {
 		return err
 	}
 
-	// 使用kafka包提供的SendMessage方法
-	err = kafka.SendMessage(s.topic, msg.To, data)
+	partition, offset, err := kafka.SendMessageWithOffset(s.topic, msg.To, data)
 	if err != nil {
 		global.GVA_LOG.Errorf("存储离线消息到Kafka失败: %v", err)
 		return err
 	}
 
-	global.GVA_LOG.Infof("离线消息已存储到Kafka: topic=%s, userID=%s", s.topic, msg.To)
+	// 同一消息重复存储时索引指向最新写入的位置
+	entry := offsetEntry{MessageID: msg.ID, Partition: partition, Offset: offset}
+	if err := s.index.add(msg.To, entry); err != nil {
+		global.GVA_LOG.Errorf("记录离线消息 %s 的Kafka位置失败: %v", msg.ID, err)
+		return err
+	}
+
+	global.GVA_LOG.Infof("离线消息已存储到Kafka: topic=%s, userID=%s, partition=%d, offset=%d", s.topic, msg.To, partition, offset)
 	return nil
 }
 
@@ -54,98 +99,286 @@ func (s *KafkaMessageStore) SendMessage(topic string, key string, message []byte
 	return nil
 }
 
-// GetOfflineMessages 获取离线消息
+// GetOfflineMessages 根据索引按分区和offset读取用户的未读离线消息，按发送时间排序。
+// 读取时间不超过fetchTimeout，超时后返回已读取到的部分，其余消息保留在索引中下次再读取
 func (s *KafkaMessageStore) GetOfflineMessages(userID string) ([]*model.OfflineMessage, error) {
 	global.GVA_LOG.Infof("开始获取用户 %s 的离线消息", userID)
 
-	// TODO: 实现从Kafka消费消息的逻辑
-	// 1. 创建一个专门的消费者处理器来处理离线消息
-	handler := &OfflineMessageHandler{
-		userID:   userID,
-		messages: make([]*model.OfflineMessage, 0),
+	entries, err := s.index.list(userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return []*model.OfflineMessage{}, nil
 	}
 
-	// 2. 使用消费者组消费消息
-	ctx := context.Background()
-	err := global.GVA_CSMER.Consume(ctx, []string{s.topic}, handler)
+	client, err := kafka.NewKafkaClient(global.GVA_CONFIG.Kafka)
+	if err != nil {
+		return nil, err
+	}
+	consumer, err := sarama.NewConsumerFromClient(client)
 	if err != nil {
-		global.GVA_LOG.Errorf("消费离线消息失败: %v", err)
 		return nil, err
 	}
+	defer consumer.Close()
 
-	return handler.messages, nil
-}
+	// 按分区分组，每个分区并发读取
+	partitions := make(map[int32]map[int64]string)
+	for _, entry := range entries {
+		if partitions[entry.Partition] == nil {
+			partitions[entry.Partition] = make(map[int64]string)
+		}
+		partitions[entry.Partition][entry.Offset] = entry.MessageID
+	}
 
-// OfflineMessageHandler 离线消息处理器
-type OfflineMessageHandler struct {
-	userID   string
-	messages []*model.OfflineMessage
-	ready    chan bool
-}
+	ctx, cancel := context.WithTimeout(context.Background(), s.fetchTimeout)
+	defer cancel()
 
-func (h *OfflineMessageHandler) Setup(_ sarama.ConsumerGroupSession) error {
-	close(h.ready)
-	return nil
+	var (
+		mu       sync.Mutex
+		wg       sync.WaitGroup
+		messages = make([]*model.OfflineMessage, 0, len(entries))
+		expired  []string
+	)
+	for partition, wanted := range partitions {
+		wg.Add(1)
+		go func(partition int32, wanted map[int64]string) {
+			defer wg.Done()
+			found, gone := s.fetchPartition(ctx, client, consumer, userID, partition, wanted)
+			mu.Lock()
+			messages = append(messages, found...)
+			expired = append(expired, gone...)
+			mu.Unlock()
+		}(partition, wanted)
+	}
+	wg.Wait()
+
+	// 已超出Kafka保留期限的消息无法再读取，从索引中移除
+	for _, messageID := range expired {
+		if err := s.index.remove(userID, messageID); err != nil {
+			global.GVA_LOG.Warnf("清理过期离线消息 %s 的索引失败: %v", messageID, err)
+		}
+	}
+
+	sort.Slice(messages, func(i, j int) bool {
+		return messages[i].Timestamp.Before(messages[j].Timestamp)
+	})
+	global.GVA_LOG.Infof("从Kafka获取到用户 %s 的 %d 条离线消息", userID, len(messages))
+	return messages, nil
 }
 
-func (h *OfflineMessageHandler) Cleanup(_ sarama.ConsumerGroupSession) error {
-	return nil
+// fetchPartition 读取一个分区中指定offset的消息，返回读取到的消息和已过期的消息ID
+func (s *KafkaMessageStore) fetchPartition(ctx context.Context, client sarama.Client, consumer sarama.Consumer,
+	userID string, partition int32, wanted map[int64]string) ([]*model.OfflineMessage, []string) {
+	oldest, err := client.GetOffset(s.topic, partition, sarama.OffsetOldest)
+	if err != nil {
+		global.GVA_LOG.Errorf("获取分区 %d 的最早offset失败: %v", partition, err)
+		return nil, nil
+	}
+
+	var expired []string
+	offsets := make([]int64, 0, len(wanted))
+	for offset, messageID := range wanted {
+		if offset < oldest {
+			expired = append(expired, messageID)
+			continue
+		}
+		offsets = append(offsets, offset)
+	}
+	sort.Slice(offsets, func(i, j int) bool { return offsets[i] < offsets[j] })
+
+	var messages []*model.OfflineMessage
+	for start := 0; start < len(offsets); {
+		// 将offset相近的消息合并为一次顺序读取
+		end := start
+		for end+1 < len(offsets) && offsets[end+1]-offsets[end] <= maxScanGap {
+			end++
+		}
+		found, ok := s.fetchRange(ctx, consumer, userID, partition, offsets[start], offsets[end], wanted)
+		messages = append(messages, found...)
+		if !ok {
+			break
+		}
+		start = end + 1
+	}
+	return messages, expired
 }
 
-func (h *OfflineMessageHandler) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
-	for message := range claim.Messages() {
-		// 只处理属于指定用户的消息
-		if string(message.Key) == h.userID {
-			var offlineMsg model.OfflineMessage
-			if err := json.Unmarshal(message.Value, &offlineMsg); err != nil {
-				global.GVA_LOG.Errorf("解析离线消息失败: %v", err)
-				continue
+// fetchRange 顺序读取分区中[from, to]范围内的消息，只保留索引中记录的消息。
+// 超时或出错时返回false
+func (s *KafkaMessageStore) fetchRange(ctx context.Context, consumer sarama.Consumer, userID string,
+	partition int32, from, to int64, wanted map[int64]string) ([]*model.OfflineMessage, bool) {
+	pc, err := consumer.ConsumePartition(s.topic, partition, from)
+	if err != nil {
+		global.GVA_LOG.Errorf("从分区 %d offset %d 读取离线消息失败: %v", partition, from, err)
+		return nil, false
+	}
+	defer pc.Close()
+
+	var messages []*model.OfflineMessage
+	for {
+		select {
+		case msg, ok := <-pc.Messages():
+			if !ok {
+				return messages, false
+			}
+			if messageID, ok := wanted[msg.Offset]; ok && string(msg.Key) == userID {
+				var offlineMsg model.OfflineMessage
+				if err := json.Unmarshal(msg.Value, &offlineMsg); err != nil {
+					global.GVA_LOG.Errorf("解析离线消息失败: %v", err)
+				} else if offlineMsg.ID == messageID {
+					messages = append(messages, &offlineMsg)
+				}
 			}
-			h.messages = append(h.messages, &offlineMsg)
-			session.MarkMessage(message, "")
+			if msg.Offset >= to {
+				return messages, true
+			}
+		case err := <-pc.Errors():
+			global.GVA_LOG.Errorf("从分区 %d 读取离线消息失败: %v", partition, err)
+			return messages, false
+		case <-ctx.Done():
+			global.GVA_LOG.Warnf("读取用户 %s 的离线消息超时，剩余消息下次连接时再读取", userID)
+			return messages, false
 		}
 	}
-	return nil
 }
 
-// MarkMessageAsRead 标记消息为已读
-func (s *KafkaMessageStore) MarkMessageAsRead(messageID string) error {
-	// 发送一个标记消息到Kafka
-	markMsg := struct {
-		Type      string `json:"type"`
-		MessageID string `json:"message_id"`
-		Action    string `json:"action"`
-	}{
-		Type:      "mark_read",
+// MarkMessageAsRead 标记用户的消息为已读
+func (s *KafkaMessageStore) MarkMessageAsRead(userID, messageID string) error {
+	return s.mark(markMessage{
+		Type:      markTypeRead,
+		UserID:    userID,
 		MessageID: messageID,
 		Action:    "read",
+	})
+}
+
+// DeleteMessage 删除用户的消息
+func (s *KafkaMessageStore) DeleteMessage(userID, messageID string) error {
+	return s.mark(markMessage{
+		Type:      markTypeDelete,
+		UserID:    userID,
+		MessageID: messageID,
+		Action:    "delete",
+	})
+}
+
+// PurgeMessages 删除用户的全部未读离线消息，返回删除的条数。
+// Kafka中的消息无法删除，只从索引中移除并通知其他节点，消息随topic的保留策略过期
+func (s *KafkaMessageStore) PurgeMessages(userID string) (int64, error) {
+	entries, err := s.index.list(userID)
+	if err != nil {
+		return 0, err
+	}
+	var purged int64
+	for _, entry := range entries {
+		if err := s.DeleteMessage(userID, entry.MessageID); err != nil {
+			return purged, err
+		}
+		purged++
 	}
+	return purged, nil
+}
 
-	data, err := json.Marshal(markMsg)
+// mark 从本节点索引中移除消息，并发送状态变更到 {topic}.marks 通知其他节点
+func (s *KafkaMessageStore) mark(msg markMessage) error {
+	if err := s.index.remove(msg.UserID, msg.MessageID); err != nil {
+		global.GVA_LOG.Warnf("移除离线消息 %s 的索引失败: %v", msg.MessageID, err)
+	}
+
+	data, err := json.Marshal(msg)
 	if err != nil {
 		return err
 	}
+	return kafka.SendMessage(s.marksTopic(), msg.MessageID, data)
+}
 
-	return kafka.SendMessage(s.topic+".marks", messageID, data)
+// consumeMarks 订阅 {topic}.marks 的所有分区，将其他节点或服务产生的已读/删除同步到索引
+func (s *KafkaMessageStore) consumeMarks() {
+	for {
+		err := s.runMarksConsumer()
+		if err != nil {
+			global.GVA_LOG.Errorf("订阅离线消息状态变更失败: %v", err)
+		}
+		select {
+		case <-s.stop:
+			return
+		case <-time.After(time.Second * 10):
+		}
+	}
 }
 
-// DeleteMessage 删除消息
-func (s *KafkaMessageStore) DeleteMessage(messageID string) error {
-	// 发送一个删除消息到Kafka
-	deleteMsg := struct {
-		Type      string `json:"type"`
-		MessageID string `json:"message_id"`
-		Action    string `json:"action"`
-	}{
-		Type:      "mark_delete",
-		MessageID: messageID,
-		Action:    "delete",
+// runMarksConsumer 从最新位置开始消费 {topic}.marks，直到Close或出错
+func (s *KafkaMessageStore) runMarksConsumer() error {
+	client, err := kafka.NewKafkaClient(global.GVA_CONFIG.Kafka)
+	if err != nil {
+		return err
+	}
+	consumer, err := sarama.NewConsumerFromClient(client)
+	if err != nil {
+		return err
 	}
+	defer consumer.Close()
 
-	data, err := json.Marshal(deleteMsg)
+	partitions, err := consumer.Partitions(s.marksTopic())
 	if err != nil {
 		return err
 	}
 
-	return kafka.SendMessage(s.topic+".marks", messageID, data)
+	errs := make(chan error, len(partitions))
+	for _, partition := range partitions {
+		pc, err := consumer.ConsumePartition(s.marksTopic(), partition, sarama.OffsetNewest)
+		if err != nil {
+			return err
+		}
+		defer pc.Close()
+		go func(pc sarama.PartitionConsumer) {
+			for {
+				select {
+				case msg, ok := <-pc.Messages():
+					if !ok {
+						errs <- fmt.Errorf("partition consumer closed")
+						return
+					}
+					s.applyMark(msg.Value)
+				case err := <-pc.Errors():
+					errs <- err
+					return
+				case <-s.stop:
+					return
+				}
+			}
+		}(pc)
+	}
+	global.GVA_LOG.Infof("开始订阅离线消息状态变更: topic=%s", s.marksTopic())
+
+	select {
+	case err := <-errs:
+		return err
+	case <-s.stop:
+		return nil
+	}
+}
+
+// applyMark 处理一条状态变更，已读和删除的消息都不再作为离线消息推送
+func (s *KafkaMessageStore) applyMark(data []byte) {
+	var msg markMessage
+	if err := json.Unmarshal(data, &msg); err != nil {
+		global.GVA_LOG.Errorf("解析离线消息状态变更失败: %v", err)
+		return
+	}
+	switch msg.Type {
+	case markTypeRead, markTypeDelete:
+		if msg.UserID == "" {
+			return // 不带接收者的旧格式无法定位索引，等待消息自然过期
+		}
+		if err := s.index.remove(msg.UserID, msg.MessageID); err != nil {
+			global.GVA_LOG.Warnf("移除离线消息 %s 的索引失败: %v", msg.MessageID, err)
+		}
+	}
+}
+
+// Close 停止订阅状态变更
+func (s *KafkaMessageStore) Close() {
+	s.stopOnce.Do(func() { close(s.stop) })
 }
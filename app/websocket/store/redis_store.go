@@ -6,9 +6,26 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"strconv"
 	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Redis中离线消息的存储结构:
+//
+//	offline:item:{用户ID}:{消息ID}  Hash  data=消息JSON, status=状态(0未读/1已读)
+//	                                 群发消息给每个接收者各存一份，已读状态互不影响
+//	offline:idx:{用户ID}      ZSet  用户的全部离线消息ID，score为发送时间(毫秒)
+//	offline:unread:{用户ID}   ZSet  用户的未读离线消息ID，score为发送时间(毫秒)
+const (
+	offlineItemKeyPrefix   = "offline:item:"
+	offlineIndexKeyPrefix  = "offline:idx:"
+	offlineUnreadKeyPrefix = "offline:unread:"
 )
 
+var _ model.MessageStore = (*RedisMessageStore)(nil)
+
 type RedisMessageStore struct {
 	expiration time.Duration // 消息过期时间
 }
@@ -19,9 +36,21 @@ func NewRedisMessageStore(expiration time.Duration) *RedisMessageStore {
 	}
 }
 
+func itemKey(userID, messageID string) string {
+	return offlineItemKeyPrefix + userID + ":" + messageID
+}
+
+func indexKey(userID string) string {
+	return offlineIndexKeyPrefix + userID
+}
+
+func unreadKey(userID string) string {
+	return offlineUnreadKeyPrefix + userID
+}
+
+// StoreMessage 存储离线消息，相同ID的消息重复存储时覆盖旧数据
 func (s *RedisMessageStore) StoreMessage(msg *model.OfflineMessage) error {
 	ctx := context.Background()
-	key := fmt.Sprintf("offline:msg:%s", msg.To)
 
 	// 序列化消息
 	data, err := json.Marshal(msg)
@@ -29,37 +58,172 @@ func (s *RedisMessageStore) StoreMessage(msg *model.OfflineMessage) error {
 		return err
 	}
 
-	// 使用Redis List存储消息
-	err = global.GVA_REDIS.LPush(ctx, key, data).Err()
+	score := float64(msg.Timestamp.UnixMilli())
+	pipe := global.GVA_REDIS.TxPipeline()
+	pipe.HSet(ctx, itemKey(msg.To, msg.ID), "data", data, "status", msg.Status)
+	pipe.Expire(ctx, itemKey(msg.To, msg.ID), s.expiration)
+	pipe.ZAdd(ctx, indexKey(msg.To), redis.Z{Score: score, Member: msg.ID})
+	pipe.Expire(ctx, indexKey(msg.To), s.expiration)
+	if msg.Status == 0 {
+		pipe.ZAdd(ctx, unreadKey(msg.To), redis.Z{Score: score, Member: msg.ID})
+		pipe.Expire(ctx, unreadKey(msg.To), s.expiration)
+	}
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+// GetOfflineMessages 按发送时间顺序获取用户的未读离线消息。
+// 消息不会在获取后删除，客户端确认后通过MarkMessageAsRead标记为已读
+func (s *RedisMessageStore) GetOfflineMessages(userID string) ([]*model.OfflineMessage, error) {
+	ctx := context.Background()
+
+	ids, err := global.GVA_REDIS.ZRange(ctx, unreadKey(userID), 0, -1).Result()
+	if err != nil {
+		return nil, err
+	}
+	return s.loadMessages(ctx, userID, ids)
+}
+
+// GetMessages 按发送时间顺序分页获取用户的全部离线消息(包括已读)
+func (s *RedisMessageStore) GetMessages(userID string, offset, limit int64) ([]*model.OfflineMessage, error) {
+	ctx := context.Background()
+
+	ids, err := global.GVA_REDIS.ZRange(ctx, indexKey(userID), offset, offset+limit-1).Result()
+	if err != nil {
+		return nil, err
+	}
+	return s.loadMessages(ctx, userID, ids)
+}
+
+// GetMessage 根据ID获取用户的单条离线消息，消息不存在时返回nil
+func (s *RedisMessageStore) GetMessage(userID, messageID string) (*model.OfflineMessage, error) {
+	ctx := context.Background()
+
+	fields, err := global.GVA_REDIS.HMGet(ctx, itemKey(userID, messageID), "data", "status").Result()
+	if err != nil {
+		return nil, err
+	}
+	return decodeItem(fields)
+}
+
+// MarkMessageAsRead 标记用户的离线消息为已读
+func (s *RedisMessageStore) MarkMessageAsRead(userID, messageID string) error {
+	ctx := context.Background()
+
+	exists, err := global.GVA_REDIS.Exists(ctx, itemKey(userID, messageID)).Result()
 	if err != nil {
 		return err
 	}
+	pipe := global.GVA_REDIS.TxPipeline()
+	if exists > 0 { // 消息已过期或不是离线消息时不再写入状态
+		pipe.HSet(ctx, itemKey(userID, messageID), "status", 1)
+	}
+	pipe.ZRem(ctx, unreadKey(userID), messageID)
+	_, err = pipe.Exec(ctx)
+	return err
+}
 
-	// 设置过期时间
-	return global.GVA_REDIS.Expire(ctx, key, s.expiration).Err()
+// DeleteMessage 删除用户的离线消息
+func (s *RedisMessageStore) DeleteMessage(userID, messageID string) error {
+	ctx := context.Background()
+
+	pipe := global.GVA_REDIS.TxPipeline()
+	pipe.Del(ctx, itemKey(userID, messageID))
+	pipe.ZRem(ctx, indexKey(userID), messageID)
+	pipe.ZRem(ctx, unreadKey(userID), messageID)
+	_, err := pipe.Exec(ctx)
+	return err
 }
 
-func (s *RedisMessageStore) GetOfflineMessages(userID string) ([]*model.OfflineMessage, error) {
+// PurgeMessages 删除用户的全部离线消息，返回删除的条数
+func (s *RedisMessageStore) PurgeMessages(userID string) (int64, error) {
 	ctx := context.Background()
-	key := fmt.Sprintf("offline:msg:%s", userID)
 
-	// 获取所有消息
-	data, err := global.GVA_REDIS.LRange(ctx, key, 0, -1).Result()
+	ids, err := global.GVA_REDIS.ZRange(ctx, indexKey(userID), 0, -1).Result()
 	if err != nil {
+		return 0, err
+	}
+
+	pipe := global.GVA_REDIS.TxPipeline()
+	for _, id := range ids {
+		pipe.Del(ctx, itemKey(userID, id))
+	}
+	pipe.Del(ctx, indexKey(userID), unreadKey(userID))
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+	return int64(len(ids)), nil
+}
+
+// CountMessages 统计用户的离线消息总数和未读数
+func (s *RedisMessageStore) CountMessages(userID string) (total int64, unread int64, err error) {
+	ctx := context.Background()
+
+	pipe := global.GVA_REDIS.Pipeline()
+	totalCmd := pipe.ZCard(ctx, indexKey(userID))
+	unreadCmd := pipe.ZCard(ctx, unreadKey(userID))
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, 0, err
+	}
+	return totalCmd.Val(), unreadCmd.Val(), nil
+}
+
+// loadMessages 批量读取消息内容，顺带清理索引中已过期的消息ID
+func (s *RedisMessageStore) loadMessages(ctx context.Context, userID string, ids []string) ([]*model.OfflineMessage, error) {
+	if len(ids) == 0 {
+		return []*model.OfflineMessage{}, nil
+	}
+
+	pipe := global.GVA_REDIS.Pipeline()
+	cmds := make([]*redis.SliceCmd, len(ids))
+	for i, id := range ids {
+		cmds[i] = pipe.HMGet(ctx, itemKey(userID, id), "data", "status")
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
 		return nil, err
 	}
 
-	messages := make([]*model.OfflineMessage, 0, len(data))
-	for _, item := range data {
-		var msg model.OfflineMessage
-		if err := json.Unmarshal([]byte(item), &msg); err != nil {
+	messages := make([]*model.OfflineMessage, 0, len(ids))
+	var expired []interface{}
+	for i, cmd := range cmds {
+		msg, err := decodeItem(cmd.Val())
+		if err != nil {
+			global.GVA_LOG.Errorf("解析离线消息 %s 失败: %v", ids[i], err)
 			continue
 		}
-		messages = append(messages, &msg)
+		if msg == nil {
+			expired = append(expired, ids[i])
+			continue
+		}
+		messages = append(messages, msg)
 	}
 
-	// 获取后删除消息
-	global.GVA_REDIS.Del(ctx, key)
-
+	if len(expired) > 0 {
+		pipe := global.GVA_REDIS.Pipeline()
+		pipe.ZRem(ctx, indexKey(userID), expired...)
+		pipe.ZRem(ctx, unreadKey(userID), expired...)
+		if _, err := pipe.Exec(ctx); err != nil {
+			global.GVA_LOG.Warnf("清理用户 %s 已过期的离线消息索引失败: %v", userID, err)
+		}
+	}
 	return messages, nil
 }
+
+// decodeItem 解析HMGET data/status的结果，消息不存在时返回nil
+func decodeItem(fields []interface{}) (*model.OfflineMessage, error) {
+	if len(fields) != 2 || fields[0] == nil {
+		return nil, nil
+	}
+	data, ok := fields[0].(string)
+	if !ok {
+		return nil, fmt.Errorf("离线消息数据类型错误: %T", fields[0])
+	}
+	var msg model.OfflineMessage
+	if err := json.Unmarshal([]byte(data), &msg); err != nil {
+		return nil, err
+	}
+	if status, ok := fields[1].(string); ok {
+		msg.Status, _ = strconv.Atoi(status)
+	}
+	return &msg, nil
+}
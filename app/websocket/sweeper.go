@@ -0,0 +1,197 @@
+package websocket
+
+import (
+	"campus2/pkg/global"
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	nodesKey           = "ws:nodes"       // Set存储所有登记过的节点
+	nodeAliveKeyPrefix = "ws:node:alive:" // 节点存活标记 ws:node:alive:{serverID}，节点停止续期后过期
+	sweepLockKey       = "ws:sweeper:lock"
+
+	nodeAliveTTL     = 30 * time.Second // 存活标记的有效期，节点崩溃后最多这么久被判定为宕机
+	nodeBeatInterval = 10 * time.Second // 续期存活标记的间隔
+	sweepInterval    = 30 * time.Second // 清理宕机节点残留连接信息的间隔
+	sweepLockTTL     = time.Minute      // 清理锁的有效期，持有锁的节点崩溃后由其他节点接手
+)
+
+// sweepDeviceScript 删除用户在宕机节点上的设备记录。
+// KEYS[1]为设备Hash，ARGV[1]为宕机节点。返回{剩余设备数, 被删除记录中最近的心跳时间, 剩余设备之一的连接信息}
+var sweepDeviceScript = redis.NewScript(`
+local lastPing = 0
+local remaining = ''
+local devices = redis.call('HGETALL', KEYS[1])
+for i = 1, #devices, 2 do
+	local info = cjson.decode(devices[i + 1])
+	if info.server_id == ARGV[1] then
+		redis.call('HDEL', KEYS[1], devices[i])
+		lastPing = math.max(lastPing, tonumber(info.last_ping) or 0)
+	elseif remaining == '' then
+		remaining = devices[i + 1]
+	end
+end
+return {redis.call('HLEN', KEYS[1]), lastPing, remaining}
+`)
+
+// sweepConnMapScript ws:conn:map中用户的记录仍指向宕机节点时改为剩余设备或删除，
+// 期间用户已在其他节点重新连接时保留新记录。设备Hash与ws:conn:map位于不同的slot，因此与sweepDeviceScript分开执行。
+// KEYS[1]为ws:conn:map，ARGV[1]为用户ID，ARGV[2]为宕机节点，ARGV[3]为剩余设备的连接信息(为空时删除)
+var sweepConnMapScript = redis.NewScript(`
+local cur = redis.call('HGET', KEYS[1], ARGV[1])
+if not cur or cjson.decode(cur).server_id ~= ARGV[2] then
+	return 0
+end
+if ARGV[3] ~= '' then
+	redis.call('HSET', KEYS[1], ARGV[1], ARGV[3])
+else
+	redis.call('HDEL', KEYS[1], ARGV[1])
+end
+return 1
+`)
+
+// releaseLockScript 只释放自己持有的锁
+var releaseLockScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// serverConnKey Set存储节点上有连接的用户 ws:server:conns:{serverID}，节点宕机后据此清理
+func serverConnKey(serverID string) string {
+	return serverConnKeyPrefix + serverID
+}
+
+// nodeAliveKey 获取节点存活标记的key
+func nodeAliveKey(serverID string) string {
+	return nodeAliveKeyPrefix + serverID
+}
+
+// sweepOwnLeftovers 节点崩溃后以相同的ServerID重启时，上次运行留下的连接信息不会因存活标记过期而被清理，
+// 启动时先自行清理
+func (m *Manager) sweepOwnLeftovers() {
+	if err := m.sweepNode(context.Background(), m.serverID); err != nil {
+		global.GVA_LOG.Errorf("清理节点 %s 上次运行残留的连接信息失败: %v", m.serverID, err)
+	}
+}
+
+// keepAlive 定期登记本节点并续期存活标记，同时清理已宕机节点的残留连接信息
+func (m *Manager) keepAlive() {
+	ctx := context.Background()
+	m.beat(ctx)
+
+	beat := time.NewTicker(nodeBeatInterval)
+	defer beat.Stop()
+	sweep := time.NewTicker(sweepInterval)
+	defer sweep.Stop()
+	for {
+		select {
+		case <-beat.C:
+			if m.closing.Load() {
+				return
+			}
+			m.beat(ctx)
+		case <-sweep.C:
+			if m.closing.Load() {
+				return
+			}
+			m.sweepDeadNodes(ctx)
+		}
+	}
+}
+
+// beat 续期本节点的存活标记，并重新登记到节点列表。
+// 节点暂停(如GC或网络中断)超过存活标记有效期时会被其他节点清理并移出列表，恢复后需要重新登记才能再被清理
+func (m *Manager) beat(ctx context.Context) {
+	pipe := global.GVA_REDIS.Pipeline()
+	pipe.SAdd(ctx, nodesKey, m.serverID)
+	pipe.Set(ctx, nodeAliveKey(m.serverID), time.Now().Unix(), nodeAliveTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		global.GVA_LOG.Errorf("续期节点 %s 的存活标记失败: %v", m.serverID, err)
+	}
+}
+
+// retire 正常下线时注销本节点，连接信息已在连接注销时移除
+func (m *Manager) retire() {
+	ctx := context.Background()
+	pipe := global.GVA_REDIS.Pipeline()
+	pipe.Del(ctx, nodeAliveKey(m.serverID), serverConnKey(m.serverID))
+	pipe.SRem(ctx, nodesKey, m.serverID)
+	if _, err := pipe.Exec(ctx); err != nil {
+		global.GVA_LOG.Errorf("注销节点 %s 失败: %v", m.serverID, err)
+	}
+}
+
+// sweepDeadNodes 找出存活标记已过期的节点，移除其上的连接信息，并将受影响的用户标记为离线。
+// 多个节点同时运行时通过分布式锁保证只有一个节点在清理
+func (m *Manager) sweepDeadNodes(ctx context.Context) {
+	locked, err := global.GVA_REDIS.SetNX(ctx, sweepLockKey, m.serverID, sweepLockTTL).Result()
+	if err != nil {
+		global.GVA_LOG.Errorf("获取清理锁失败: %v", err)
+		return
+	}
+	if !locked {
+		return
+	}
+	defer releaseLockScript.Run(ctx, global.GVA_REDIS, []string{sweepLockKey}, m.serverID)
+
+	nodes, err := global.GVA_REDIS.SMembers(ctx, nodesKey).Result()
+	if err != nil {
+		global.GVA_LOG.Errorf("查询节点列表失败: %v", err)
+		return
+	}
+	for _, serverID := range nodes {
+		if serverID == m.serverID {
+			continue
+		}
+		alive, err := global.GVA_REDIS.Exists(ctx, nodeAliveKey(serverID)).Result()
+		if err != nil {
+			global.GVA_LOG.Errorf("查询节点 %s 的存活标记失败: %v", serverID, err)
+			continue
+		}
+		if alive > 0 {
+			continue
+		}
+		if err := m.sweepNode(ctx, serverID); err != nil {
+			global.GVA_LOG.Errorf("清理宕机节点 %s 的连接信息失败: %v", serverID, err)
+		}
+	}
+}
+
+// sweepNode 移除宕机节点上所有用户的连接信息，用户没有其他设备在线时记录最后在线时间并通知订阅者
+func (m *Manager) sweepNode(ctx context.Context, serverID string) error {
+	users, err := global.GVA_REDIS.SMembers(ctx, serverConnKey(serverID)).Result()
+	if err != nil {
+		return err
+	}
+	global.GVA_LOG.Warnf("节点 %s 已宕机，清理其上 %d 个用户的连接信息", serverID, len(users))
+
+	for _, userID := range users {
+		result, err := sweepDeviceScript.Run(ctx, global.GVA_REDIS, []string{connDevicesKey(userID)}, serverID).Slice()
+		if err != nil || len(result) != 3 {
+			return fmt.Errorf("清理用户 %s 的设备记录失败: %v", userID, err)
+		}
+		remainingDevices, _ := result[0].(int64)
+		lastPing, _ := result[1].(int64)
+		remaining, _ := result[2].(string)
+		if err := sweepConnMapScript.Run(ctx, global.GVA_REDIS, []string{connMapKey}, userID, serverID, remaining).Err(); err != nil {
+			return fmt.Errorf("清理用户 %s 的连接信息失败: %v", userID, err)
+		}
+		if remainingDevices == 0 && lastPing > 0 {
+			global.GVA_REDIS.HSet(ctx, lastSeenKey, userID, lastPing)
+		}
+		global.GVA_REDIS.SRem(ctx, serverConnKey(serverID), userID)
+		m.refreshPresence(userID)
+	}
+
+	pipe := global.GVA_REDIS.Pipeline()
+	pipe.Del(ctx, serverConnKey(serverID))
+	pipe.SRem(ctx, nodesKey, serverID)
+	_, err = pipe.Exec(ctx)
+	return err
+}
@@ -0,0 +1,85 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"testing"
+)
+
+// connInfoJSON 生成设备在指定节点上的连接信息
+func connInfoJSON(t *testing.T, userID, deviceID, serverID string, lastPing int64) string {
+	t.Helper()
+	data, err := json.Marshal(ConnInfo{UserID: userID, DeviceID: deviceID, ConnID: userID + ":" + deviceID, ServerID: serverID, LastPing: lastPing})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestSweepDeadNodes(t *testing.T) {
+	m, mr := newRedisManager(t)
+	ctx := context.Background()
+
+	// u1在宕机的node-b和存活的node-a上各有一台设备，u2只在node-b上，u3已在node-c上重新连接
+	mr.HSet(connDevicesKey("u1"), "phone", connInfoJSON(t, "u1", "phone", "node-b", 100))
+	laptop := connInfoJSON(t, "u1", "laptop", "node-a", 200)
+	mr.HSet(connDevicesKey("u1"), "laptop", laptop)
+	mr.HSet(connDevicesKey("u2"), "phone", connInfoJSON(t, "u2", "phone", "node-b", 300))
+	reconnected := connInfoJSON(t, "u3", "phone", "node-c", 400)
+	mr.HSet(connDevicesKey("u3"), "phone", reconnected)
+	mr.HSet(connMapKey, "u1", connInfoJSON(t, "u1", "phone", "node-b", 100))
+	mr.HSet(connMapKey, "u2", connInfoJSON(t, "u2", "phone", "node-b", 300))
+	mr.HSet(connMapKey, "u3", reconnected)
+	mr.SAdd(serverConnKey("node-b"), "u1", "u2", "u3")
+	mr.SAdd(nodesKey, "node-a", "node-b")
+	m.beat(ctx)
+
+	m.sweepDeadNodes(ctx)
+
+	if got, _ := mr.HKeys(connDevicesKey("u1")); len(got) != 1 || got[0] != "laptop" {
+		t.Fatalf("u1的设备应只剩[laptop]，实际为%v", got)
+	}
+	if got := mr.HGet(connMapKey, "u1"); got != laptop {
+		t.Fatalf("u1的连接映射应指向剩余的设备，实际为%s", got)
+	}
+	if mr.Exists(connDevicesKey("u2")) || mr.HGet(connMapKey, "u2") != "" {
+		t.Fatal("u2不应再有连接信息")
+	}
+	if got := mr.HGet(lastSeenKey, "u2"); got != strconv.Itoa(300) {
+		t.Fatalf("u2的最后在线时间应为300，实际为%q", got)
+	}
+	if got := mr.HGet(connMapKey, "u3"); got != reconnected {
+		t.Fatalf("u3的连接映射应保留新连接，实际为%s", got)
+	}
+	if mr.Exists(serverConnKey("node-b")) {
+		t.Fatal("宕机节点的连接集合应被删除")
+	}
+	if ok, _ := mr.SIsMember(nodesKey, "node-b"); ok {
+		t.Fatal("宕机节点应从节点列表中移除")
+	}
+	if ok, _ := mr.SIsMember(nodesKey, "node-a"); !ok {
+		t.Fatal("存活节点应保留在节点列表中")
+	}
+	if mr.Exists(sweepLockKey) {
+		t.Fatal("清理锁应被释放")
+	}
+}
+
+func TestBeatReRegistersNode(t *testing.T) {
+	m, mr := newRedisManager(t)
+	ctx := context.Background()
+	m.beat(ctx)
+
+	// 暂停期间被其他节点判定为宕机并移出列表
+	mr.SRem(nodesKey, m.serverID)
+	mr.Del(nodeAliveKey(m.serverID))
+
+	m.beat(ctx)
+	if ok, _ := mr.SIsMember(nodesKey, m.serverID); !ok {
+		t.Fatal("心跳应重新登记节点")
+	}
+	if !mr.Exists(nodeAliveKey(m.serverID)) || mr.TTL(nodeAliveKey(m.serverID)) != nodeAliveTTL {
+		t.Fatal("心跳应续期存活标记")
+	}
+}
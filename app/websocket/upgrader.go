@@ -0,0 +1,89 @@
+package websocket
+
+import (
+	"campus2/pkg/global"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gorilla/websocket"
+)
+
+// 连接参数的默认值，配置未设置时使用
+const (
+	defaultReadBufferSize       = 4096
+	defaultWriteBufferSize      = 4096
+	defaultMaxMessageSize       = 64 * 1024 // 单条上行消息的最大字节数
+	defaultCompressionThreshold = 1024      // 超过该字节数的消息才压缩
+)
+
+// newUpgrader 按当前配置创建协议升级器。每次握手时读取配置，修改配置文件后新连接立即生效
+func newUpgrader() *websocket.Upgrader {
+	cfg := global.WebSocketConfig()
+	return &websocket.Upgrader{
+		ReadBufferSize:    positiveOr(cfg.ReadBufferSize, defaultReadBufferSize),
+		WriteBufferSize:   positiveOr(cfg.WriteBufferSize, defaultWriteBufferSize),
+		EnableCompression: cfg.Compression.Enabled,
+		CheckOrigin:       checkOrigin,
+	}
+}
+
+// checkOrigin 按websocket.allowedOrigins校验来源，未配置时允许所有来源。
+// 没有Origin头的请求(原生客户端)不受限制，支持*.example.com匹配子域名
+func checkOrigin(r *http.Request) bool {
+	allowed := global.WebSocketConfig().AllowedOrigins
+	origin := r.Header.Get("Origin")
+	if len(allowed) == 0 || origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	host := strings.ToLower(u.Hostname())
+	for _, pattern := range allowed {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		switch {
+		case pattern == "*":
+			return true
+		case strings.EqualFold(pattern, origin):
+			return true
+		case strings.HasPrefix(pattern, "*."):
+			if strings.HasSuffix(host, pattern[1:]) {
+				return true
+			}
+		case pattern == host:
+			return true
+		}
+	}
+	global.GVA_LOG.Warnf("拒绝来源 %s 的WebSocket连接", origin)
+	return false
+}
+
+// maxMessageSize 单条上行消息的最大字节数，超过时连接以1009关闭
+func maxMessageSize() int64 {
+	return int64(positiveOr(global.WebSocketConfig().MaxMessageSize, defaultMaxMessageSize))
+}
+
+// applyWriteCompression 按当前配置决定本条消息是否压缩，只对握手时协商了permessage-deflate的连接生效
+func (c *Client) applyWriteCompression(size int) {
+	cfg := global.WebSocketConfig().Compression
+	if !cfg.Enabled {
+		c.Socket.EnableWriteCompression(false)
+		return
+	}
+	if cfg.Level != 0 {
+		if err := c.Socket.SetCompressionLevel(cfg.Level); err != nil {
+			global.GVA_LOG.Warnf("无效的压缩级别 %d: %v", cfg.Level, err)
+		}
+	}
+	c.Socket.EnableWriteCompression(size >= positiveOr(cfg.Threshold, defaultCompressionThreshold))
+}
+
+// positiveOr 配置值不大于0时返回默认值
+func positiveOr(value, fallback int) int {
+	if value > 0 {
+		return value
+	}
+	return fallback
+}
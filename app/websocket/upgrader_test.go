@@ -0,0 +1,42 @@
+package websocket
+
+import (
+	"campus2/pkg/global"
+	"net/http"
+	"testing"
+)
+
+func TestCheckOrigin(t *testing.T) {
+	tests := []struct {
+		name    string
+		allowed []string
+		origin  string
+		want    bool
+	}{
+		{"未配置时允许", nil, "https://evil.com", true},
+		{"原生客户端没有Origin", []string{"https://campus.example.com"}, "", true},
+		{"完整来源", []string{"https://campus.example.com"}, "https://campus.example.com", true},
+		{"来源忽略大小写", []string{"https://Campus.Example.com"}, "https://campus.example.com", true},
+		{"只配置主机名", []string{"campus.example.com"}, "http://campus.example.com:8080", true},
+		{"协议不同", []string{"https://campus.example.com"}, "http://campus.example.com", false},
+		{"通配子域名", []string{"*.example.com"}, "https://m.campus.example.com", true},
+		{"通配不匹配根域名", []string{"*.example.com"}, "https://example.com", false},
+		{"通配不匹配相似域名", []string{"*.example.com"}, "https://evilexample.com", false},
+		{"允许所有", []string{"*"}, "https://any.com", true},
+		{"不在列表中", []string{"https://campus.example.com", "*.campus.cn"}, "https://evil.com", false},
+		{"无法解析的来源", []string{"campus.example.com"}, "null", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newTestManager(t)
+			global.GVA_CONFIG.WebSocket.AllowedOrigins = tt.allowed
+			r, _ := http.NewRequest(http.MethodGet, "/ws", nil)
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+			if got := checkOrigin(r); got != tt.want {
+				t.Fatalf("允许%v时来源%q的校验结果应为%v，实际为%v", tt.allowed, tt.origin, tt.want, got)
+			}
+		})
+	}
+}
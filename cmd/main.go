@@ -1,10 +1,9 @@
 package main
 
 import (
-	"campus2/init"
+	initialize "campus2/init"
 	"campus2/pkg"
 	"campus2/pkg/global"
-	"fmt"
 	"os"
 )
 
@@ -12,15 +11,15 @@ func main() {
 	// 加载配置
 	global.GVA_DB = pkg.GetDB(global.GVA_CONFIG.Mysql)
 	if global.GVA_DB != nil {
-		// 程序结束前关闭数据库链接
-		db, _ := global.GVA_DB.DB()
-		defer db.Close()
-
-		if err := init.RegisterTables(); err != nil {
+		if err := initialize.RegisterTables(); err != nil {
 			global.GVA_LOG.Error(err)
 			os.Exit(0)
 		}
 	}
-	routers := init.Routers()
-	fmt.Println(routers)
+
+	// 数据库等资源在服务关闭时按顺序释放
+	if err := initialize.RunServer(); err != nil {
+		global.GVA_LOG.Error(err)
+		os.Exit(1)
+	}
 }
@@ -9,6 +9,11 @@ import (
 	"fmt"
 )
 
+var (
+	stopConsumer context.CancelFunc // 停止Kafka消费者组
+	consumerDone chan struct{}      // Kafka消费者组退出时关闭
+)
+
 func init() {
 	global.GVA_VIPER = pkg.NewViper()
 	fmt.Println("Viper 初始化完成 现在可以使用global.GVA_CONFIG来访问配置文件的内容了")
@@ -31,13 +36,18 @@ func init() {
 
 		if consumer, err := kafka.NewKafkaConsumer(global.GVA_CONFIG.Kafka); err != nil {
 			global.GVA_LOG.Fatalf("Failed to create Kafka consumer: %v", err)
+		} else {
 			global.GVA_CSMER = consumer
 		}
 
-		// 启动Kafka消费者组
+		// 启动Kafka消费者组，关闭服务时通过stopConsumer停止
+		ctx, cancel := context.WithCancel(context.Background())
+		stopConsumer = cancel
+		consumerDone = make(chan struct{})
 		go func() {
+			defer close(consumerDone)
 			topics := []string{global.GVA_CONFIG.Kafka.Topic}
-			if err := kafka.StartConsumerGroup(context.Background(), global.GVA_CONFIG.Kafka, topics); err != nil {
+			if err := kafka.StartConsumerGroup(ctx, global.GVA_CONFIG.Kafka, topics); err != nil {
 				global.GVA_LOG.Errorf("Kafka consumer error: %v", err)
 			}
 		}()
@@ -1,15 +1,31 @@
 package init
 
 import (
+	chat "campus2/app/chat/model"
+	room "campus2/app/room/model"
 	"campus2/pkg/global"
 	"fmt"
 )
 
 func RegisterTables() error {
 	db := global.GVA_DB
-	err := db.AutoMigrate()
+	err := db.AutoMigrate(
+		&room.RoomModel{},
+		&room.RoomMemberModel{},
+		&chat.ConversationModel{},
+		&chat.ConversationMemberModel{},
+		&chat.ChatMessageModel{},
+		&chat.ConversationReadModel{},
+	)
 	if err != nil {
 		return fmt.Errorf("注册表格时出错: %w", err)
 	}
+
+	// 聊天消息按(conversation_id, id)分页和同步，删除旧的(conversation_id, created_at)索引
+	if db.Migrator().HasIndex(&chat.ChatMessageModel{}, "idx_conv_msg") {
+		if err := db.Migrator().DropIndex(&chat.ChatMessageModel{}, "idx_conv_msg"); err != nil {
+			return fmt.Errorf("删除旧索引时出错: %w", err)
+		}
+	}
 	return nil
 }
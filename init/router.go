@@ -1,12 +1,21 @@
 package init
 
 import (
+	"campus2/app/auth"
+	"campus2/app/chat"
 	"campus2/app/ping"
+	"campus2/app/preference"
+	"campus2/app/presence"
+	"campus2/app/room"
 	"campus2/app/websocket"
+	"campus2/pkg/middleware"
 
 	"github.com/gin-gonic/gin"
 )
 
+// webSocketApp 关闭服务时需要断开其上的连接
+var webSocketApp *websocket.WebSocketApp
+
 func Routers() *gin.Engine {
 	Router := gin.New()
 
@@ -18,12 +27,25 @@ func Routers() *gin.Engine {
 
 	private := Router.Group("")
 	public := Router.Group("")
+	// 私有路由需要携带有效的JWT
+	private.Use(middleware.JWTAuth())
 
 	// 注册 ping 路由
 	ping.NewPingApp().InitPingRouter(private, public)
+	// 注册认证路由
+	auth.NewAuthApp().InitAuthRouter(private, public)
+	// 注册房间路由
+	room.NewRoomApp().InitRoomRouter(private, public)
+	// 注册聊天记录路由
+	chat.NewChatApp().InitChatRouter(private, public)
+	// 注册在线状态路由
+	presence.NewPresenceApp().InitPresenceRouter(private, public)
+	// 注册通知偏好路由
+	preference.NewPreferenceApp().InitPreferenceRouter(private, public)
 
 	// 注册WebSocket路由
-	websocket.NewWebSocketApp().InitWebSocketRouter(Router)
+	webSocketApp = websocket.NewWebSocketApp()
+	webSocketApp.InitWebSocketRouter(private, public)
 
 	return Router
 }
@@ -0,0 +1,108 @@
+package init
+
+import (
+	"campus2/pkg/global"
+	"campus2/pkg/kafka"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os/signal"
+	"syscall"
+)
+
+// RunServer 启动HTTP服务并阻塞，直到收到SIGINT/SIGTERM或服务异常退出，随后按顺序优雅关闭
+func RunServer() error {
+	cfg := global.GVA_CONFIG.System
+	server := &http.Server{
+		Addr:         fmt.Sprintf(":%d", cfg.Port),
+		Handler:      Routers(),
+		ReadTimeout:  cfg.GetReadTimeout(),
+		WriteTimeout: cfg.GetWriteTimeout(),
+		IdleTimeout:  cfg.GetIdleTimeout(),
+	}
+	if webSocketApp != nil {
+		// SSE和长轮询是普通HTTP请求，关闭时先结束这些会话，否则Shutdown会一直等到超时
+		server.RegisterOnShutdown(webSocketApp.CloseSessions)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		var err error
+		if cfg.UseTLS() {
+			global.GVA_LOG.Infof("服务启动，监听 %s (TLS)", server.Addr)
+			err = server.ListenAndServeTLS(cfg.TLSCert, cfg.TLSKey)
+		} else {
+			global.GVA_LOG.Infof("服务启动，监听 %s", server.Addr)
+			err = server.ListenAndServe()
+		}
+		if !errors.Is(err, http.ErrServerClosed) {
+			serveErr <- err
+		}
+		close(serveErr)
+	}()
+
+	var err error
+	select {
+	case <-ctx.Done():
+		global.GVA_LOG.Info("收到退出信号，开始关闭服务")
+	case err = <-serveErr:
+		global.GVA_LOG.Errorf("服务异常退出: %v", err)
+	}
+	stop() // 再次收到信号时直接退出
+
+	shutdown(server)
+	return err
+}
+
+// shutdown 按依赖顺序释放资源：HTTP服务 -> WebSocket连接 -> Kafka -> 数据库 -> Redis。
+// WebSocket注销和离线写入依赖Kafka和Redis，所以它们最后关闭
+func shutdown(server *http.Server) {
+	ctx, cancel := context.WithTimeout(context.Background(), global.GVA_CONFIG.System.GetShutdownTimeout())
+	defer cancel()
+
+	// 停止监听并等待普通HTTP请求处理完成，已升级的WebSocket连接不受影响，SSE和长轮询会话由CloseSessions结束
+	if err := server.Shutdown(ctx); err != nil {
+		global.GVA_LOG.Errorf("关闭HTTP服务失败: %v", err)
+	}
+
+	// 发送关闭帧，等待连接注销和未确认消息写入离线存储
+	if webSocketApp != nil {
+		if err := webSocketApp.Shutdown(ctx); err != nil {
+			global.GVA_LOG.Errorf("关闭WebSocket服务失败: %v", err)
+		}
+	}
+
+	if stopConsumer != nil {
+		stopConsumer()
+		select {
+		case <-consumerDone:
+		case <-ctx.Done():
+			global.GVA_LOG.Warn("等待Kafka消费者组退出超时")
+		}
+	}
+	if global.GVA_CONFIG.System.UseKafka {
+		kafka.Close()
+		global.GVA_LOG.Info("Kafka 已关闭")
+	}
+
+	if global.GVA_DB != nil {
+		if db, err := global.GVA_DB.DB(); err == nil {
+			if err := db.Close(); err != nil {
+				global.GVA_LOG.Errorf("关闭数据库连接失败: %v", err)
+			}
+		}
+		global.GVA_LOG.Info("数据库连接已关闭")
+	}
+
+	if global.GVA_REDIS != nil {
+		if err := global.GVA_REDIS.Close(); err != nil {
+			global.GVA_LOG.Errorf("关闭Redis连接失败: %v", err)
+		}
+		global.GVA_LOG.Info("Redis 已关闭")
+	}
+	global.GVA_LOG.Info("服务已关闭")
+}
@@ -7,4 +7,5 @@ type Config struct {
 	Redis     Redis     `yaml:"redis"`
 	WebSocket WebSocket `yaml:"websocket"`
 	Kafka     Kafka     `yaml:"kafka"`
+	JWT       JWT       `yaml:"jwt"`
 }
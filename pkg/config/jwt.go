@@ -0,0 +1,8 @@
+package config
+
+type JWT struct {
+	Secret string `yaml:"secret"` // 签名密钥
+	Expire string `yaml:"expire"` // token过期时间
+	Buffer string `yaml:"buffer"` // 缓冲时间，剩余有效期小于该值时签发新token
+	Issuer string `yaml:"issuer"` // 签发者
+}
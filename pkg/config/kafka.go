@@ -9,6 +9,7 @@ type Kafka struct {
 	ConsumerGroup     string   `yaml:"consumerGroup"`     // 消费者组ID
 	Topic             string   `yaml:"topic"`             // 主题
 	MessageExpiration string   `yaml:"messageExpiration"` // 消息过期时间
+	FetchTimeout      string   `yaml:"fetchTimeout"`      // 读取离线消息的最长等待时间
 }
 
 // GetMessageExpiration 获取消息过期时间
@@ -19,3 +20,12 @@ func (k *Kafka) GetMessageExpiration() time.Duration {
 	}
 	return duration
 }
+
+// GetFetchTimeout 获取读取离线消息的最长等待时间
+func (k *Kafka) GetFetchTimeout() time.Duration {
+	duration, err := time.ParseDuration(k.FetchTimeout)
+	if err != nil || duration <= 0 {
+		return time.Second * 3 // 默认3秒
+	}
+	return duration
+}
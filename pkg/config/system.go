@@ -1,8 +1,51 @@
 package config
 
+import "time"
+
 type System struct {
 	Port     int    `yaml:"port"`
 	UseRedis bool   `yaml:"useRedis"`
 	UseKafka bool   `yaml:"useKafka"`
 	ServerID string `yaml:"serverID"`
+
+	ReadTimeout     string `yaml:"readTimeout"`     // 读取整个请求的超时时间
+	WriteTimeout    string `yaml:"writeTimeout"`    // 写入响应的超时时间，升级为WebSocket后不再生效
+	IdleTimeout     string `yaml:"idleTimeout"`     // keep-alive连接的空闲超时时间
+	ShutdownTimeout string `yaml:"shutdownTimeout"` // 收到退出信号后等待连接排空的最长时间
+	TLSCert         string `yaml:"tlsCert"`         // 证书文件路径，与tlsKey同时配置时启用HTTPS/WSS
+	TLSKey          string `yaml:"tlsKey"`          // 私钥文件路径
+}
+
+// GetReadTimeout 获取读取超时时间
+func (s *System) GetReadTimeout() time.Duration {
+	return parseDuration(s.ReadTimeout, 15*time.Second)
+}
+
+// GetWriteTimeout 获取写入超时时间
+func (s *System) GetWriteTimeout() time.Duration {
+	return parseDuration(s.WriteTimeout, 15*time.Second)
+}
+
+// GetIdleTimeout 获取空闲超时时间
+func (s *System) GetIdleTimeout() time.Duration {
+	return parseDuration(s.IdleTimeout, 60*time.Second)
+}
+
+// GetShutdownTimeout 获取优雅关闭的超时时间
+func (s *System) GetShutdownTimeout() time.Duration {
+	return parseDuration(s.ShutdownTimeout, 30*time.Second)
+}
+
+// UseTLS 是否同时配置了证书和私钥
+func (s *System) UseTLS() bool {
+	return s.TLSCert != "" && s.TLSKey != ""
+}
+
+// parseDuration 解析时间配置，未配置或格式错误时使用默认值
+func parseDuration(value string, def time.Duration) time.Duration {
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return def
+	}
+	return d
 }
@@ -1,14 +1,77 @@
 package config
 
 import (
+	"fmt"
 	"time"
 )
 
 type WebSocket struct {
 	HeartbeatTime   int    `yaml:"heartbeatTime"`   // 心跳检测时间(秒)
-	ReadBufferSize  int    `yaml:"readBufferSize"`  // 读取缓冲大小
-	WriteBufferSize int    `yaml:"writeBufferSize"` // 写入缓冲大小
+	ReadBufferSize  int    `yaml:"readBufferSize"`  // 握手时分配的读取缓冲大小(字节)，不限制消息大小
+	WriteBufferSize int    `yaml:"writeBufferSize"` // 握手时分配的写入缓冲大小(字节)
+	MaxMessageSize  int    `yaml:"maxMessageSize"`  // 单条上行消息的最大字节数，超过时断开连接
 	Expire          string `yaml:"expire"`          // Redis存储过期时间
+	AckTimeout      int    `yaml:"ackTimeout"`      // 等待客户端确认的超时时间(秒)，超时后重传
+	AckRetries      int    `yaml:"ackRetries"`      // 最大重传次数，超过后转入离线存储
+	AckWindow       int    `yaml:"ackWindow"`       // 每个连接最多等待确认的消息数
+
+	SendBufferSize     int    `yaml:"sendBufferSize"`     // 每个连接发送队列的长度
+	SlowConsumerPolicy string `yaml:"slowConsumerPolicy"` // 发送队列已满时的处理策略: drop_oldest/spill/disconnect
+
+	MaxContentLength int `yaml:"maxContentLength"` // 消息文本内容的最大字符数
+	MaxURLLength     int `yaml:"maxURLLength"`     // extra.url和图片地址的最大长度
+
+	DedupeWindow string `yaml:"dedupeWindow"` // 按clientMsgId去重的时间窗口
+
+	ResumeBufferSize int    `yaml:"resumeBufferSize"` // 每个用户保留的可续传消息数
+	ResumeWindow     string `yaml:"resumeWindow"`     // 可续传消息的保留时间
+
+	Compression    Compression `yaml:"compression"`    // permessage-deflate压缩
+	AllowedOrigins []string    `yaml:"allowedOrigins"` // 允许握手的Origin，未配置时允许所有来源
+
+	Aggregation    Aggregation `yaml:"aggregation"`    // 点赞、收藏、评论通知的聚合
+	RateLimit      RateLimit   `yaml:"rateLimit"`      // 上行消息限流
+	BroadcastRoles []string    `yaml:"broadcastRoles"` // 允许发送全员广播的角色(JWT中的role)
+	AdminRoles     []string    `yaml:"adminRoles"`     // 允许调用/admin/ws管理接口的角色
+}
+
+// Compression permessage-deflate压缩，客户端在握手时声明支持才会生效
+type Compression struct {
+	Enabled   bool `yaml:"enabled"`
+	Level     int  `yaml:"level"`     // 压缩级别-2~9，0使用默认级别
+	Threshold int  `yaml:"threshold"` // 超过该字节数的消息才压缩，小消息压缩收益低于CPU开销
+}
+
+// Aggregation 同一动态的点赞、收藏、评论通知在窗口内合并为一条摘要
+type Aggregation struct {
+	Disabled bool     `yaml:"disabled"` // 关闭聚合，每条通知单独推送
+	Window   string   `yaml:"window"`   // 聚合窗口，从窗口内第一条通知开始计时
+	Types    []string `yaml:"types"`    // 参与聚合的通知类型，默认like/collect/comment
+}
+
+// GetWindow 获取聚合窗口
+func (a *Aggregation) GetWindow() time.Duration {
+	duration, err := time.ParseDuration(a.Window)
+	if err != nil || duration <= 0 {
+		return time.Second * 30 // 默认30秒
+	}
+	return duration
+}
+
+// RateLimit 上行消息的令牌桶限流，启用Redis时按用户在所有节点间共享。
+// Rate为每秒补充的令牌数，Burst为桶容量，每条消息消耗一个令牌
+type RateLimit struct {
+	Disabled   bool                     `yaml:"disabled"`   // 关闭限流
+	FailClosed bool                     `yaml:"failClosed"` // Redis出错时拒绝消息，默认退回单个连接的本地令牌桶
+	Rate       float64                  `yaml:"rate"`       // 每个用户所有类型合计
+	Burst      int                      `yaml:"burst"`
+	Types      map[string]RateLimitRule `yaml:"types"` // 按消息类型单独限制，覆盖默认值
+}
+
+// RateLimitRule 单个令牌桶的参数
+type RateLimitRule struct {
+	Rate  float64 `yaml:"rate"`
+	Burst int     `yaml:"burst"`
 }
 
 // GetExpiration 获取过期时间
@@ -19,3 +82,68 @@ func (w *WebSocket) GetExpiration() time.Duration {
 	}
 	return duration
 }
+
+// GetDedupeWindow 获取按clientMsgId去重的时间窗口
+func (w *WebSocket) GetDedupeWindow() time.Duration {
+	duration, err := time.ParseDuration(w.DedupeWindow)
+	if err != nil || duration <= 0 {
+		return time.Hour * 24 // 默认24小时
+	}
+	return duration
+}
+
+// GetResumeWindow 获取可续传消息的保留时间
+func (w *WebSocket) GetResumeWindow() time.Duration {
+	duration, err := time.ParseDuration(w.ResumeWindow)
+	if err != nil || duration <= 0 {
+		return time.Hour * 24 // 默认24小时
+	}
+	return duration
+}
+
+// Validate 检查配置的取值，热更新时校验失败的配置不会生效
+func (w *WebSocket) Validate() error {
+	for name, value := range map[string]int{
+		"heartbeatTime":    w.HeartbeatTime,
+		"readBufferSize":   w.ReadBufferSize,
+		"writeBufferSize":  w.WriteBufferSize,
+		"maxMessageSize":   w.MaxMessageSize,
+		"ackTimeout":       w.AckTimeout,
+		"ackRetries":       w.AckRetries,
+		"ackWindow":        w.AckWindow,
+		"sendBufferSize":   w.SendBufferSize,
+		"maxContentLength": w.MaxContentLength,
+		"maxURLLength":     w.MaxURLLength,
+		"resumeBufferSize": w.ResumeBufferSize,
+		"rateLimit.burst":  w.RateLimit.Burst,
+	} {
+		if value < 0 {
+			return fmt.Errorf("websocket.%s不能为负数: %d", name, value)
+		}
+	}
+	for name, value := range map[string]string{
+		"expire":             w.Expire,
+		"dedupeWindow":       w.DedupeWindow,
+		"resumeWindow":       w.ResumeWindow,
+		"aggregation.window": w.Aggregation.Window,
+	} {
+		if value == "" {
+			continue
+		}
+		if duration, err := time.ParseDuration(value); err != nil || duration <= 0 {
+			return fmt.Errorf("websocket.%s不是有效的时长: %q", name, value)
+		}
+	}
+	if w.Compression.Level < -2 || w.Compression.Level > 9 {
+		return fmt.Errorf("websocket.compression.level必须在-2~9之间: %d", w.Compression.Level)
+	}
+	if w.RateLimit.Rate < 0 {
+		return fmt.Errorf("websocket.rateLimit.rate不能为负数: %v", w.RateLimit.Rate)
+	}
+	for msgType, rule := range w.RateLimit.Types {
+		if rule.Rate < 0 || rule.Burst < 0 {
+			return fmt.Errorf("websocket.rateLimit.types.%s不能为负数", msgType)
+		}
+	}
+	return nil
+}
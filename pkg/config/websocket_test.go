@@ -0,0 +1,45 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestWebSocketValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		cfg   WebSocket
+		valid bool
+	}{
+		{"默认值", WebSocket{}, true},
+		{"有效配置", WebSocket{Expire: "12h", AckWindow: 64, Compression: Compression{Level: -2}, Aggregation: Aggregation{Window: "30s"}}, true},
+		{"负数", WebSocket{MaxMessageSize: -1}, false},
+		{"无效时长", WebSocket{ResumeWindow: "1天"}, false},
+		{"非正时长", WebSocket{DedupeWindow: "0s"}, false},
+		{"压缩级别越界", WebSocket{Compression: Compression{Level: 10}}, false},
+		{"限流为负数", WebSocket{RateLimit: RateLimit{Types: map[string]RateLimitRule{"chat": {Rate: -1}}}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.cfg.Validate(); (err == nil) != tt.valid {
+				t.Fatalf("校验结果应为%v，实际错误为%v", tt.valid, err)
+			}
+		})
+	}
+}
+
+func TestExampleConfigValid(t *testing.T) {
+	v := viper.New()
+	v.SetConfigFile("../../configs/config.example.yaml")
+	if err := v.ReadInConfig(); err != nil {
+		t.Fatal(err)
+	}
+	var cfg Config
+	if err := v.Unmarshal(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.WebSocket.Validate(); err != nil {
+		t.Fatalf("示例配置应通过校验: %v", err)
+	}
+}
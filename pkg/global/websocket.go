@@ -0,0 +1,23 @@
+package global
+
+import (
+	"campus2/pkg/config"
+	"sync/atomic"
+)
+
+// websocketConfig 可热更新的WebSocket配置，修改配置文件后整体替换为新的快照
+var websocketConfig atomic.Pointer[config.WebSocket]
+
+// WebSocketConfig 获取当前WebSocket配置的快照，调用方不能修改返回值。
+// 未发布快照时(如单元测试)返回GVA_CONFIG中的配置
+func WebSocketConfig() *config.WebSocket {
+	if cfg := websocketConfig.Load(); cfg != nil {
+		return cfg
+	}
+	return &GVA_CONFIG.WebSocket
+}
+
+// SetWebSocketConfig 发布新的WebSocket配置快照，正在读取旧快照的调用方不受影响
+func SetWebSocketConfig(cfg config.WebSocket) {
+	websocketConfig.Store(&cfg)
+}
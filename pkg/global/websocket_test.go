@@ -0,0 +1,38 @@
+package global
+
+import (
+	"campus2/pkg/config"
+	"sync"
+	"testing"
+)
+
+func TestWebSocketConfigSnapshot(t *testing.T) {
+	t.Cleanup(func() { websocketConfig.Store(nil) })
+
+	GVA_CONFIG.WebSocket.MaxMessageSize = 1
+	if got := WebSocketConfig().MaxMessageSize; got != 1 {
+		t.Fatalf("发布快照前应返回GVA_CONFIG中的配置，实际为%d", got)
+	}
+
+	cfg := config.WebSocket{MaxMessageSize: 2}
+	SetWebSocketConfig(cfg)
+	cfg.MaxMessageSize = 3
+	if got := WebSocketConfig().MaxMessageSize; got != 2 {
+		t.Fatalf("发布的快照应为副本，实际为%d", got)
+	}
+
+	// 热更新与读取并发进行，使用-race运行时不应报告数据竞争
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func(size int) {
+			defer wg.Done()
+			SetWebSocketConfig(config.WebSocket{MaxMessageSize: size, AllowedOrigins: []string{"*"}})
+		}(i + 10)
+		go func() {
+			defer wg.Done()
+			_ = WebSocketConfig().AllowedOrigins
+		}()
+	}
+	wg.Wait()
+}
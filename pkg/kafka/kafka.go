@@ -13,8 +13,10 @@ import (
 var (
 	producer     sarama.SyncProducer
 	consumer     sarama.ConsumerGroup
+	client       sarama.Client
 	producerOnce sync.Once
 	consumerOnce sync.Once
+	clientMu     sync.Mutex
 )
 
 // NewKafkaProducer 创建生产者
@@ -44,6 +46,26 @@ func NewKafkaConsumer(cfg config.Kafka) (sarama.ConsumerGroup, error) {
 	return consumer, err
 }
 
+// NewKafkaClient 创建用于按分区和offset读取消息的客户端，创建成功后复用同一个客户端，
+// 失败时不缓存，下次调用重新连接
+func NewKafkaClient(cfg config.Kafka) (sarama.Client, error) {
+	clientMu.Lock()
+	defer clientMu.Unlock()
+	if client != nil {
+		return client, nil
+	}
+
+	config := sarama.NewConfig()
+	config.Consumer.Return.Errors = true
+
+	c, err := sarama.NewClient(cfg.Brokers, config)
+	if err != nil {
+		return nil, err
+	}
+	client = c
+	return client, nil
+}
+
 // ConsumerHandler 消费者处理器
 type ConsumerHandler struct {
 	ready chan bool
@@ -101,6 +123,12 @@ func StartConsumerGroup(ctx context.Context, cfg config.Kafka, topics []string)
 
 // SendMessage 发送消息
 func SendMessage(topic string, key string, value []byte) error {
+	_, _, err := SendMessageWithOffset(topic, key, value)
+	return err
+}
+
+// SendMessageWithOffset 发送消息并返回消息写入的分区和offset
+func SendMessageWithOffset(topic string, key string, value []byte) (int32, int64, error) {
 	msg := &sarama.ProducerMessage{
 		Topic: topic,
 		Key:   sarama.StringEncoder(key),
@@ -109,11 +137,11 @@ func SendMessage(topic string, key string, value []byte) error {
 
 	partition, offset, err := producer.SendMessage(msg)
 	if err != nil {
-		return err
+		return 0, 0, err
 	}
 
 	log.Printf("Message sent to partition %d at offset %d\n", partition, offset)
-	return nil
+	return partition, offset, nil
 }
 
 // Close 关闭生产者和消费者
@@ -124,4 +152,10 @@ func Close() {
 	if consumer != nil {
 		consumer.Close()
 	}
+	clientMu.Lock()
+	if client != nil {
+		client.Close()
+		client = nil
+	}
+	clientMu.Unlock()
 }
@@ -0,0 +1,32 @@
+package middleware
+
+import (
+	"campus2/pkg/utils"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// JWTAuth 校验请求携带的token，校验通过后将载荷写入上下文；
+// token进入缓冲期时通过new-token/new-expires-at响应头下发新token
+func JWTAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token, _ := utils.GetTokenFromRequest(c.Request)
+		if token == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "missing token"})
+			return
+		}
+
+		j := utils.NewJWT()
+		claims, err := j.ValidateToken(token)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+
+		j.SetRefreshHeader(c.Writer.Header(), claims)
+
+		c.Set(utils.ClaimsKey, claims)
+		c.Next()
+	}
+}
@@ -0,0 +1,31 @@
+package middleware
+
+import (
+	"campus2/pkg/utils"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireRoles 只允许JWT中role属于roles的用户访问，需要在JWTAuth之后使用
+func RequireRoles(roles ...string) gin.HandlerFunc {
+	return RequireRolesFunc(func() []string { return roles })
+}
+
+// RequireRolesFunc 与RequireRoles相同，但每次请求都调用roles获取允许的角色，用于支持热更新的配置
+func RequireRolesFunc(roles func() []string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims := utils.GetClaims(c)
+		if claims == nil || claims.Role == "" {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "permission denied"})
+			return
+		}
+		for _, role := range roles() {
+			if claims.Role == role {
+				c.Next()
+				return
+			}
+		}
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "permission denied"})
+	}
+}
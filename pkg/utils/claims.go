@@ -0,0 +1,26 @@
+package utils
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+// ClaimsKey JWT中间件在gin.Context中存放载荷使用的key
+const ClaimsKey = "claims"
+
+// GetClaims 从gin.Context中获取JWT载荷
+func GetClaims(c *gin.Context) *CustomClaims {
+	if claims, ok := c.Get(ClaimsKey); ok {
+		if cl, ok := claims.(*CustomClaims); ok {
+			return cl
+		}
+	}
+	return nil
+}
+
+// GetUserID 从gin.Context中获取当前登录用户ID
+func GetUserID(c *gin.Context) string {
+	if claims := GetClaims(c); claims != nil {
+		return claims.Subject
+	}
+	return ""
+}
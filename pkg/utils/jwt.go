@@ -0,0 +1,226 @@
+package utils
+
+import (
+	"campus2/pkg/global"
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// jwtRevokedKeyPrefix 已吊销token的Redis key前缀，后接jti
+	jwtRevokedKeyPrefix = "jwt:revoked:"
+	// TokenSubprotocol 通过Sec-WebSocket-Protocol传递token时使用的协议标记
+	TokenSubprotocol = "access_token"
+	// bearerScheme Authorization头中携带token的认证方案
+	bearerScheme = "Bearer "
+)
+
+var (
+	ErrTokenExpired     = errors.New("token已过期")
+	ErrTokenNotValidYet = errors.New("token尚未生效")
+	ErrTokenMalformed   = errors.New("token格式错误")
+	ErrTokenInvalid     = errors.New("token无效")
+	ErrTokenRevoked     = errors.New("token已被吊销")
+)
+
+// CustomClaims 自定义的JWT载荷，Subject为用户ID，ID为token唯一标识(jti)
+type CustomClaims struct {
+	BufferTime int64  `json:"bufferTime"`         // 缓冲时间(秒)
+	Role       string `json:"role,omitempty"`     // 用户角色，如admin
+	School     string `json:"school,omitempty"`   // 学校
+	College    string `json:"college,omitempty"`  // 学院
+	Grade      string `json:"grade,omitempty"`    // 年级(入学年份)，如2023
+	Nickname   string `json:"nickname,omitempty"` // 昵称，用于通知摘要等展示
+	jwt.RegisteredClaims
+}
+
+type JWT struct {
+	SigningKey []byte
+}
+
+func NewJWT() *JWT {
+	return &JWT{
+		SigningKey: []byte(global.GVA_CONFIG.JWT.Secret),
+	}
+}
+
+// CreateClaims 为指定用户创建载荷
+func (j *JWT) CreateClaims(userID string) CustomClaims {
+	expire, err := ParseDuration(global.GVA_CONFIG.JWT.Expire)
+	if err != nil {
+		expire = time.Hour * 24 * 7 // 默认7天
+	}
+	buffer, err := ParseDuration(global.GVA_CONFIG.JWT.Buffer)
+	if err != nil {
+		buffer = time.Hour * 24 // 默认1天
+	}
+
+	now := time.Now()
+	return CustomClaims{
+		BufferTime: int64(buffer / time.Second),
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        strconv.FormatInt(now.UnixNano(), 36) + "-" + userID,
+			Subject:   userID,
+			Issuer:    global.GVA_CONFIG.JWT.Issuer,
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now.Add(-time.Second)),
+			ExpiresAt: jwt.NewNumericDate(now.Add(expire)),
+		},
+	}
+}
+
+// CreateToken 签发token
+func (j *JWT) CreateToken(claims CustomClaims) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString(j.SigningKey)
+}
+
+// ParseToken 解析并校验token
+func (j *JWT) ParseToken(tokenString string) (*CustomClaims, error) {
+	token, err := jwt.ParseWithClaims(tokenString, &CustomClaims{}, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, ErrTokenInvalid
+		}
+		return j.SigningKey, nil
+	}, jwt.WithIssuer(global.GVA_CONFIG.JWT.Issuer))
+	if err != nil {
+		switch {
+		case errors.Is(err, jwt.ErrTokenExpired):
+			return nil, ErrTokenExpired
+		case errors.Is(err, jwt.ErrTokenNotValidYet):
+			return nil, ErrTokenNotValidYet
+		case errors.Is(err, jwt.ErrTokenMalformed):
+			return nil, ErrTokenMalformed
+		default:
+			return nil, ErrTokenInvalid
+		}
+	}
+
+	claims, ok := token.Claims.(*CustomClaims)
+	if !ok || !token.Valid || claims.Subject == "" {
+		return nil, ErrTokenInvalid
+	}
+	return claims, nil
+}
+
+// ValidateToken 解析token并检查其是否已被吊销
+func (j *JWT) ValidateToken(tokenString string) (*CustomClaims, error) {
+	claims, err := j.ParseToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	revoked, err := IsTokenRevoked(claims.ID)
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return nil, ErrTokenRevoked
+	}
+	return claims, nil
+}
+
+// NeedRefresh token剩余有效期是否已进入缓冲期
+func (j *JWT) NeedRefresh(claims *CustomClaims) bool {
+	if claims.ExpiresAt == nil {
+		return false
+	}
+	return time.Until(claims.ExpiresAt.Time) < time.Duration(claims.BufferTime)*time.Second
+}
+
+// RefreshToken 基于旧载荷签发一个新token，返回新token及其过期时间
+func (j *JWT) RefreshToken(claims *CustomClaims) (string, time.Time, error) {
+	newClaims := j.refreshClaims(claims)
+	token, err := j.CreateToken(newClaims)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return token, newClaims.ExpiresAt.Time, nil
+}
+
+// refreshClaims 基于旧载荷生成新的载荷，保留用户属性
+func (j *JWT) refreshClaims(claims *CustomClaims) CustomClaims {
+	newClaims := j.CreateClaims(claims.Subject)
+	newClaims.Role = claims.Role
+	newClaims.School = claims.School
+	newClaims.College = claims.College
+	newClaims.Grade = claims.Grade
+	newClaims.Nickname = claims.Nickname
+	return newClaims
+}
+
+// SetRefreshHeader token进入缓冲期时签发新token，通过new-token/new-expires-at响应头下发，
+// 返回新token的载荷，无需刷新或签发失败时返回nil
+func (j *JWT) SetRefreshHeader(header http.Header, claims *CustomClaims) *CustomClaims {
+	if !j.NeedRefresh(claims) {
+		return nil
+	}
+	newClaims := j.refreshClaims(claims)
+	token, err := j.CreateToken(newClaims)
+	if err != nil {
+		global.GVA_LOG.Errorf("刷新token失败: %v", err)
+		return nil
+	}
+	header.Set("new-token", token)
+	header.Set("new-expires-at", strconv.FormatInt(newClaims.ExpiresAt.Unix(), 10))
+	return &newClaims
+}
+
+// RevokeToken 将token加入Redis吊销列表，保留到token自然过期为止
+func RevokeToken(claims *CustomClaims) error {
+	expiresAt := time.Now().Add(time.Minute)
+	if claims.ExpiresAt != nil {
+		expiresAt = claims.ExpiresAt.Time
+	}
+	return RevokeTokenID(claims.ID, expiresAt)
+}
+
+// RevokeTokenID 按jti吊销token，expiresAt为token的过期时间，已过期的token无需吊销
+func RevokeTokenID(jti string, expiresAt time.Time) error {
+	if global.GVA_REDIS == nil {
+		return errors.New("未启用Redis，无法吊销token")
+	}
+	ttl := time.Until(expiresAt)
+	if jti == "" || ttl <= 0 {
+		return nil
+	}
+	return global.GVA_REDIS.Set(context.Background(), jwtRevokedKeyPrefix+jti, 1, ttl).Err()
+}
+
+// IsTokenRevoked 检查token是否已被吊销，未启用Redis时始终返回false
+func IsTokenRevoked(jti string) (bool, error) {
+	if global.GVA_REDIS == nil {
+		return false, nil
+	}
+	n, err := global.GVA_REDIS.Exists(context.Background(), jwtRevokedKeyPrefix+jti).Result()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// GetTokenFromRequest 依次从Authorization头(只接受Bearer方案)、Sec-WebSocket-Protocol、查询参数token中获取token，
+// fromProtocol表示token是否来自Sec-WebSocket-Protocol
+func GetTokenFromRequest(r *http.Request) (token string, fromProtocol bool) {
+	// 其他认证方案(如Basic)不是JWT，继续从后面的来源获取
+	if auth := r.Header.Get("Authorization"); len(auth) > len(bearerScheme) && strings.EqualFold(auth[:len(bearerScheme)], bearerScheme) {
+		if token = strings.TrimSpace(auth[len(bearerScheme):]); token != "" {
+			return token, false
+		}
+	}
+
+	// 浏览器无法自定义握手头，约定以 new WebSocket(url, ["access_token", token]) 的方式传递
+	protocols := strings.Split(r.Header.Get("Sec-WebSocket-Protocol"), ",")
+	for i := 0; i < len(protocols)-1; i++ {
+		if strings.TrimSpace(protocols[i]) == TokenSubprotocol {
+			return strings.TrimSpace(protocols[i+1]), true
+		}
+	}
+
+	return r.URL.Query().Get("token"), false
+}
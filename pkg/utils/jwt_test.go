@@ -0,0 +1,176 @@
+package utils
+
+import (
+	"campus2/pkg/global"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/redis/go-redis/v9"
+)
+
+// newTestJWT 使用测试密钥创建JWT，测试结束后恢复配置
+func newTestJWT(t *testing.T) *JWT {
+	t.Helper()
+	config := global.GVA_CONFIG
+	t.Cleanup(func() { global.GVA_CONFIG = config })
+	global.GVA_CONFIG.JWT.Secret = "test_secret"
+	global.GVA_CONFIG.JWT.Issuer = "campus"
+	global.GVA_CONFIG.JWT.Expire = "1d"
+	global.GVA_CONFIG.JWT.Buffer = "1h"
+	return NewJWT()
+}
+
+// useMiniredis 使用miniredis作为global.GVA_REDIS
+func useMiniredis(t *testing.T) *miniredis.Miniredis {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	previous := global.GVA_REDIS
+	t.Cleanup(func() {
+		client.Close()
+		global.GVA_REDIS = previous
+	})
+	global.GVA_REDIS = client
+	return mr
+}
+
+func TestJWT(t *testing.T) {
+	j := newTestJWT(t)
+
+	t.Run("签发并解析", func(t *testing.T) {
+		token, err := j.CreateToken(j.CreateClaims("user_1"))
+		if err != nil {
+			t.Fatalf("签发token失败: %v", err)
+		}
+		claims, err := j.ParseToken(token)
+		if err != nil {
+			t.Fatalf("解析token失败: %v", err)
+		}
+		if claims.Subject != "user_1" {
+			t.Errorf("Subject应为user_1，实际为%s", claims.Subject)
+		}
+		if j.NeedRefresh(claims) {
+			t.Error("新签发的token不应需要刷新")
+		}
+	})
+
+	t.Run("过期token", func(t *testing.T) {
+		claims := j.CreateClaims("user_1")
+		claims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute))
+		token, _ := j.CreateToken(claims)
+		if _, err := j.ParseToken(token); err != ErrTokenExpired {
+			t.Errorf("应返回%v，实际为%v", ErrTokenExpired, err)
+		}
+	})
+
+	t.Run("缓冲期内需要刷新", func(t *testing.T) {
+		claims := j.CreateClaims("user_1")
+		claims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(time.Minute * 30))
+		if !j.NeedRefresh(&claims) {
+			t.Error("剩余有效期小于缓冲时间时应刷新")
+		}
+	})
+
+	t.Run("签名不匹配", func(t *testing.T) {
+		token, _ := j.CreateToken(j.CreateClaims("user_1"))
+		other := &JWT{SigningKey: []byte("other_secret")}
+		if _, err := other.ParseToken(token); err != ErrTokenInvalid {
+			t.Errorf("应返回%v，实际为%v", ErrTokenInvalid, err)
+		}
+	})
+}
+
+func TestRevokeToken(t *testing.T) {
+	j := newTestJWT(t)
+	mr := useMiniredis(t)
+
+	claims := j.CreateClaims("user_1")
+	token, _ := j.CreateToken(claims)
+	if _, err := j.ValidateToken(token); err != nil {
+		t.Fatalf("未吊销的token校验失败: %v", err)
+	}
+	if err := RevokeToken(&claims); err != nil {
+		t.Fatalf("吊销token失败: %v", err)
+	}
+	if _, err := j.ValidateToken(token); err != ErrTokenRevoked {
+		t.Errorf("应返回%v，实际为%v", ErrTokenRevoked, err)
+	}
+	if ttl := mr.TTL(jwtRevokedKeyPrefix + claims.ID); ttl <= 0 || ttl > 24*time.Hour {
+		t.Errorf("吊销记录应保留到token过期，TTL = %v", ttl)
+	}
+
+	// 已过期的token无需吊销
+	if err := RevokeTokenID("expired", time.Now().Add(-time.Minute)); err != nil {
+		t.Fatalf("吊销已过期的token失败: %v", err)
+	}
+	if mr.Exists(jwtRevokedKeyPrefix + "expired") {
+		t.Error("已过期的token不应写入吊销列表")
+	}
+}
+
+func TestSetRefreshHeader(t *testing.T) {
+	j := newTestJWT(t)
+	claims := j.CreateClaims("user_1")
+	claims.Role = "admin"
+
+	header := http.Header{}
+	if j.SetRefreshHeader(header, &claims) != nil || header.Get("new-token") != "" {
+		t.Fatal("未进入缓冲期的token不应刷新")
+	}
+
+	claims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(time.Minute * 30))
+	refreshed := j.SetRefreshHeader(header, &claims)
+	if refreshed == nil || header.Get("new-token") == "" || header.Get("new-expires-at") == "" {
+		t.Fatal("进入缓冲期的token应通过响应头下发新token")
+	}
+	parsed, err := j.ParseToken(header.Get("new-token"))
+	if err != nil {
+		t.Fatalf("解析新token失败: %v", err)
+	}
+	if parsed.Subject != "user_1" || parsed.Role != "admin" || parsed.ID == claims.ID {
+		t.Errorf("新token应保留用户属性并使用新的jti: %+v", parsed)
+	}
+}
+
+func TestGetTokenFromRequest(t *testing.T) {
+	tests := []struct {
+		name         string
+		auth         string
+		protocols    string
+		query        string
+		token        string
+		fromProtocol bool
+	}{
+		{"Bearer头", "Bearer abc", "", "", "abc", false},
+		{"Bearer不区分大小写", "bearer abc", "", "", "abc", false},
+		{"Bearer头优先于查询参数", "Bearer abc", "", "def", "abc", false},
+		{"子协议", "", "access_token, abc", "", "abc", true},
+		{"子协议与编码一起声明", "", "msgpack, access_token, abc", "", "abc", true},
+		{"查询参数", "", "", "abc", "abc", false},
+		{"Basic认证不当作token", "Basic dXNlcjpwYXNz", "", "abc", "abc", false},
+		{"没有方案的头不当作token", "abc", "", "", "", false},
+		{"空Bearer继续查找", "Bearer ", "access_token, abc", "", "abc", true},
+		{"子协议缺少token", "", "access_token", "", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, _ := http.NewRequest(http.MethodGet, "/ws", nil)
+			if tt.query != "" {
+				r.URL.RawQuery = "token=" + tt.query
+			}
+			if tt.auth != "" {
+				r.Header.Set("Authorization", tt.auth)
+			}
+			if tt.protocols != "" {
+				r.Header.Set("Sec-WebSocket-Protocol", tt.protocols)
+			}
+			token, fromProtocol := GetTokenFromRequest(r)
+			if token != tt.token || fromProtocol != tt.fromProtocol {
+				t.Errorf("应返回(%q, %v)，实际为(%q, %v)", tt.token, tt.fromProtocol, token, fromProtocol)
+			}
+		})
+	}
+}
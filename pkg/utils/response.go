@@ -0,0 +1,20 @@
+package utils
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RespondError 按业务错误对应的HTTP状态码返回错误，statuses中没有匹配的错误返回500
+func RespondError(c *gin.Context, err error, statuses map[error]int) {
+	status := http.StatusInternalServerError
+	for target, code := range statuses {
+		if errors.Is(err, target) {
+			status = code
+			break
+		}
+	}
+	c.JSON(status, gin.H{"error": err.Error()})
+}
@@ -9,6 +9,8 @@ import (
 	"github.com/fsnotify/fsnotify"
 	"github.com/gin-gonic/gin"
 	"github.com/spf13/viper"
+
+	appconfig "campus2/pkg/config"
 )
 
 func NewViper(path ...string) *viper.Viper {
@@ -54,16 +56,31 @@ START:
 	}
 	v.WatchConfig()
 
+	// 其他协程随时在读取配置，修改配置文件后不直接覆盖GVA_CONFIG，
+	// 而是解析到新的结构中，只整体替换可热更新的WebSocket配置快照，其余配置重启后生效。
+	// 解析或校验失败时保留当前配置，修正配置文件后再次保存即可
 	v.OnConfigChange(func(e fsnotify.Event) {
 		fmt.Println("config配置文件内容发生了改变:", e.Name)
-		if err = v.Unmarshal(&global.GVA_CONFIG); err != nil {
-			panic(err)
+		var cfg appconfig.Config
+		if err := v.Unmarshal(&cfg); err != nil {
+			global.GVA_LOG.Errorf("解析修改后的配置文件失败，继续使用当前配置: %v", err)
+			return
+		}
+		if err := cfg.WebSocket.Validate(); err != nil {
+			global.GVA_LOG.Errorf("修改后的WebSocket配置无效，继续使用当前配置: %v", err)
+			return
 		}
+		global.SetWebSocketConfig(cfg.WebSocket)
+		global.GVA_LOG.Info("WebSocket配置已更新")
 	})
 
 	if err = v.Unmarshal(&global.GVA_CONFIG); err != nil {
 		panic(err)
 	}
+	if err = global.GVA_CONFIG.WebSocket.Validate(); err != nil {
+		panic(fmt.Errorf("WebSocket配置无效: %s \n", err))
+	}
+	global.SetWebSocketConfig(global.GVA_CONFIG.WebSocket)
 
 	// 结构化打印出global.GVA_CONFIG内的所有数据
 	fmt.Printf("配置文件内容: %+v \n", global.GVA_CONFIG)